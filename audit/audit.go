@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"log"
+	"time"
+)
+
+// Actions recorded by the auth nanos
+const (
+	ActionRegister        = "user.register"
+	ActionSignin          = "user.signin"
+	ActionValidate        = "token.validate"
+	ActionUpdate          = "user.update"
+	ActionDelete          = "user.delete"
+	ActionChangeStatus    = "user.change_status"
+	ActionList            = "user.list"
+	ActionRevokeSession   = "session.revoke"
+	ActionRefresh         = "token.refresh"
+	ActionValidateSession = "session.validate"
+	ActionIntrospect      = "token.introspect"
+)
+
+// Outcomes of an action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is one authentication or account event.
+// Actor is who did the action and Subject the account it was done on,
+// both are user ids when known. Source is the caller supplied origin (IP or client id).
+// The sinks chain events with PrevHash and Hash so edits of stored events are detected.
+type Event struct {
+	ID      int64             `json:"id,omitempty"`
+	Time    time.Time         `json:"time"`
+	Actor   string            `json:"actor"`
+	Subject string            `json:"subject"`
+	Action  string            `json:"action"`
+	Outcome string            `json:"outcome"`
+	Source  string            `json:"source"`
+	Reason  string            `json:"reason,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	// set by the sinks, PrevHash is the Hash of the event stored before
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// Sink stores events, it must be safe for concurrent use and must never change stored events
+type Sink interface {
+	Write(event Event) error
+}
+
+// MultiSink writes every event to all its sinks
+type MultiSink []Sink
+
+func (m MultiSink) Write(event Event) error {
+	var firstErr error
+	for _, sink := range m {
+		err := sink.Write(event)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Record writes event to sink, stamping its time when missing.
+// A nil sink records nothing and write errors are logged, so auditing never fails the audited action.
+func Record(sink Sink, event Event) {
+	if sink == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	err := sink.Write(event)
+	if err != nil {
+		log.Println("audit:", err)
+	}
+}
@@ -0,0 +1,285 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestAudit(t *testing.T) {
+	t.Run("Given SQLite sink When events are written Then they are stored and can not be changed", testSQLiteSink)
+	t.Run("Given JSON lines sink When events are written Then one line is appended per event", testJSONLinesSink)
+	t.Run("Given sinks When Record events Then time is stamped and failures do not stop the others", testRecord)
+	t.Run("Given a chained SQLite log When events are edited or removed Then VerifySQLite reports the first broken link", testVerifySQLite)
+	t.Run("Given an audit table created before the chain When a SQLite sink opens it Then the chain columns are added", testSQLiteUpgrade)
+	t.Run("Given a chained JSON lines log When a line is edited Then VerifyJSONLines reports it", testVerifyJSONLines)
+}
+
+func writeEvents(t *testing.T, sink Sink, count int) {
+	for i := 0; i < count; i++ {
+		event := sampleEvent
+		event.Subject = strconv.Itoa(i)
+		if err := sink.Write(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testVerifySQLite(t *testing.T) {
+	key := []byte("audit key")
+
+	data := []struct {
+		tamper   string
+		position int64
+		reason   string
+	}{
+		{tamper: "", position: 0},
+		{tamper: "update audit_events set outcome = 'failure' where id = 2", position: 2, reason: "edited"},
+		{tamper: "delete from audit_events where id = 3", position: 4, reason: "previous hash"},
+		{tamper: "delete from audit_events where id = 5", position: 5, reason: "newest"},
+	}
+
+	for i := range data {
+		db := datastores.SqliteConnection("test.db")
+		writeEvents(t, NewSQLiteSink(db, key), 5)
+		if data[i].tamper != "" {
+			_, err := db.Exec("drop trigger audit_events_no_update; drop trigger audit_events_no_delete; " + data[i].tamper)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		broken, err := VerifySQLite(db, key)
+		if err != nil {
+			t.Fatalf("\t%s\tdata[%v] VerifySQLite should not return error -- %v", failure, i, err)
+		}
+		if data[i].position == 0 {
+			if broken != nil {
+				t.Fatalf("\t%s\tdata[%v] chain should be intact -- %v", failure, i, broken)
+			}
+			// the chain does not verify with another key
+			if broken, _ := VerifySQLite(db, []byte("other key")); broken == nil || broken.Position != 1 {
+				t.Fatalf("\t%s\tdata[%v] chain should not verify with another key -- %v", failure, i, broken)
+			}
+			continue
+		}
+		if broken == nil || broken.Position != data[i].position || !strings.Contains(broken.Reason, data[i].reason) {
+			t.Fatalf("\t%s\tdata[%v] expected broken link at %v //%s// -- %v", failure, i, data[i].position, data[i].reason, broken)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testSQLiteUpgrade(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	_, err := db.Exec(`
+			create table audit_events (
+			    	id integer not null primary key autoincrement,
+			    	time integer not null,
+			    	actor text not null,
+			    	subject text not null,
+			    	action text not null,
+			    	outcome text not null,
+			    	source text not null,
+			    	reason text not null,
+			    	details text not null
+			                    );
+			insert into audit_events (time, actor, subject, action, outcome, source, reason, details) values (1, '1', '1', 'user.signin', 'success', '', '', 'null');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := NewSQLiteSink(db, nil)
+	writeEvents(t, sink, 2)
+	var count int
+	_ = db.QueryRow("SELECT count(*) FROM audit_events").Scan(&count)
+	if count != 3 {
+		t.Fatalf("\t%s\tevents should be stored after the upgrade -- %v", failure, count)
+	}
+	broken, err := VerifySQLite(db, nil)
+	if broken != nil || err != nil {
+		t.Fatalf("\t%s\tthe chain should start after the events written before it -- %v %v", failure, broken, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testVerifyJSONLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.jsonl")
+
+	// the chain continues across sinks opened on the same file
+	for i := 0; i < 2; i++ {
+		sink, err := NewJSONLinesSink(filename, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeEvents(t, sink, 2)
+		sink.Close()
+	}
+	broken, err := VerifyJSONLines(filename, nil)
+	if err != nil || broken != nil {
+		t.Fatalf("\t%s\tchain should be intact -- %v %v", failure, broken, err)
+	}
+
+	// empty details are not written, the event must still verify
+	sink, err := NewJSONLinesSink(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := sampleEvent
+	empty.Details = map[string]string{}
+	if err = sink.Write(empty); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+	broken, err = VerifyJSONLines(filename, nil)
+	if err != nil || broken != nil {
+		t.Fatalf("\t%s\tchain should be intact -- %v %v", failure, broken, err)
+	}
+
+	raw, _ := ioutil.ReadFile(filename)
+	lines := strings.Split(string(raw), "\n")
+	lines[2] = strings.Replace(lines[2], `"outcome":"success"`, `"outcome":"failure"`, 1)
+	_ = ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0600)
+
+	broken, err = VerifyJSONLines(filename, nil)
+	if err != nil || broken == nil || broken.Position != 3 {
+		t.Fatalf("\t%s\tline 3 should be reported -- %v %v", failure, broken, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+var sampleEvent = Event{
+	Time:    time.Unix(1000, 5).UTC(),
+	Actor:   "1",
+	Subject: "2",
+	Action:  ActionChangeStatus,
+	Outcome: OutcomeSuccess,
+	Source:  "10.0.0.1",
+	Details: map[string]string{"status": "disabled"},
+}
+
+func testSQLiteSink(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	sink := NewSQLiteSink(db, nil)
+	err := sink.Write(sampleEvent)
+	if err != nil {
+		t.Fatalf("\t%s\tWrite should not return error -- %v", failure, err)
+	}
+
+	rows, err := db.Query("SELECT " + EventsColumns + " FROM audit_events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows.Next() {
+		t.Fatalf("\t%s\tthe event is not stored", failure)
+	}
+	stored, err := ScanEvent(rows)
+	rows.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := sampleEvent
+	expected.ID = 1
+	expected.Hash = stored.Hash
+	if !reflect.DeepEqual(stored, expected) || stored.Hash == "" {
+		t.Fatalf("\t%s\tstored event %v is not %v", failure, stored, expected)
+	}
+
+	if _, err := db.Exec("update audit_events set outcome = 'failure'"); err == nil {
+		t.Fatalf("\t%s\tevents should not be updated", failure)
+	}
+	if _, err := db.Exec("delete from audit_events"); err == nil {
+		t.Fatalf("\t%s\tevents should not be deleted", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testJSONLinesSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.jsonl")
+	sink, err := NewJSONLinesSink(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := sink.Write(sampleEvent); err != nil {
+			t.Fatalf("\t%s\tWrite should not return error -- %v", failure, err)
+		}
+	}
+	sink.Close()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("\t%s\tline %v is not an event -- %v", failure, lines, err)
+		}
+		if event.Actor != sampleEvent.Actor || !event.Time.Equal(sampleEvent.Time) || event.Hash == "" {
+			t.Fatalf("\t%s\tline %v is %v", failure, lines, event)
+		}
+		lines++
+	}
+	if lines != 3 {
+		t.Fatalf("\t%s\t3 lines should be written -- %v", failure, lines)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+type recordingSink struct {
+	events []Event
+	err    error
+}
+
+func (s *recordingSink) Write(event Event) error {
+	s.events = append(s.events, event)
+	return s.err
+}
+
+func testRecord(t *testing.T) {
+	broken := &recordingSink{err: errors.New("disk is full")}
+	working := &recordingSink{}
+
+	Record(nil, sampleEvent)
+	Record(MultiSink{broken, working}, Event{Action: ActionSignin})
+
+	if len(working.events) != 1 || len(broken.events) != 1 {
+		t.Fatalf("\t%s\tevery sink should get the event", failure)
+	}
+	if working.events[0].Time.IsZero() {
+		t.Fatalf("\t%s\tRecord should stamp the time", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
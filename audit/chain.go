@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+)
+
+// hashEvent returns the chain hash of event linked to prevHash.
+// It is HMAC-SHA256 with key when key is set, plain SHA-256 otherwise.
+func hashEvent(event Event, prevHash string, key []byte) (string, error) {
+
+	// empty details are not stored by every sink, they hash as none
+	details := event.Details
+	if len(details) == 0 {
+		details = nil
+	}
+
+	// stable encoding of everything but the id and the hashes, encoding/json sorts the details keys
+	raw, err := json.Marshal(struct {
+		PrevHash string            `json:"prev_hash"`
+		Time     int64             `json:"time"`
+		Actor    string            `json:"actor"`
+		Subject  string            `json:"subject"`
+		Action   string            `json:"action"`
+		Outcome  string            `json:"outcome"`
+		Source   string            `json:"source"`
+		Reason   string            `json:"reason"`
+		Details  map[string]string `json:"details"`
+	}{
+		PrevHash: prevHash,
+		Time:     event.Time.UnixNano(),
+		Actor:    event.Actor,
+		Subject:  event.Subject,
+		Action:   event.Action,
+		Outcome:  event.Outcome,
+		Source:   event.Source,
+		Reason:   event.Reason,
+		Details:  details,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(raw)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// BrokenLink is the first event of a log whose chain does not verify.
+// Position is the event id for SQLite logs and the line number for JSON lines logs.
+type BrokenLink struct {
+	Position int64
+	Reason   string
+}
+
+func (b *BrokenLink) Error() string {
+	return fmt.Sprintf("audit log chain is broken at %d: %s", b.Position, b.Reason)
+}
+
+// chainVerifier checks events one by one in log order.
+// Events without hashes at the start of a log were written before the chain and are skipped.
+type chainVerifier struct {
+	key      []byte
+	prevHash string
+	chained  bool
+}
+
+func (v *chainVerifier) check(position int64, event Event) (*BrokenLink, error) {
+	if !v.chained && event.PrevHash == "" && event.Hash == "" {
+		return nil, nil
+	}
+	v.chained = true
+	if event.PrevHash != v.prevHash {
+		return &BrokenLink{Position: position, Reason: "previous hash does not match, an event before it was removed or inserted"}, nil
+	}
+	expected, err := hashEvent(event, event.PrevHash, v.key)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(event.Hash)) {
+		return &BrokenLink{Position: position, Reason: "hash does not match, the event was edited"}, nil
+	}
+	v.prevHash = event.Hash
+	return nil, nil
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// JSONLinesSink appends events to a file, one JSON object per line.
+// Every event stores the hash of the previous one, see VerifyJSONLines.
+// The file keeps no count of its events, so removing the newest lines leaves a valid chain.
+// Keep the last hash somewhere the writers of the file can not change to detect such a truncation.
+type JSONLinesSink struct {
+	mu       sync.Mutex
+	file     *os.File
+	key      []byte
+	lastHash string
+}
+
+// NewJSONLinesSink returns a sink chaining events with SHA-256, or HMAC-SHA256 when key is set.
+// Events already in the file are read to continue their chain.
+func NewJSONLinesSink(filename string, key []byte) (*JSONLinesSink, error) {
+	lastHash, err := lastJSONLinesHash(filename)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesSink{file: file, key: key, lastHash: lastHash}, nil
+}
+
+func (s *JSONLinesSink) Write(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	event.PrevHash = s.lastHash
+	event.Hash, err = hashEvent(event, event.PrevHash, s.key)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Write(append(raw, '\n'))
+	if err != nil {
+		return err
+	}
+	s.lastHash = event.Hash
+	return nil
+}
+
+func (s *JSONLinesSink) Close() error {
+	return s.file.Close()
+}
+
+// readJSONLines calls fn with every line of the file and its number, starting at 1, until fn returns false
+func readJSONLines(filename string, fn func(line int64, raw []byte) (bool, error)) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var line int64
+	for scanner.Scan() {
+		line++
+		next, err := fn(line, scanner.Bytes())
+		if err != nil || !next {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func lastJSONLinesHash(filename string) (string, error) {
+	var lastHash string
+	err := readJSONLines(filename, func(line int64, raw []byte) (bool, error) {
+		var event Event
+		err := json.Unmarshal(raw, &event)
+		lastHash = event.Hash
+		return err == nil, err
+	})
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return lastHash, err
+}
+
+// VerifyJSONLines walks the file in order and returns the first broken link, nil when the chain is intact.
+// A file cut after any event is still intact, unlike VerifySQLite it can not detect the newest events were removed.
+func VerifyJSONLines(filename string, key []byte) (*BrokenLink, error) {
+	verifier := chainVerifier{key: key}
+	var broken *BrokenLink
+	err := readJSONLines(filename, func(line int64, raw []byte) (bool, error) {
+		var event Event
+		err := json.Unmarshal(raw, &event)
+		if err != nil {
+			broken = &BrokenLink{Position: line, Reason: "line is not an event"}
+			return false, nil
+		}
+		broken, err = verifier.check(line, event)
+		return broken == nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return broken, nil
+}
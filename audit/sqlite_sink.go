@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"log"
+	"sync"
+	"time"
+)
+
+// SQLiteSink appends events to the audit_events table.
+// Every event stores the hash of the previous one, see VerifySQLite.
+// Triggers refuse updates and deletes on the table.
+// Only one sink should write to a table, it serializes the writes to keep the chain linear.
+type SQLiteSink struct {
+	mu  sync.Mutex
+	db  *sql.DB
+	key []byte
+}
+
+// NewSQLiteSink returns a sink chaining events with SHA-256, or HMAC-SHA256 when key is set
+func NewSQLiteSink(db *sql.DB, key []byte) *SQLiteSink {
+	sink := &SQLiteSink{db: db, key: key}
+	sink.prepareStore()
+	return sink
+}
+
+// eventsChainColumns are the chain columns, tables created before the chain get them on prepareStore
+var eventsChainColumns = []datastores.Column{
+	{Name: "prev_hash", Definition: "text not null default ''"},
+	{Name: "hash", Definition: "text not null default ''"},
+}
+
+func (s *SQLiteSink) prepareStore() {
+	stmt := `
+			create table if not exists audit_events (
+			    	id integer not null primary key autoincrement,
+			    	time integer not null,
+			    	actor text not null,
+			    	subject text not null,
+			    	action text not null,
+			    	outcome text not null,
+			    	source text not null,
+			    	reason text not null,
+			    	details text not null,
+			    	prev_hash text not null,
+			    	hash text not null
+			                    );
+			create index if not exists audit_events_time on audit_events (time);
+			create trigger if not exists audit_events_no_update before update on audit_events
+			begin select raise(abort, 'audit events are append-only'); end;
+			create trigger if not exists audit_events_no_delete before delete on audit_events
+			begin select raise(abort, 'audit events are append-only'); end;`
+	_, err := s.db.Exec(stmt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	datastores.AddMissingColumns(s.db, "audit_events", eventsChainColumns)
+}
+
+func (s *SQLiteSink) Write(event Event) error {
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// link to the last event
+	var prevHash string
+	err = tx.QueryRow("SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	event.PrevHash = prevHash
+	event.Hash, err = hashEvent(event, prevHash, s.key)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("insert into audit_events (time, actor, subject, action, outcome, source, reason, details, prev_hash, hash) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		event.Time.UnixNano(), event.Actor, event.Subject, event.Action, event.Outcome, event.Source, event.Reason, string(details), event.PrevHash, event.Hash)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// EventsColumns lists the audit_events columns scanned by ScanEvent
+const EventsColumns = "id, time, actor, subject, action, outcome, source, reason, details, prev_hash, hash"
+
+// ScanEvent reads a row selected with EventsColumns
+func ScanEvent(rows *sql.Rows) (Event, error) {
+	var event Event
+	var unixNano int64
+	var details string
+	err := rows.Scan(&event.ID, &unixNano, &event.Actor, &event.Subject, &event.Action, &event.Outcome, &event.Source, &event.Reason, &details, &event.PrevHash, &event.Hash)
+	if err != nil {
+		return Event{}, err
+	}
+	event.Time = time.Unix(0, unixNano).UTC()
+	err = json.Unmarshal([]byte(details), &event.Details)
+	if err != nil {
+		return Event{}, err
+	}
+	return event, nil
+}
+
+// VerifySQLite walks the audit_events table in order and returns the first broken link, nil when the chain is intact.
+// Removing the newest events is detected through the table autoincrement sequence.
+func VerifySQLite(db *sql.DB, key []byte) (*BrokenLink, error) {
+	rows, err := db.Query("SELECT " + EventsColumns + " FROM audit_events ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	verifier := chainVerifier{key: key}
+	var lastID int64
+	for rows.Next() {
+		event, err := ScanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		broken, err := verifier.check(event.ID, event)
+		if broken != nil || err != nil {
+			return broken, err
+		}
+		lastID = event.ID
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	var sequence int64
+	err = db.QueryRow("SELECT seq FROM sqlite_sequence WHERE name = 'audit_events'").Scan(&sequence)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if sequence > lastID {
+		return &BrokenLink{Position: lastID + 1, Reason: "the newest events were removed"}, nil
+	}
+	return nil, nil
+}
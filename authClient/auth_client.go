@@ -0,0 +1,88 @@
+package authClient
+
+import (
+	"context"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/registerUser"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// AuthClient calls the auth nanos and blocks until they reply.
+// Every call carries its context to the nanos, so cancelling it skips the remaining work.
+// Errors are the *entities.Error sent by the nanos, or cancelled and deadline_exceeded
+// when ctx ended first.
+type AuthClient struct {
+	register chan nanos.Message
+	signin   chan nanos.Message
+	validate chan nanos.Message
+}
+
+// NewAuthClient returns the client of the channels returned by NewRegisterUserNanos,
+// NewSigninUserNanos and NewValidateJWTNanos. A nil channel fails its calls.
+func NewAuthClient(register chan nanos.Message, signin chan nanos.Message, validate chan nanos.Message) *AuthClient {
+	return &AuthClient{
+		register: register,
+		signin:   signin,
+		validate: validate,
+	}
+}
+
+// Register registers user and returns its id, 0 when the registerUser nanos runs in silent mode
+func (c *AuthClient) Register(ctx context.Context, user entities.User) (int64, error) {
+	return c.RegisterWith(ctx, registerUser.Request{User: user})
+}
+
+// RegisterWith is Register with the full request, e.g. to pass the source for rate limiting
+func (c *AuthClient) RegisterWith(ctx context.Context, req registerUser.Request) (int64, error) {
+	res, err := call(ctx, c.register, "registerUser", req)
+	if err != nil {
+		return 0, err
+	}
+	response, err := registerUser.DecodeResponse(res)
+	if err != nil {
+		return 0, entities.ToError(err)
+	}
+	return response.ID, nil
+}
+
+// Signin signs in the user whose username, email or phone is identifier
+func (c *AuthClient) Signin(ctx context.Context, identifier string, password string) (signinUser.Tokens, error) {
+	return c.SigninWith(ctx, signinUser.Request{FirstField: identifier, Password: password})
+}
+
+// SigninWith is Signin with the full request, e.g. to pass the device or a step-up code
+func (c *AuthClient) SigninWith(ctx context.Context, req signinUser.Request) (signinUser.Tokens, error) {
+	res, err := call(ctx, c.signin, "signinUser", req)
+	if err != nil {
+		return signinUser.Tokens{}, err
+	}
+	response, err := signinUser.DecodeResponse(res)
+	if err != nil {
+		return signinUser.Tokens{}, entities.ToError(err)
+	}
+	return response.Tokens, nil
+}
+
+// Validate validates token and returns its claims
+func (c *AuthClient) Validate(ctx context.Context, token string) (validateJWT.Claims, error) {
+	res, err := call(ctx, c.validate, "validateJWT", validateJWT.Request{Token: token})
+	if err != nil {
+		return validateJWT.Claims{}, err
+	}
+	response, err := validateJWT.DecodeResponse(res)
+	if err != nil {
+		return validateJWT.Claims{}, entities.ToError(err)
+	}
+	return response.Claims, nil
+}
+
+// call sends payload to the nanos behind mailBox, name tells which one is missing
+func call(ctx context.Context, mailBox chan nanos.Message, name string, payload interface{}) (nanos.Message, error) {
+	if mailBox == nil {
+		return nanos.Message{}, entities.NewError(entities.CodeInternal, name+" nanos is not set")
+	}
+	return messages.Call(ctx, mailBox, payload)
+}
@@ -0,0 +1,121 @@
+package authClient
+
+import (
+	"context"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/registerUser"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"os"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestAuthClient(t *testing.T) {
+	t.Run("Given the auth nanos When register, signin and validate Then each call returns its result", testRoundTrip)
+	t.Run("Given wrong input When call the client Then the coded nanos errors are returned", testErrors)
+	t.Run("Given a cancelled or expired context When call the client Then it does not wait", testContext)
+}
+
+func newClient() *AuthClient {
+	db := datastores.SqliteConnection("test.db")
+	key := "secretKey"
+	return NewAuthClient(
+		registerUser.NewRegisterUserNanos(1, 10, db, nil, nil, nil, nil, nil, registerUser.Options{}),
+		signinUser.NewSigninUserNanos(1, 10, db, key, 4, nil, nil, signinUser.Options{}),
+		validateJWT.NewValidateJWTNanos(1, 10, key, validateJWT.Options{DB: db}),
+	)
+}
+
+func testRoundTrip(t *testing.T) {
+	client := newClient()
+	ctx := context.Background()
+
+	id, err := client.Register(ctx, entities.User{Name: "Bashar", Username: "bashar_123", Password: "bb123123"})
+	if err != nil || id != 1 {
+		t.Fatalf("\t%s\tRegister should return the new id -- %v %v", failure, id, err)
+	}
+
+	tokens, err := client.Signin(ctx, "bashar_123", "bb123123")
+	if err != nil || tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.SessionID == "" {
+		t.Fatalf("\t%s\tSignin should return the tokens -- %v %v", failure, tokens, err)
+	}
+
+	claims, err := client.Validate(ctx, tokens.AccessToken)
+	if err != nil || claims.ID != 1 || claims.SessionID != tokens.SessionID {
+		t.Fatalf("\t%s\tValidate should return the claims -- %v %v", failure, claims, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testErrors(t *testing.T) {
+	client := newClient()
+	ctx := context.Background()
+	_, err := client.Register(ctx, entities.User{Username: "bashar_123", Password: "bb123123"})
+	if err != nil {
+		t.Fatalf("\t%s\tRegister should not return any error -- %v", failure, err)
+	}
+
+	data := []struct {
+		call func() error
+		code string
+	}{
+		{call: func() error {
+			_, err := client.Register(ctx, entities.User{Username: "bashar_123", Password: "bb123123"})
+			return err
+		}, code: entities.CodeAlreadyExists},
+		{call: func() error {
+			_, err := client.Signin(ctx, "bashar_123", "wrong")
+			return err
+		}, code: entities.CodeInvalidCredentials},
+		{call: func() error {
+			_, err := client.Validate(ctx, "not a token")
+			return err
+		}, code: entities.CodeTokenInvalid},
+		{call: func() error {
+			_, err := NewAuthClient(nil, nil, nil).Validate(ctx, "token")
+			return err
+		}, code: entities.CodeInternal},
+	}
+
+	for i := range data {
+		coded, ok := data[i].call().(*entities.Error)
+		if !ok || coded.Code != data[i].code {
+			t.Fatalf("\t%s\tdata[%v] error code should be %s -- %v", failure, i, data[i].code, coded)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testContext(t *testing.T) {
+	client := newClient()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.Register(cancelled, entities.User{Username: "bashar_123", Password: "bb123123"})
+	if entities.ToError(err).Code != entities.CodeCancelled {
+		t.Fatalf("\t%s\terror code should be cancelled -- %v", failure, err)
+	}
+
+	// nobody reads this mailbox, so the call waits until the deadline
+	stuck := NewAuthClient(nil, nil, make(chan nanos.Message))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = stuck.Validate(ctx, "token")
+	if entities.ToError(err).Code != entities.CodeDeadlineExceeded || time.Since(start) > time.Second {
+		t.Fatalf("\t%s\terror code should be deadline_exceeded -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,1584 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: auth.proto
+
+// Package auth.v1 exposes the auth nanos to other services.
+// The user and session calls act on the user of the access token sent in the
+// "authorization: Bearer <token>" metadata, the admin calls need its "admin" role.
+
+package authGRPC
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	empty "github.com/golang/protobuf/ptypes/empty"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type User struct {
+	Id                   int64                `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name                 string               `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Username             string               `protobuf:"bytes,3,opt,name=username,proto3" json:"username,omitempty"`
+	Email                string               `protobuf:"bytes,4,opt,name=email,proto3" json:"email,omitempty"`
+	Phone                string               `protobuf:"bytes,5,opt,name=phone,proto3" json:"phone,omitempty"`
+	Roles                []string             `protobuf:"bytes,6,rep,name=roles,proto3" json:"roles,omitempty"`
+	Status               string               `protobuf:"bytes,7,opt,name=status,proto3" json:"status,omitempty"`
+	EmailVerified        bool                 `protobuf:"varint,8,opt,name=email_verified,json=emailVerified,proto3" json:"email_verified,omitempty"`
+	PhoneVerified        bool                 `protobuf:"varint,9,opt,name=phone_verified,json=phoneVerified,proto3" json:"phone_verified,omitempty"`
+	CreatedAt            *timestamp.Timestamp `protobuf:"bytes,10,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *User) Reset()         { *m = User{} }
+func (m *User) String() string { return proto.CompactTextString(m) }
+func (*User) ProtoMessage()    {}
+func (*User) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{0}
+}
+
+func (m *User) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_User.Unmarshal(m, b)
+}
+func (m *User) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_User.Marshal(b, m, deterministic)
+}
+func (m *User) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_User.Merge(m, src)
+}
+func (m *User) XXX_Size() int {
+	return xxx_messageInfo_User.Size(m)
+}
+func (m *User) XXX_DiscardUnknown() {
+	xxx_messageInfo_User.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_User proto.InternalMessageInfo
+
+func (m *User) GetId() int64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *User) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *User) GetUsername() string {
+	if m != nil {
+		return m.Username
+	}
+	return ""
+}
+
+func (m *User) GetEmail() string {
+	if m != nil {
+		return m.Email
+	}
+	return ""
+}
+
+func (m *User) GetPhone() string {
+	if m != nil {
+		return m.Phone
+	}
+	return ""
+}
+
+func (m *User) GetRoles() []string {
+	if m != nil {
+		return m.Roles
+	}
+	return nil
+}
+
+func (m *User) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *User) GetEmailVerified() bool {
+	if m != nil {
+		return m.EmailVerified
+	}
+	return false
+}
+
+func (m *User) GetPhoneVerified() bool {
+	if m != nil {
+		return m.PhoneVerified
+	}
+	return false
+}
+
+func (m *User) GetCreatedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+type RegisterRequest struct {
+	Name     string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Username string `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	Password string `protobuf:"bytes,3,opt,name=password,proto3" json:"password,omitempty"`
+	Email    string `protobuf:"bytes,4,opt,name=email,proto3" json:"email,omitempty"`
+	Phone    string `protobuf:"bytes,5,opt,name=phone,proto3" json:"phone,omitempty"`
+	// source identifies the caller for rate limiting, the peer address is used
+	// instead unless the server trusts its callers
+	Source               string   `protobuf:"bytes,6,opt,name=source,proto3" json:"source,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RegisterRequest) Reset()         { *m = RegisterRequest{} }
+func (m *RegisterRequest) String() string { return proto.CompactTextString(m) }
+func (*RegisterRequest) ProtoMessage()    {}
+func (*RegisterRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{1}
+}
+
+func (m *RegisterRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RegisterRequest.Unmarshal(m, b)
+}
+func (m *RegisterRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RegisterRequest.Marshal(b, m, deterministic)
+}
+func (m *RegisterRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RegisterRequest.Merge(m, src)
+}
+func (m *RegisterRequest) XXX_Size() int {
+	return xxx_messageInfo_RegisterRequest.Size(m)
+}
+func (m *RegisterRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RegisterRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RegisterRequest proto.InternalMessageInfo
+
+func (m *RegisterRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetUsername() string {
+	if m != nil {
+		return m.Username
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetPassword() string {
+	if m != nil {
+		return m.Password
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetEmail() string {
+	if m != nil {
+		return m.Email
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetPhone() string {
+	if m != nil {
+		return m.Phone
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetSource() string {
+	if m != nil {
+		return m.Source
+	}
+	return ""
+}
+
+// RegisterResponse id is 0 when registration runs in silent mode
+type RegisterResponse struct {
+	Id                   int64    `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RegisterResponse) Reset()         { *m = RegisterResponse{} }
+func (m *RegisterResponse) String() string { return proto.CompactTextString(m) }
+func (*RegisterResponse) ProtoMessage()    {}
+func (*RegisterResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{2}
+}
+
+func (m *RegisterResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RegisterResponse.Unmarshal(m, b)
+}
+func (m *RegisterResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RegisterResponse.Marshal(b, m, deterministic)
+}
+func (m *RegisterResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RegisterResponse.Merge(m, src)
+}
+func (m *RegisterResponse) XXX_Size() int {
+	return xxx_messageInfo_RegisterResponse.Size(m)
+}
+func (m *RegisterResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RegisterResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RegisterResponse proto.InternalMessageInfo
+
+func (m *RegisterResponse) GetId() int64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+type SigninRequest struct {
+	// identifier is the username, email or phone
+	Identifier string `protobuf:"bytes,1,opt,name=identifier,proto3" json:"identifier,omitempty"`
+	Password   string `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	// source and ip are replaced by the peer address unless the server trusts its callers
+	Source               string   `protobuf:"bytes,3,opt,name=source,proto3" json:"source,omitempty"`
+	UserAgent            string   `protobuf:"bytes,4,opt,name=user_agent,json=userAgent,proto3" json:"user_agent,omitempty"`
+	Ip                   string   `protobuf:"bytes,5,opt,name=ip,proto3" json:"ip,omitempty"`
+	DeviceId             string   `protobuf:"bytes,6,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	StepUpChallenge      string   `protobuf:"bytes,7,opt,name=step_up_challenge,json=stepUpChallenge,proto3" json:"step_up_challenge,omitempty"`
+	StepUpCode           string   `protobuf:"bytes,8,opt,name=step_up_code,json=stepUpCode,proto3" json:"step_up_code,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SigninRequest) Reset()         { *m = SigninRequest{} }
+func (m *SigninRequest) String() string { return proto.CompactTextString(m) }
+func (*SigninRequest) ProtoMessage()    {}
+func (*SigninRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{3}
+}
+
+func (m *SigninRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SigninRequest.Unmarshal(m, b)
+}
+func (m *SigninRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SigninRequest.Marshal(b, m, deterministic)
+}
+func (m *SigninRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SigninRequest.Merge(m, src)
+}
+func (m *SigninRequest) XXX_Size() int {
+	return xxx_messageInfo_SigninRequest.Size(m)
+}
+func (m *SigninRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SigninRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SigninRequest proto.InternalMessageInfo
+
+func (m *SigninRequest) GetIdentifier() string {
+	if m != nil {
+		return m.Identifier
+	}
+	return ""
+}
+
+func (m *SigninRequest) GetPassword() string {
+	if m != nil {
+		return m.Password
+	}
+	return ""
+}
+
+func (m *SigninRequest) GetSource() string {
+	if m != nil {
+		return m.Source
+	}
+	return ""
+}
+
+func (m *SigninRequest) GetUserAgent() string {
+	if m != nil {
+		return m.UserAgent
+	}
+	return ""
+}
+
+func (m *SigninRequest) GetIp() string {
+	if m != nil {
+		return m.Ip
+	}
+	return ""
+}
+
+func (m *SigninRequest) GetDeviceId() string {
+	if m != nil {
+		return m.DeviceId
+	}
+	return ""
+}
+
+func (m *SigninRequest) GetStepUpChallenge() string {
+	if m != nil {
+		return m.StepUpChallenge
+	}
+	return ""
+}
+
+func (m *SigninRequest) GetStepUpCode() string {
+	if m != nil {
+		return m.StepUpCode
+	}
+	return ""
+}
+
+type Tokens struct {
+	AccessToken          string   `protobuf:"bytes,1,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
+	RefreshToken         string   `protobuf:"bytes,2,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
+	SessionId            string   `protobuf:"bytes,3,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Tokens) Reset()         { *m = Tokens{} }
+func (m *Tokens) String() string { return proto.CompactTextString(m) }
+func (*Tokens) ProtoMessage()    {}
+func (*Tokens) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{4}
+}
+
+func (m *Tokens) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Tokens.Unmarshal(m, b)
+}
+func (m *Tokens) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Tokens.Marshal(b, m, deterministic)
+}
+func (m *Tokens) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Tokens.Merge(m, src)
+}
+func (m *Tokens) XXX_Size() int {
+	return xxx_messageInfo_Tokens.Size(m)
+}
+func (m *Tokens) XXX_DiscardUnknown() {
+	xxx_messageInfo_Tokens.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Tokens proto.InternalMessageInfo
+
+func (m *Tokens) GetAccessToken() string {
+	if m != nil {
+		return m.AccessToken
+	}
+	return ""
+}
+
+func (m *Tokens) GetRefreshToken() string {
+	if m != nil {
+		return m.RefreshToken
+	}
+	return ""
+}
+
+func (m *Tokens) GetSessionId() string {
+	if m != nil {
+		return m.SessionId
+	}
+	return ""
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken         string   `protobuf:"bytes,1,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RefreshTokenRequest) Reset()         { *m = RefreshTokenRequest{} }
+func (m *RefreshTokenRequest) String() string { return proto.CompactTextString(m) }
+func (*RefreshTokenRequest) ProtoMessage()    {}
+func (*RefreshTokenRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{5}
+}
+
+func (m *RefreshTokenRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RefreshTokenRequest.Unmarshal(m, b)
+}
+func (m *RefreshTokenRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RefreshTokenRequest.Marshal(b, m, deterministic)
+}
+func (m *RefreshTokenRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RefreshTokenRequest.Merge(m, src)
+}
+func (m *RefreshTokenRequest) XXX_Size() int {
+	return xxx_messageInfo_RefreshTokenRequest.Size(m)
+}
+func (m *RefreshTokenRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RefreshTokenRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RefreshTokenRequest proto.InternalMessageInfo
+
+func (m *RefreshTokenRequest) GetRefreshToken() string {
+	if m != nil {
+		return m.RefreshToken
+	}
+	return ""
+}
+
+type ValidateRequest struct {
+	Token                string   `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ValidateRequest) Reset()         { *m = ValidateRequest{} }
+func (m *ValidateRequest) String() string { return proto.CompactTextString(m) }
+func (*ValidateRequest) ProtoMessage()    {}
+func (*ValidateRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{6}
+}
+
+func (m *ValidateRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ValidateRequest.Unmarshal(m, b)
+}
+func (m *ValidateRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ValidateRequest.Marshal(b, m, deterministic)
+}
+func (m *ValidateRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ValidateRequest.Merge(m, src)
+}
+func (m *ValidateRequest) XXX_Size() int {
+	return xxx_messageInfo_ValidateRequest.Size(m)
+}
+func (m *ValidateRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ValidateRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ValidateRequest proto.InternalMessageInfo
+
+func (m *ValidateRequest) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+type Claims struct {
+	Id                   int64                `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Roles                []string             `protobuf:"bytes,2,rep,name=roles,proto3" json:"roles,omitempty"`
+	SessionId            string               `protobuf:"bytes,3,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	ExpiresAt            *timestamp.Timestamp `protobuf:"bytes,4,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Claims) Reset()         { *m = Claims{} }
+func (m *Claims) String() string { return proto.CompactTextString(m) }
+func (*Claims) ProtoMessage()    {}
+func (*Claims) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{7}
+}
+
+func (m *Claims) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Claims.Unmarshal(m, b)
+}
+func (m *Claims) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Claims.Marshal(b, m, deterministic)
+}
+func (m *Claims) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Claims.Merge(m, src)
+}
+func (m *Claims) XXX_Size() int {
+	return xxx_messageInfo_Claims.Size(m)
+}
+func (m *Claims) XXX_DiscardUnknown() {
+	xxx_messageInfo_Claims.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Claims proto.InternalMessageInfo
+
+func (m *Claims) GetId() int64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *Claims) GetRoles() []string {
+	if m != nil {
+		return m.Roles
+	}
+	return nil
+}
+
+func (m *Claims) GetSessionId() string {
+	if m != nil {
+		return m.SessionId
+	}
+	return ""
+}
+
+func (m *Claims) GetExpiresAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return nil
+}
+
+// UpdateMeRequest fields left unset are not changed
+type UpdateMeRequest struct {
+	Name                 *wrappers.StringValue `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Username             *wrappers.StringValue `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	Email                *wrappers.StringValue `protobuf:"bytes,3,opt,name=email,proto3" json:"email,omitempty"`
+	Phone                *wrappers.StringValue `protobuf:"bytes,4,opt,name=phone,proto3" json:"phone,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
+	XXX_unrecognized     []byte                `json:"-"`
+	XXX_sizecache        int32                 `json:"-"`
+}
+
+func (m *UpdateMeRequest) Reset()         { *m = UpdateMeRequest{} }
+func (m *UpdateMeRequest) String() string { return proto.CompactTextString(m) }
+func (*UpdateMeRequest) ProtoMessage()    {}
+func (*UpdateMeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{8}
+}
+
+func (m *UpdateMeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UpdateMeRequest.Unmarshal(m, b)
+}
+func (m *UpdateMeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UpdateMeRequest.Marshal(b, m, deterministic)
+}
+func (m *UpdateMeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UpdateMeRequest.Merge(m, src)
+}
+func (m *UpdateMeRequest) XXX_Size() int {
+	return xxx_messageInfo_UpdateMeRequest.Size(m)
+}
+func (m *UpdateMeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UpdateMeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UpdateMeRequest proto.InternalMessageInfo
+
+func (m *UpdateMeRequest) GetName() *wrappers.StringValue {
+	if m != nil {
+		return m.Name
+	}
+	return nil
+}
+
+func (m *UpdateMeRequest) GetUsername() *wrappers.StringValue {
+	if m != nil {
+		return m.Username
+	}
+	return nil
+}
+
+func (m *UpdateMeRequest) GetEmail() *wrappers.StringValue {
+	if m != nil {
+		return m.Email
+	}
+	return nil
+}
+
+func (m *UpdateMeRequest) GetPhone() *wrappers.StringValue {
+	if m != nil {
+		return m.Phone
+	}
+	return nil
+}
+
+type Session struct {
+	Id         string               `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	CreatedAt  *timestamp.Timestamp `protobuf:"bytes,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	LastUsedAt *timestamp.Timestamp `protobuf:"bytes,3,opt,name=last_used_at,json=lastUsedAt,proto3" json:"last_used_at,omitempty"`
+	UserAgent  string               `protobuf:"bytes,4,opt,name=user_agent,json=userAgent,proto3" json:"user_agent,omitempty"`
+	Ip         string               `protobuf:"bytes,5,opt,name=ip,proto3" json:"ip,omitempty"`
+	// current is true for the session of the token of the call
+	Current              bool     `protobuf:"varint,6,opt,name=current,proto3" json:"current,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Session) Reset()         { *m = Session{} }
+func (m *Session) String() string { return proto.CompactTextString(m) }
+func (*Session) ProtoMessage()    {}
+func (*Session) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{9}
+}
+
+func (m *Session) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Session.Unmarshal(m, b)
+}
+func (m *Session) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Session.Marshal(b, m, deterministic)
+}
+func (m *Session) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Session.Merge(m, src)
+}
+func (m *Session) XXX_Size() int {
+	return xxx_messageInfo_Session.Size(m)
+}
+func (m *Session) XXX_DiscardUnknown() {
+	xxx_messageInfo_Session.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Session proto.InternalMessageInfo
+
+func (m *Session) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Session) GetCreatedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+func (m *Session) GetLastUsedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.LastUsedAt
+	}
+	return nil
+}
+
+func (m *Session) GetUserAgent() string {
+	if m != nil {
+		return m.UserAgent
+	}
+	return ""
+}
+
+func (m *Session) GetIp() string {
+	if m != nil {
+		return m.Ip
+	}
+	return ""
+}
+
+func (m *Session) GetCurrent() bool {
+	if m != nil {
+		return m.Current
+	}
+	return false
+}
+
+type ListSessionsResponse struct {
+	Sessions             []*Session `protobuf:"bytes,1,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *ListSessionsResponse) Reset()         { *m = ListSessionsResponse{} }
+func (m *ListSessionsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListSessionsResponse) ProtoMessage()    {}
+func (*ListSessionsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{10}
+}
+
+func (m *ListSessionsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListSessionsResponse.Unmarshal(m, b)
+}
+func (m *ListSessionsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListSessionsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListSessionsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListSessionsResponse.Merge(m, src)
+}
+func (m *ListSessionsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListSessionsResponse.Size(m)
+}
+func (m *ListSessionsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListSessionsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListSessionsResponse proto.InternalMessageInfo
+
+func (m *ListSessionsResponse) GetSessions() []*Session {
+	if m != nil {
+		return m.Sessions
+	}
+	return nil
+}
+
+type RevokeSessionRequest struct {
+	SessionId            string   `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RevokeSessionRequest) Reset()         { *m = RevokeSessionRequest{} }
+func (m *RevokeSessionRequest) String() string { return proto.CompactTextString(m) }
+func (*RevokeSessionRequest) ProtoMessage()    {}
+func (*RevokeSessionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{11}
+}
+
+func (m *RevokeSessionRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RevokeSessionRequest.Unmarshal(m, b)
+}
+func (m *RevokeSessionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RevokeSessionRequest.Marshal(b, m, deterministic)
+}
+func (m *RevokeSessionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RevokeSessionRequest.Merge(m, src)
+}
+func (m *RevokeSessionRequest) XXX_Size() int {
+	return xxx_messageInfo_RevokeSessionRequest.Size(m)
+}
+func (m *RevokeSessionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RevokeSessionRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RevokeSessionRequest proto.InternalMessageInfo
+
+func (m *RevokeSessionRequest) GetSessionId() string {
+	if m != nil {
+		return m.SessionId
+	}
+	return ""
+}
+
+type ListUsersRequest struct {
+	Role   string `protobuf:"bytes,1,opt,name=role,proto3" json:"role,omitempty"`
+	Status string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Search string `protobuf:"bytes,3,opt,name=search,proto3" json:"search,omitempty"`
+	// sort_by is one of id (default), username, email, created_at
+	SortBy               string   `protobuf:"bytes,4,opt,name=sort_by,json=sortBy,proto3" json:"sort_by,omitempty"`
+	Descending           bool     `protobuf:"varint,5,opt,name=descending,proto3" json:"descending,omitempty"`
+	Limit                int32    `protobuf:"varint,6,opt,name=limit,proto3" json:"limit,omitempty"`
+	Cursor               string   `protobuf:"bytes,7,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListUsersRequest) Reset()         { *m = ListUsersRequest{} }
+func (m *ListUsersRequest) String() string { return proto.CompactTextString(m) }
+func (*ListUsersRequest) ProtoMessage()    {}
+func (*ListUsersRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{12}
+}
+
+func (m *ListUsersRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListUsersRequest.Unmarshal(m, b)
+}
+func (m *ListUsersRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListUsersRequest.Marshal(b, m, deterministic)
+}
+func (m *ListUsersRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListUsersRequest.Merge(m, src)
+}
+func (m *ListUsersRequest) XXX_Size() int {
+	return xxx_messageInfo_ListUsersRequest.Size(m)
+}
+func (m *ListUsersRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListUsersRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListUsersRequest proto.InternalMessageInfo
+
+func (m *ListUsersRequest) GetRole() string {
+	if m != nil {
+		return m.Role
+	}
+	return ""
+}
+
+func (m *ListUsersRequest) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *ListUsersRequest) GetSearch() string {
+	if m != nil {
+		return m.Search
+	}
+	return ""
+}
+
+func (m *ListUsersRequest) GetSortBy() string {
+	if m != nil {
+		return m.SortBy
+	}
+	return ""
+}
+
+func (m *ListUsersRequest) GetDescending() bool {
+	if m != nil {
+		return m.Descending
+	}
+	return false
+}
+
+func (m *ListUsersRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+func (m *ListUsersRequest) GetCursor() string {
+	if m != nil {
+		return m.Cursor
+	}
+	return ""
+}
+
+type ListUsersResponse struct {
+	Users                []*User  `protobuf:"bytes,1,rep,name=users,proto3" json:"users,omitempty"`
+	NextCursor           string   `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListUsersResponse) Reset()         { *m = ListUsersResponse{} }
+func (m *ListUsersResponse) String() string { return proto.CompactTextString(m) }
+func (*ListUsersResponse) ProtoMessage()    {}
+func (*ListUsersResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{13}
+}
+
+func (m *ListUsersResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListUsersResponse.Unmarshal(m, b)
+}
+func (m *ListUsersResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListUsersResponse.Marshal(b, m, deterministic)
+}
+func (m *ListUsersResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListUsersResponse.Merge(m, src)
+}
+func (m *ListUsersResponse) XXX_Size() int {
+	return xxx_messageInfo_ListUsersResponse.Size(m)
+}
+func (m *ListUsersResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListUsersResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListUsersResponse proto.InternalMessageInfo
+
+func (m *ListUsersResponse) GetUsers() []*User {
+	if m != nil {
+		return m.Users
+	}
+	return nil
+}
+
+func (m *ListUsersResponse) GetNextCursor() string {
+	if m != nil {
+		return m.NextCursor
+	}
+	return ""
+}
+
+type ChangeUserStatusRequest struct {
+	UserId int64 `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// status is active, suspended or disabled
+	Status string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	// until is required when suspending
+	Until                *timestamp.Timestamp `protobuf:"bytes,3,opt,name=until,proto3" json:"until,omitempty"`
+	Reason               string               `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *ChangeUserStatusRequest) Reset()         { *m = ChangeUserStatusRequest{} }
+func (m *ChangeUserStatusRequest) String() string { return proto.CompactTextString(m) }
+func (*ChangeUserStatusRequest) ProtoMessage()    {}
+func (*ChangeUserStatusRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{14}
+}
+
+func (m *ChangeUserStatusRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ChangeUserStatusRequest.Unmarshal(m, b)
+}
+func (m *ChangeUserStatusRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ChangeUserStatusRequest.Marshal(b, m, deterministic)
+}
+func (m *ChangeUserStatusRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ChangeUserStatusRequest.Merge(m, src)
+}
+func (m *ChangeUserStatusRequest) XXX_Size() int {
+	return xxx_messageInfo_ChangeUserStatusRequest.Size(m)
+}
+func (m *ChangeUserStatusRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ChangeUserStatusRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ChangeUserStatusRequest proto.InternalMessageInfo
+
+func (m *ChangeUserStatusRequest) GetUserId() int64 {
+	if m != nil {
+		return m.UserId
+	}
+	return 0
+}
+
+func (m *ChangeUserStatusRequest) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *ChangeUserStatusRequest) GetUntil() *timestamp.Timestamp {
+	if m != nil {
+		return m.Until
+	}
+	return nil
+}
+
+func (m *ChangeUserStatusRequest) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+// ErrorDetail is attached to the status of failed calls, code is the stable error code
+// of the nanos, e.g. already_exists, and field the invalid or used input
+type ErrorDetail struct {
+	Code  string `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Field string `protobuf:"bytes,2,opt,name=field,proto3" json:"field,omitempty"`
+	// challenge and expires_at are set for step_up_required
+	Challenge            string               `protobuf:"bytes,3,opt,name=challenge,proto3" json:"challenge,omitempty"`
+	ExpiresAt            *timestamp.Timestamp `protobuf:"bytes,4,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *ErrorDetail) Reset()         { *m = ErrorDetail{} }
+func (m *ErrorDetail) String() string { return proto.CompactTextString(m) }
+func (*ErrorDetail) ProtoMessage()    {}
+func (*ErrorDetail) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8bbd6f3875b0e874, []int{15}
+}
+
+func (m *ErrorDetail) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ErrorDetail.Unmarshal(m, b)
+}
+func (m *ErrorDetail) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ErrorDetail.Marshal(b, m, deterministic)
+}
+func (m *ErrorDetail) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ErrorDetail.Merge(m, src)
+}
+func (m *ErrorDetail) XXX_Size() int {
+	return xxx_messageInfo_ErrorDetail.Size(m)
+}
+func (m *ErrorDetail) XXX_DiscardUnknown() {
+	xxx_messageInfo_ErrorDetail.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ErrorDetail proto.InternalMessageInfo
+
+func (m *ErrorDetail) GetCode() string {
+	if m != nil {
+		return m.Code
+	}
+	return ""
+}
+
+func (m *ErrorDetail) GetField() string {
+	if m != nil {
+		return m.Field
+	}
+	return ""
+}
+
+func (m *ErrorDetail) GetChallenge() string {
+	if m != nil {
+		return m.Challenge
+	}
+	return ""
+}
+
+func (m *ErrorDetail) GetExpiresAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*User)(nil), "auth.v1.User")
+	proto.RegisterType((*RegisterRequest)(nil), "auth.v1.RegisterRequest")
+	proto.RegisterType((*RegisterResponse)(nil), "auth.v1.RegisterResponse")
+	proto.RegisterType((*SigninRequest)(nil), "auth.v1.SigninRequest")
+	proto.RegisterType((*Tokens)(nil), "auth.v1.Tokens")
+	proto.RegisterType((*RefreshTokenRequest)(nil), "auth.v1.RefreshTokenRequest")
+	proto.RegisterType((*ValidateRequest)(nil), "auth.v1.ValidateRequest")
+	proto.RegisterType((*Claims)(nil), "auth.v1.Claims")
+	proto.RegisterType((*UpdateMeRequest)(nil), "auth.v1.UpdateMeRequest")
+	proto.RegisterType((*Session)(nil), "auth.v1.Session")
+	proto.RegisterType((*ListSessionsResponse)(nil), "auth.v1.ListSessionsResponse")
+	proto.RegisterType((*RevokeSessionRequest)(nil), "auth.v1.RevokeSessionRequest")
+	proto.RegisterType((*ListUsersRequest)(nil), "auth.v1.ListUsersRequest")
+	proto.RegisterType((*ListUsersResponse)(nil), "auth.v1.ListUsersResponse")
+	proto.RegisterType((*ChangeUserStatusRequest)(nil), "auth.v1.ChangeUserStatusRequest")
+	proto.RegisterType((*ErrorDetail)(nil), "auth.v1.ErrorDetail")
+}
+
+func init() { proto.RegisterFile("auth.proto", fileDescriptor_8bbd6f3875b0e874) }
+
+var fileDescriptor_8bbd6f3875b0e874 = []byte{
+	// 1169 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x56, 0xcf, 0x6e, 0xdb, 0xc6,
+	0x13, 0x06, 0xf5, 0x5f, 0x23, 0x39, 0x76, 0xf6, 0x67, 0x24, 0x8c, 0x12, 0x27, 0xfa, 0x31, 0x28,
+	0x6a, 0x14, 0x8d, 0x9c, 0x28, 0x4d, 0xd1, 0xa6, 0x2d, 0x0a, 0xc7, 0x49, 0x03, 0x03, 0x09, 0x50,
+	0xd0, 0xb1, 0x81, 0xf6, 0x22, 0xac, 0xc5, 0xb1, 0xb4, 0x08, 0x45, 0xb2, 0xbb, 0x4b, 0x27, 0x7e,
+	0x83, 0x1e, 0x7b, 0xe8, 0x0b, 0xf4, 0xd8, 0x6b, 0xef, 0x7d, 0x92, 0x9e, 0xfb, 0x18, 0x05, 0x8a,
+	0xfd, 0x43, 0x8a, 0xa2, 0xac, 0xd8, 0x46, 0x6f, 0x9c, 0x6f, 0xbf, 0xd9, 0x9d, 0xf9, 0x76, 0x67,
+	0x86, 0x00, 0x34, 0x95, 0xd3, 0x41, 0xc2, 0x63, 0x19, 0x93, 0xa6, 0xfe, 0x3e, 0x7d, 0xd4, 0xbb,
+	0x3d, 0x89, 0xe3, 0x49, 0x88, 0x3b, 0x1a, 0x3e, 0x4e, 0x4f, 0x76, 0x70, 0x96, 0xc8, 0x33, 0xc3,
+	0xea, 0xdd, 0x2b, 0x2f, 0x4a, 0x36, 0x43, 0x21, 0xe9, 0x2c, 0xb1, 0x84, 0xbb, 0x65, 0xc2, 0x3b,
+	0x4e, 0x93, 0x04, 0xb9, 0x30, 0xeb, 0xde, 0xef, 0x15, 0xa8, 0x1d, 0x0a, 0xe4, 0xe4, 0x1a, 0x54,
+	0x58, 0xe0, 0x3a, 0x7d, 0x67, 0xbb, 0xea, 0x57, 0x58, 0x40, 0x08, 0xd4, 0x22, 0x3a, 0x43, 0xb7,
+	0xd2, 0x77, 0xb6, 0xdb, 0xbe, 0xfe, 0x26, 0x3d, 0x68, 0xa5, 0x02, 0xb9, 0xc6, 0xab, 0x1a, 0xcf,
+	0x6d, 0xb2, 0x09, 0x75, 0x9c, 0x51, 0x16, 0xba, 0x35, 0xbd, 0x60, 0x0c, 0x85, 0x26, 0xd3, 0x38,
+	0x42, 0xb7, 0x6e, 0x50, 0x6d, 0x28, 0x94, 0xc7, 0x21, 0x0a, 0xb7, 0xd1, 0xaf, 0x2a, 0x54, 0x1b,
+	0xe4, 0x06, 0x34, 0x84, 0xa4, 0x32, 0x15, 0x6e, 0x53, 0x93, 0xad, 0x45, 0x3e, 0x82, 0x6b, 0x7a,
+	0xb3, 0xd1, 0x29, 0x72, 0x76, 0xc2, 0x30, 0x70, 0x5b, 0x7d, 0x67, 0xbb, 0xe5, 0xaf, 0x69, 0xf4,
+	0xc8, 0x82, 0x8a, 0xa6, 0x77, 0x9f, 0xd3, 0xda, 0x86, 0xa6, 0xd1, 0x9c, 0xf6, 0x25, 0xc0, 0x98,
+	0x23, 0x95, 0x18, 0x8c, 0xa8, 0x74, 0xa1, 0xef, 0x6c, 0x77, 0x86, 0xbd, 0x81, 0x51, 0x69, 0x90,
+	0xa9, 0x34, 0x78, 0x93, 0xc9, 0xe8, 0xb7, 0x2d, 0x7b, 0x57, 0x7a, 0xbf, 0x39, 0xb0, 0xee, 0xe3,
+	0x84, 0x09, 0x89, 0xdc, 0xc7, 0x9f, 0x52, 0x14, 0x32, 0x97, 0xc9, 0x59, 0x21, 0x53, 0xa5, 0x24,
+	0x53, 0x0f, 0x5a, 0x09, 0x15, 0xe2, 0x5d, 0xcc, 0x83, 0x4c, 0xc2, 0xcc, 0xbe, 0x92, 0x84, 0x4a,
+	0xac, 0x38, 0xe5, 0x63, 0x74, 0x1b, 0x56, 0x2c, 0x6d, 0x79, 0x1e, 0x6c, 0xcc, 0x43, 0x14, 0x49,
+	0x1c, 0x09, 0x2c, 0x5f, 0xad, 0xf7, 0x8f, 0x03, 0x6b, 0x07, 0x6c, 0x12, 0xb1, 0x28, 0xcb, 0xe2,
+	0x2e, 0x00, 0x0b, 0x30, 0x92, 0x4a, 0x22, 0x6e, 0x73, 0x29, 0x20, 0x0b, 0x51, 0x57, 0x4a, 0x51,
+	0xcf, 0x23, 0xa9, 0x16, 0x23, 0x21, 0x5b, 0x00, 0x2a, 0xeb, 0x11, 0x9d, 0x60, 0x24, 0x6d, 0x4a,
+	0x6d, 0x85, 0xec, 0x2a, 0x40, 0x07, 0x95, 0xd8, 0x9c, 0x2a, 0x2c, 0x21, 0xb7, 0xa1, 0x1d, 0xe0,
+	0x29, 0x1b, 0xe3, 0x88, 0x05, 0x36, 0xa7, 0x96, 0x01, 0xf6, 0x03, 0xf2, 0x09, 0x5c, 0x17, 0x12,
+	0x93, 0x51, 0x9a, 0x8c, 0xc6, 0x53, 0x1a, 0x86, 0x18, 0x4d, 0xd0, 0xbe, 0x92, 0x75, 0xb5, 0x70,
+	0x98, 0xec, 0x65, 0x30, 0xe9, 0x43, 0x37, 0xe7, 0xc6, 0x01, 0xea, 0xc7, 0xd2, 0xf6, 0xc1, 0xd2,
+	0xe2, 0x00, 0xbd, 0x18, 0x1a, 0x6f, 0xe2, 0xb7, 0x18, 0x09, 0xf2, 0x7f, 0xe8, 0xd2, 0xf1, 0x18,
+	0x85, 0x18, 0x49, 0x05, 0xd8, 0xcc, 0x3b, 0x06, 0xd3, 0x1c, 0x72, 0x1f, 0xd6, 0x38, 0x9e, 0x70,
+	0x14, 0x53, 0xcb, 0x31, 0xf9, 0x77, 0x2d, 0x68, 0x48, 0x5b, 0x00, 0x02, 0x85, 0x60, 0x71, 0xa4,
+	0xa2, 0x37, 0x3a, 0xb4, 0x2d, 0xb2, 0x1f, 0x78, 0x4f, 0xe1, 0x7f, 0x7e, 0x81, 0x9e, 0xa9, 0xbe,
+	0xb4, 0xb5, 0xb3, 0xbc, 0xb5, 0xf7, 0x31, 0xac, 0x1f, 0xd1, 0x90, 0x05, 0x54, 0x62, 0xe6, 0xb7,
+	0x09, 0xf5, 0x22, 0xdf, 0x18, 0xde, 0xcf, 0x0e, 0x34, 0xf6, 0x42, 0xca, 0x66, 0x62, 0xa9, 0x96,
+	0xf3, 0x7a, 0xab, 0x14, 0xeb, 0xed, 0xc3, 0x41, 0xab, 0x42, 0xc1, 0xf7, 0x09, 0xe3, 0x28, 0x46,
+	0xd4, 0xdc, 0xdf, 0x05, 0x85, 0x62, 0xd9, 0xbb, 0xd2, 0xfb, 0xdb, 0x81, 0xf5, 0xc3, 0x44, 0x85,
+	0xfc, 0x3a, 0x0f, 0xfa, 0x61, 0xa1, 0x50, 0x3a, 0xc3, 0x3b, 0x4b, 0x1b, 0x1d, 0x48, 0xce, 0xa2,
+	0xc9, 0x11, 0x0d, 0x53, 0xb4, 0x65, 0xf4, 0x45, 0xa9, 0x8c, 0x2e, 0xf2, 0x9a, 0x17, 0xd9, 0x30,
+	0x2b, 0xa4, 0xea, 0x25, 0xdc, 0x6c, 0x99, 0x0d, 0xb3, 0x32, 0xab, 0x5d, 0xc6, 0x47, 0x53, 0xbd,
+	0xbf, 0x1c, 0x68, 0x1e, 0x18, 0xc1, 0x0a, 0x9a, 0xb7, 0xb5, 0xe6, 0x8b, 0x7d, 0xa6, 0x72, 0x85,
+	0x3e, 0x43, 0xbe, 0x86, 0x6e, 0x48, 0x85, 0x1c, 0xa5, 0xc2, 0x38, 0x57, 0x2f, 0x74, 0x06, 0xc5,
+	0x3f, 0x14, 0xda, 0xfb, 0x8a, 0x75, 0xe7, 0x42, 0x73, 0x9c, 0x72, 0xae, 0xb8, 0x0d, 0xdd, 0x2f,
+	0x33, 0xd3, 0x7b, 0x0e, 0x9b, 0xaf, 0x98, 0x90, 0x36, 0x41, 0x91, 0xb7, 0x93, 0x4f, 0xa1, 0x65,
+	0x5f, 0x89, 0x70, 0x9d, 0x7e, 0x75, 0xbb, 0x33, 0xdc, 0x18, 0xd8, 0x61, 0x35, 0xb0, 0x64, 0x3f,
+	0x67, 0x78, 0x4f, 0x60, 0xd3, 0xc7, 0xd3, 0xf8, 0x2d, 0x66, 0x4b, 0xf6, 0x3d, 0x2c, 0xbe, 0x3e,
+	0xa7, 0x5c, 0x32, 0x7f, 0x3a, 0xb0, 0xa1, 0x4e, 0x57, 0xb3, 0x49, 0x14, 0x9a, 0xad, 0x7a, 0xba,
+	0x59, 0xb3, 0x55, 0xdf, 0x85, 0xa9, 0x51, 0x59, 0x98, 0x1a, 0x0a, 0x47, 0xca, 0xc7, 0xd3, 0xbc,
+	0x2d, 0x69, 0x8b, 0xdc, 0x84, 0xa6, 0x88, 0xb9, 0x1c, 0x1d, 0x9f, 0x59, 0x6d, 0x1a, 0xca, 0x7c,
+	0x76, 0xa6, 0x7a, 0x60, 0x80, 0x62, 0x8c, 0x51, 0xc0, 0xa2, 0x89, 0x16, 0xa8, 0xe5, 0x17, 0x10,
+	0x55, 0x44, 0x21, 0x9b, 0x31, 0x23, 0x53, 0xdd, 0x37, 0x86, 0x3a, 0x66, 0x9c, 0x72, 0x11, 0xf3,
+	0x6c, 0x68, 0x19, 0xcb, 0xfb, 0x01, 0xae, 0x17, 0xc2, 0xb7, 0xca, 0xdd, 0x87, 0xba, 0xba, 0x88,
+	0x4c, 0xb6, 0xb5, 0x5c, 0x36, 0x45, 0xf3, 0xcd, 0x1a, 0xb9, 0x07, 0x9d, 0x08, 0xdf, 0xcb, 0x91,
+	0xdd, 0xd6, 0x64, 0x05, 0x0a, 0xda, 0x33, 0x5b, 0xff, 0xea, 0xc0, 0xcd, 0xbd, 0x29, 0x8d, 0x26,
+	0xa8, 0xdc, 0x0e, 0x74, 0xba, 0x99, 0x42, 0x37, 0xa1, 0xa9, 0x2f, 0x3f, 0x2f, 0xff, 0x86, 0x32,
+	0xf7, 0x83, 0x95, 0x32, 0x3d, 0x84, 0x7a, 0x1a, 0x49, 0x16, 0x5e, 0xe2, 0x91, 0x19, 0xa2, 0xda,
+	0x89, 0x23, 0x15, 0x71, 0x94, 0xe9, 0x67, 0x2c, 0xef, 0x17, 0x07, 0x3a, 0x2f, 0x38, 0x8f, 0xf9,
+	0x73, 0x94, 0xaa, 0xa0, 0x08, 0xd4, 0x74, 0xff, 0xb5, 0x97, 0xa5, 0xbe, 0x95, 0x86, 0x27, 0x0c,
+	0xc3, 0x6c, 0x88, 0x18, 0x83, 0xdc, 0x81, 0xf6, 0xbc, 0xab, 0xdb, 0x3e, 0x94, 0x03, 0xff, 0xa1,
+	0x0f, 0x0d, 0xff, 0xa8, 0x43, 0x6d, 0x37, 0x95, 0x53, 0xf2, 0x2d, 0xb4, 0xb2, 0xa9, 0x48, 0xdc,
+	0x5c, 0xf5, 0xd2, 0x2c, 0xef, 0xdd, 0x3a, 0x67, 0xc5, 0xde, 0xdc, 0x23, 0x68, 0x98, 0x89, 0x49,
+	0x6e, 0xcc, 0xdf, 0x7a, 0x71, 0x84, 0xf6, 0xd6, 0x73, 0xdc, 0xce, 0x96, 0x6f, 0xa0, 0x5b, 0x6c,
+	0xfa, 0xe4, 0x4e, 0x61, 0xf7, 0xa5, 0x59, 0xb0, 0xec, 0xfe, 0x04, 0x5a, 0x59, 0xdf, 0x2f, 0x84,
+	0x5c, 0x1a, 0x05, 0x05, 0x37, 0xdb, 0xfa, 0x07, 0x50, 0x7f, 0x89, 0xf2, 0x35, 0x92, 0x1b, 0x4b,
+	0x12, 0xbd, 0x50, 0xff, 0x8d, 0xbd, 0xc5, 0x47, 0x47, 0x1e, 0x43, 0x2b, 0xeb, 0xd4, 0x85, 0x63,
+	0x4a, 0xcd, 0xbb, 0xec, 0xf4, 0x14, 0x5a, 0xcf, 0x31, 0x44, 0x89, 0x1f, 0x38, 0x67, 0x05, 0x4e,
+	0x5e, 0x40, 0xb7, 0xd8, 0x55, 0x56, 0xfa, 0x6f, 0xe5, 0x47, 0x9e, 0xdb, 0x84, 0xbe, 0x83, 0xb5,
+	0x85, 0xb6, 0x42, 0xb6, 0x0a, 0xf2, 0x2e, 0xb7, 0x9b, 0x95, 0xe1, 0x3c, 0x83, 0x76, 0x5e, 0xa7,
+	0xe4, 0xd6, 0xc2, 0x99, 0xc5, 0xd6, 0xd3, 0xeb, 0x9d, 0xb7, 0x64, 0x63, 0x79, 0x05, 0x1b, 0xe5,
+	0x7a, 0x24, 0xfd, 0xf9, 0xc5, 0x9c, 0x5f, 0xaa, 0xab, 0x22, 0x7a, 0xf6, 0xf9, 0x8f, 0x9f, 0x4d,
+	0x98, 0x9c, 0xa6, 0xc7, 0x83, 0x71, 0x3c, 0xdb, 0x39, 0xa6, 0x62, 0x4a, 0xf9, 0x03, 0x41, 0x43,
+	0x9c, 0xee, 0xa8, 0x2d, 0x1f, 0x44, 0x34, 0x8a, 0x85, 0xfe, 0x7c, 0xe9, 0x7f, 0xbf, 0xf7, 0x55,
+	0xf6, 0x71, 0xdc, 0xd0, 0xfb, 0x3c, 0xfe, 0x77, 0x00, 0xfb, 0x5a, 0x5d, 0xcd, 0x45, 0x0c, 0x00,
+	0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// AuthClient is the client API for Auth service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AuthClient interface {
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	Signin(ctx context.Context, in *SigninRequest, opts ...grpc.CallOption) (*Tokens, error)
+	RefreshToken(ctx context.Context, in *RefreshTokenRequest, opts ...grpc.CallOption) (*Tokens, error)
+	Validate(ctx context.Context, in *ValidateRequest, opts ...grpc.CallOption) (*Claims, error)
+	GetMe(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*User, error)
+	UpdateMe(ctx context.Context, in *UpdateMeRequest, opts ...grpc.CallOption) (*User, error)
+	DeleteMe(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*empty.Empty, error)
+	ListSessions(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*ListSessionsResponse, error)
+	RevokeSession(ctx context.Context, in *RevokeSessionRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+	ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (*ListUsersResponse, error)
+	ChangeUserStatus(ctx context.Context, in *ChangeUserStatusRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+}
+
+type authClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAuthClient(cc *grpc.ClientConn) AuthClient {
+	return &authClient{cc}
+}
+
+func (c *authClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, "/auth.v1.Auth/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) Signin(ctx context.Context, in *SigninRequest, opts ...grpc.CallOption) (*Tokens, error) {
+	out := new(Tokens)
+	err := c.cc.Invoke(ctx, "/auth.v1.Auth/Signin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) RefreshToken(ctx context.Context, in *RefreshTokenRequest, opts ...grpc.CallOption) (*Tokens, error) {
+	out := new(Tokens)
+	err := c.cc.Invoke(ctx, "/auth.v1.Auth/RefreshToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) Validate(ctx context.Context, in *ValidateRequest, opts ...grpc.CallOption) (*Claims, error) {
+	out := new(Claims)
+	err := c.cc.Invoke(ctx, "/auth.v1.Auth/Validate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) GetMe(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/auth.v1.Auth/GetMe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) UpdateMe(ctx context.Context, in *UpdateMeRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/auth.v1.Auth/UpdateMe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) DeleteMe(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*empty.Empty, error) {
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, "/auth.v1.Auth/DeleteMe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) ListSessions(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*ListSessionsResponse, error) {
+	out := new(ListSessionsResponse)
+	err := c.cc.Invoke(ctx, "/auth.v1.Auth/ListSessions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) RevokeSession(ctx context.Context, in *RevokeSessionRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, "/auth.v1.Auth/RevokeSession", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (*ListUsersResponse, error) {
+	out := new(ListUsersResponse)
+	err := c.cc.Invoke(ctx, "/auth.v1.Auth/ListUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) ChangeUserStatus(ctx context.Context, in *ChangeUserStatusRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, "/auth.v1.Auth/ChangeUserStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuthServer is the server API for Auth service.
+type AuthServer interface {
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	Signin(context.Context, *SigninRequest) (*Tokens, error)
+	RefreshToken(context.Context, *RefreshTokenRequest) (*Tokens, error)
+	Validate(context.Context, *ValidateRequest) (*Claims, error)
+	GetMe(context.Context, *empty.Empty) (*User, error)
+	UpdateMe(context.Context, *UpdateMeRequest) (*User, error)
+	DeleteMe(context.Context, *empty.Empty) (*empty.Empty, error)
+	ListSessions(context.Context, *empty.Empty) (*ListSessionsResponse, error)
+	RevokeSession(context.Context, *RevokeSessionRequest) (*empty.Empty, error)
+	ListUsers(context.Context, *ListUsersRequest) (*ListUsersResponse, error)
+	ChangeUserStatus(context.Context, *ChangeUserStatusRequest) (*empty.Empty, error)
+}
+
+// UnimplementedAuthServer can be embedded to have forward compatible implementations.
+type UnimplementedAuthServer struct {
+}
+
+func (*UnimplementedAuthServer) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (*UnimplementedAuthServer) Signin(ctx context.Context, req *SigninRequest) (*Tokens, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Signin not implemented")
+}
+func (*UnimplementedAuthServer) RefreshToken(ctx context.Context, req *RefreshTokenRequest) (*Tokens, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RefreshToken not implemented")
+}
+func (*UnimplementedAuthServer) Validate(ctx context.Context, req *ValidateRequest) (*Claims, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Validate not implemented")
+}
+func (*UnimplementedAuthServer) GetMe(ctx context.Context, req *empty.Empty) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMe not implemented")
+}
+func (*UnimplementedAuthServer) UpdateMe(ctx context.Context, req *UpdateMeRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateMe not implemented")
+}
+func (*UnimplementedAuthServer) DeleteMe(ctx context.Context, req *empty.Empty) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMe not implemented")
+}
+func (*UnimplementedAuthServer) ListSessions(ctx context.Context, req *empty.Empty) (*ListSessionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSessions not implemented")
+}
+func (*UnimplementedAuthServer) RevokeSession(ctx context.Context, req *RevokeSessionRequest) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeSession not implemented")
+}
+func (*UnimplementedAuthServer) ListUsers(ctx context.Context, req *ListUsersRequest) (*ListUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUsers not implemented")
+}
+func (*UnimplementedAuthServer) ChangeUserStatus(ctx context.Context, req *ChangeUserStatusRequest) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeUserStatus not implemented")
+}
+
+func RegisterAuthServer(s *grpc.Server, srv AuthServer) {
+	s.RegisterService(&_Auth_serviceDesc, srv)
+}
+
+func _Auth_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.v1.Auth/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_Signin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SigninRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).Signin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.v1.Auth/Signin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).Signin(ctx, req.(*SigninRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_RefreshToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).RefreshToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.v1.Auth/RefreshToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).RefreshToken(ctx, req.(*RefreshTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_Validate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).Validate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.v1.Auth/Validate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).Validate(ctx, req.(*ValidateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_GetMe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(empty.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).GetMe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.v1.Auth/GetMe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).GetMe(ctx, req.(*empty.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_UpdateMe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateMeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).UpdateMe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.v1.Auth/UpdateMe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).UpdateMe(ctx, req.(*UpdateMeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_DeleteMe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(empty.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).DeleteMe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.v1.Auth/DeleteMe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).DeleteMe(ctx, req.(*empty.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_ListSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(empty.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).ListSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.v1.Auth/ListSessions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).ListSessions(ctx, req.(*empty.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_RevokeSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).RevokeSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.v1.Auth/RevokeSession",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).RevokeSession(ctx, req.(*RevokeSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_ListUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).ListUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.v1.Auth/ListUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).ListUsers(ctx, req.(*ListUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_ChangeUserStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeUserStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).ChangeUserStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/auth.v1.Auth/ChangeUserStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).ChangeUserStatus(ctx, req.(*ChangeUserStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Auth_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "auth.v1.Auth",
+	HandlerType: (*AuthServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _Auth_Register_Handler,
+		},
+		{
+			MethodName: "Signin",
+			Handler:    _Auth_Signin_Handler,
+		},
+		{
+			MethodName: "RefreshToken",
+			Handler:    _Auth_RefreshToken_Handler,
+		},
+		{
+			MethodName: "Validate",
+			Handler:    _Auth_Validate_Handler,
+		},
+		{
+			MethodName: "GetMe",
+			Handler:    _Auth_GetMe_Handler,
+		},
+		{
+			MethodName: "UpdateMe",
+			Handler:    _Auth_UpdateMe_Handler,
+		},
+		{
+			MethodName: "DeleteMe",
+			Handler:    _Auth_DeleteMe_Handler,
+		},
+		{
+			MethodName: "ListSessions",
+			Handler:    _Auth_ListSessions_Handler,
+		},
+		{
+			MethodName: "RevokeSession",
+			Handler:    _Auth_RevokeSession_Handler,
+		},
+		{
+			MethodName: "ListUsers",
+			Handler:    _Auth_ListUsers_Handler,
+		},
+		{
+			MethodName: "ChangeUserStatus",
+			Handler:    _Auth_ChangeUserStatus_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "auth.proto",
+}
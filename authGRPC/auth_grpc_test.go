@@ -0,0 +1,380 @@
+package authGRPC
+
+import (
+	"context"
+	"database/sql"
+	"github.com/bashar-saleh/auth-nanos/authMiddleware"
+	"github.com/bashar-saleh/auth-nanos/changeUserStatus"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/deleteUser"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/getUser"
+	"github.com/bashar-saleh/auth-nanos/listSessions"
+	"github.com/bashar-saleh/auth-nanos/listUsers"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/refreshToken"
+	"github.com/bashar-saleh/auth-nanos/registerUser"
+	"github.com/bashar-saleh/auth-nanos/revokeSession"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/auth-nanos/updateUser"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"github.com/golang/protobuf/descriptor"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestAuthGRPC(t *testing.T) {
+	t.Run("Given a new user When register, signin and call with its tokens Then every call answers", testUserJourney)
+	t.Run("Given failing calls When call the server Then status errors carry their code and ErrorDetail", testErrors)
+	t.Run("Given an admin and a user When call the admin methods Then only the admin is served", testAdmin)
+	t.Run("Given interceptors with a role map When call Then claims are injected and roles enforced", testInterceptors)
+	t.Run("Given callers sending their own source and ip When register and signin Then only a trusting server keeps them", testCallerAddress)
+	t.Run("Given the generated bindings When read their descriptors Then the messages and the service are registered", testDescriptors)
+}
+
+func testCallerAddress(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}})
+	data := []struct {
+		options ServerOptions
+		source  string
+		ip      string
+		want    string
+	}{
+		{source: "forged", ip: "192.0.2.7", want: "10.0.0.1"},
+		{options: ServerOptions{TrustCaller: true}, source: "192.0.2.7", ip: "192.0.2.7", want: "192.0.2.7"},
+		{options: ServerOptions{TrustCaller: true}, want: "10.0.0.1"},
+	}
+
+	for i := range data {
+		register := make(chan nanos.Message, 1)
+		signin := make(chan nanos.Message, 1)
+		server := NewServer(Mailboxes{Register: register, Signin: signin}, data[i].options)
+		go func() { _, _ = server.Register(ctx, &RegisterRequest{Username: "bashar_123", Source: data[i].source}) }()
+		go func() {
+			_, _ = server.Signin(ctx, &SigninRequest{Identifier: "bashar_123", Source: data[i].source, Ip: data[i].ip})
+		}()
+
+		var registerReq registerUser.Request
+		msg := <-register
+		msg.ErrTo <- entities.NewError(entities.CodeInternal, "stop")
+		_ = messages.Decode(msg.Content, &registerReq)
+		var signinReq signinUser.Request
+		msg = <-signin
+		msg.ErrTo <- entities.NewError(entities.CodeInternal, "stop")
+		_ = messages.Decode(msg.Content, &signinReq)
+		if registerReq.Source != data[i].want || signinReq.Source != data[i].want || signinReq.IP != data[i].want {
+			t.Fatalf("\t%s\tdata[%v] source and ip should be %s -- %+v %+v", failure, i, data[i].want, registerReq, signinReq)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testDescriptors(t *testing.T) {
+	file, message := descriptor.ForMessage(&SigninRequest{})
+	if file.GetName() != "auth.proto" || file.GetPackage() != "auth.v1" || message.GetName() != "SigninRequest" {
+		t.Fatalf("\t%s\tthe descriptor of SigninRequest should be registered -- %v %v", failure, file.GetName(), message.GetName())
+	}
+	if proto.MessageType("auth.v1.User") == nil {
+		t.Fatalf("\t%s\tthe messages should be registered by their full name", failure)
+	}
+	if len(file.Service) != 1 || file.Service[0].GetName() != "Auth" || len(file.Service[0].Method) != len(_Auth_serviceDesc.Methods) {
+		t.Fatalf("\t%s\tthe descriptor should describe the Auth service", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+// newClient serves the nanos on test.db over an in-process listener and returns its client,
+// the interceptors of intercepted are installed on the server when set
+func newClient(t *testing.T, intercepted *InterceptorOptions) (AuthClient, *sql.DB, func()) {
+	db := datastores.SqliteConnection("test.db")
+	key := "secretKey"
+	mailboxes := Mailboxes{
+		Register:         registerUser.NewRegisterUserNanos(1, 10, db, nil, nil, nil, nil, nil, registerUser.Options{}),
+		Signin:           signinUser.NewSigninUserNanos(1, 10, db, key, 4, nil, nil, signinUser.Options{}),
+		RefreshToken:     refreshToken.NewRefreshTokenNanos(1, 10, db, key, 4, refreshToken.Options{}),
+		Validate:         validateJWT.NewValidateJWTNanos(1, 10, key, validateJWT.Options{DB: db}),
+		GetUser:          getUser.NewGetUserNanos(1, 10, db, getUser.Options{}),
+		UpdateUser:       updateUser.NewUpdateUserNanos(1, 10, db, nil, nil, nil, nil, updateUser.Options{}),
+		DeleteUser:       deleteUser.NewDeleteUserNanos(1, 10, db, time.Hour, deleteUser.Options{}),
+		ListSessions:     listSessions.NewListSessionsNanos(1, 10, db, listSessions.Options{}),
+		RevokeSession:    revokeSession.NewRevokeSessionNanos(1, 10, db, revokeSession.Options{}),
+		ListUsers:        listUsers.NewListUsersNanos(1, 10, db, listUsers.Options{}),
+		ChangeUserStatus: changeUserStatus.NewChangeUserStatusNanos(1, 10, db, changeUserStatus.Options{}),
+	}
+	var options []grpc.ServerOption
+	if intercepted != nil {
+		interceptor := NewInterceptor(mailboxes.Validate, *intercepted)
+		options = append(options, grpc.UnaryInterceptor(interceptor.Unary()), grpc.StreamInterceptor(interceptor.Stream()))
+	}
+	server := grpc.NewServer(options...)
+	RegisterAuthServer(server, NewServer(mailboxes, ServerOptions{}))
+
+	listener := bufconn.Listen(1 << 20)
+	go func() { _ = server.Serve(listener) }()
+
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) { return listener.Dial() }
+	conn, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthClient(conn), db, func() {
+		_ = conn.Close()
+		server.Stop()
+	}
+}
+
+// withToken returns a context sending token as the bearer token of the call
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func testUserJourney(t *testing.T) {
+	client, _, stop := newClient(t, nil)
+	defer stop()
+	ctx := context.Background()
+
+	registered, err := client.Register(ctx, &RegisterRequest{Name: "Bashar", Username: "bashar_123", Password: "bb123123"})
+	if err != nil || registered.Id != 1 {
+		t.Fatalf("\t%s\tregister should answer the id -- %v %v", failure, registered, err)
+	}
+
+	tokens, err := client.Signin(ctx, &SigninRequest{Identifier: "bashar_123", Password: "bb123123"})
+	if err != nil || tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("\t%s\tsignin should answer the tokens -- %v %v", failure, tokens, err)
+	}
+
+	claims, err := client.Validate(ctx, &ValidateRequest{Token: tokens.AccessToken})
+	if err != nil || claims.Id != 1 || claims.SessionId != tokens.SessionId || claims.ExpiresAt == nil {
+		t.Fatalf("\t%s\tvalidate should answer the claims -- %v %v", failure, claims, err)
+	}
+
+	me, err := client.GetMe(withToken(tokens.AccessToken), &empty.Empty{})
+	if err != nil || me.Username != "bashar_123" || me.CreatedAt == nil {
+		t.Fatalf("\t%s\tGetMe should answer the user -- %v %v", failure, me, err)
+	}
+
+	me, err = client.UpdateMe(withToken(tokens.AccessToken), &UpdateMeRequest{Name: &wrappers.StringValue{Value: "Bashar Saleh"}})
+	if err != nil || me.Name != "Bashar Saleh" || me.Username != "bashar_123" {
+		t.Fatalf("\t%s\tUpdateMe should only change the set fields -- %v %v", failure, me, err)
+	}
+
+	refreshed, err := client.RefreshToken(ctx, &RefreshTokenRequest{RefreshToken: tokens.RefreshToken})
+	if err != nil || refreshed.SessionId != tokens.SessionId || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("\t%s\tRefreshToken should rotate the refresh token -- %v %v", failure, refreshed, err)
+	}
+
+	sessions, err := client.ListSessions(withToken(refreshed.AccessToken), &empty.Empty{})
+	if err != nil || len(sessions.Sessions) != 1 || !sessions.Sessions[0].Current || sessions.Sessions[0].Ip == "" {
+		t.Fatalf("\t%s\tListSessions should answer the current session with the peer IP -- %v %v", failure, sessions, err)
+	}
+
+	_, err = client.RevokeSession(withToken(refreshed.AccessToken), &RevokeSessionRequest{SessionId: tokens.SessionId})
+	if err != nil {
+		t.Fatalf("\t%s\tRevokeSession should succeed -- %v", failure, err)
+	}
+	_, err = client.RefreshToken(ctx, &RefreshTokenRequest{RefreshToken: refreshed.RefreshToken})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("\t%s\tthe refresh token of a revoked session should be refused -- %v", failure, err)
+	}
+
+	tokens, _ = client.Signin(ctx, &SigninRequest{Identifier: "bashar_123", Password: "bb123123"})
+	_, err = client.DeleteMe(withToken(tokens.AccessToken), &empty.Empty{})
+	if err != nil {
+		t.Fatalf("\t%s\tDeleteMe should succeed -- %v", failure, err)
+	}
+	_, err = client.GetMe(withToken(tokens.AccessToken), &empty.Empty{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("\t%s\tthe tokens of a deleted user should be refused -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testErrors(t *testing.T) {
+	client, _, stop := newClient(t, nil)
+	defer stop()
+	ctx := context.Background()
+	_, _ = client.Register(ctx, &RegisterRequest{Username: "bashar_123", Password: "bb123123"})
+
+	data := []struct {
+		call  func() error
+		code  codes.Code
+		error string
+		field string
+	}{
+		{
+			call: func() error {
+				_, err := client.Register(ctx, &RegisterRequest{Username: "bashar_123", Password: "bb123123"})
+				return err
+			},
+			code: codes.AlreadyExists, error: entities.CodeAlreadyExists, field: "username",
+		},
+		{
+			call: func() error {
+				_, err := client.Signin(ctx, &SigninRequest{Identifier: "bashar_123", Password: "wrong"})
+				return err
+			},
+			code: codes.Unauthenticated, error: entities.CodeInvalidCredentials,
+		},
+		{
+			call: func() error {
+				_, err := client.Validate(ctx, &ValidateRequest{Token: "not a token"})
+				return err
+			},
+			code: codes.Unauthenticated, error: entities.CodeTokenInvalid,
+		},
+		{
+			call: func() error {
+				_, err := client.RefreshToken(ctx, &RefreshTokenRequest{})
+				return err
+			},
+			code: codes.InvalidArgument, error: entities.CodeValidationFailed, field: "refresh_token",
+		},
+		{
+			call: func() error {
+				_, err := client.GetMe(ctx, &empty.Empty{})
+				return err
+			},
+			code: codes.Unauthenticated, error: entities.CodeTokenInvalid,
+		},
+	}
+
+	for i := range data {
+		err := data[i].call()
+		coded := ToError(err)
+		if status.Code(err) != data[i].code || coded.Code != data[i].error || coded.Field != data[i].field {
+			t.Fatalf("\t%s\tdata[%v] should fail with %v %s -- %v %+v", failure, i, data[i].code, data[i].error, err, coded)
+		}
+	}
+
+	// the server of empty mailboxes implements nothing
+	server := NewServer(Mailboxes{}, ServerOptions{})
+	_, err := server.GetMe(ctx, &empty.Empty{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("\t%s\tcalls without their nanos should be Unimplemented -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testAdmin(t *testing.T) {
+	client, db, stop := newClient(t, nil)
+	defer stop()
+	ctx := context.Background()
+
+	_, _ = client.Register(ctx, &RegisterRequest{Username: "admin_1", Password: "bb123123"})
+	_, _ = client.Register(ctx, &RegisterRequest{Username: "bashar_123", Password: "bb123123"})
+	// admins are only made in the store
+	_, err := db.Exec(`UPDATE users SET roles = '["admin"]' WHERE username = 'admin_1'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := client.Signin(ctx, &SigninRequest{Identifier: "bashar_123", Password: "bb123123"})
+	_, err = client.ListUsers(withToken(user.AccessToken), &ListUsersRequest{})
+	if status.Code(err) != codes.PermissionDenied || ToError(err).Code != entities.CodeForbidden {
+		t.Fatalf("\t%s\tListUsers should refuse users without the admin role -- %v", failure, err)
+	}
+
+	admin, _ := client.Signin(ctx, &SigninRequest{Identifier: "admin_1", Password: "bb123123"})
+	page, err := client.ListUsers(withToken(admin.AccessToken), &ListUsersRequest{SortBy: "username"})
+	if err != nil || len(page.Users) != 2 || page.Users[0].Username != "admin_1" {
+		t.Fatalf("\t%s\tListUsers should answer the users to an admin -- %v %v", failure, page, err)
+	}
+
+	_, err = client.ChangeUserStatus(withToken(admin.AccessToken), &ChangeUserStatusRequest{UserId: 2, Status: entities.StatusDisabled, Reason: "abuse"})
+	if err != nil {
+		t.Fatalf("\t%s\tChangeUserStatus should succeed for an admin -- %v", failure, err)
+	}
+	_, err = client.Signin(ctx, &SigninRequest{Identifier: "bashar_123", Password: "bb123123"})
+	if status.Code(err) != codes.PermissionDenied || ToError(err).Code != entities.CodeAccountDisabled {
+		t.Fatalf("\t%s\ta disabled user should not signin -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+// testStream is a grpc.ServerStream of ctx
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testStream) Context() context.Context {
+	return s.ctx
+}
+
+func testInterceptors(t *testing.T) {
+	client, _, stop := newClient(t, &InterceptorOptions{
+		Roles:  map[string][]string{"/auth.v1.Auth/ListUsers": {AdminRole}},
+		Public: PublicMethods,
+	})
+	defer stop()
+	ctx := context.Background()
+
+	_, err := client.Register(ctx, &RegisterRequest{Username: "bashar_123", Password: "bb123123"})
+	if err != nil {
+		t.Fatalf("\t%s\tpublic methods should be served without token -- %v", failure, err)
+	}
+	_, err = client.GetMe(ctx, &empty.Empty{})
+	if status.Code(err) != codes.Unauthenticated || ToError(err).Code != entities.CodeTokenInvalid {
+		t.Fatalf("\t%s\tcalls without token should be Unauthenticated -- %v", failure, err)
+	}
+
+	tokens, _ := client.Signin(ctx, &SigninRequest{Identifier: "bashar_123", Password: "bb123123"})
+	me, err := client.GetMe(withToken(tokens.AccessToken), &empty.Empty{})
+	if err != nil || me.Username != "bashar_123" {
+		t.Fatalf("\t%s\tcalls with a valid token should be served -- %v %v", failure, me, err)
+	}
+	_, err = client.ListUsers(withToken(tokens.AccessToken), &ListUsersRequest{})
+	if status.Code(err) != codes.PermissionDenied || ToError(err).Code != entities.CodeForbidden {
+		t.Fatalf("\t%s\tcalls missing the roles of the map should be PermissionDenied -- %v", failure, err)
+	}
+
+	// streams get the claims from the context of their stream
+	interceptor := NewInterceptor(validateJWT.NewValidateJWTNanos(1, 10, "secretKey", validateJWT.Options{}), InterceptorOptions{
+		Roles: map[string][]string{"/test.Watcher/Admin": {AdminRole}},
+	})
+	var userID int64
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		userID, _ = authMiddleware.UserID(stream.Context())
+		return nil
+	}
+	incoming := metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+tokens.AccessToken))
+
+	data := []struct {
+		ctx    context.Context
+		method string
+		code   codes.Code
+	}{
+		{ctx: incoming, method: "/test.Watcher/Watch", code: codes.OK},
+		{ctx: ctx, method: "/test.Watcher/Watch", code: codes.Unauthenticated},
+		{ctx: incoming, method: "/test.Watcher/Admin", code: codes.PermissionDenied},
+	}
+	for i := range data {
+		userID = 0
+		err = interceptor.Stream()(nil, &testStream{ctx: data[i].ctx}, &grpc.StreamServerInfo{FullMethod: data[i].method}, handler)
+		if status.Code(err) != data[i].code || (err == nil && userID != 1) {
+			t.Fatalf("\t%s\tdata[%v] should answer %v -- %v %v", failure, i, data[i].code, err, userID)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
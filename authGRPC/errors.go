@@ -0,0 +1,110 @@
+package authGRPC
+
+import (
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/rateLimiter"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcCodes maps the error codes to gRPC codes, unknown codes are Internal
+var grpcCodes = map[string]codes.Code{
+	entities.CodeBadRequest:         codes.InvalidArgument,
+	entities.CodeValidationFailed:   codes.InvalidArgument,
+	entities.CodeInvalidCredentials: codes.Unauthenticated,
+	entities.CodeTokenExpired:       codes.Unauthenticated,
+	entities.CodeTokenInvalid:       codes.Unauthenticated,
+	entities.CodeStepUpRequired:     codes.Unauthenticated,
+	entities.CodeStepUpFailed:       codes.Unauthenticated,
+	entities.CodeAccountSuspended:   codes.PermissionDenied,
+	entities.CodeAccountDisabled:    codes.PermissionDenied,
+	entities.CodeForbidden:          codes.PermissionDenied,
+	entities.CodeNotFound:           codes.NotFound,
+	entities.CodeAlreadyExists:      codes.AlreadyExists,
+	entities.CodeLocked:             codes.FailedPrecondition,
+	entities.CodeRateLimited:        codes.ResourceExhausted,
+	entities.CodeCancelled:          codes.Canceled,
+	entities.CodeDeadlineExceeded:   codes.DeadlineExceeded,
+	entities.CodeUnavailable:        codes.Unavailable,
+	entities.CodeInternal:           codes.Internal,
+}
+
+// Code returns the gRPC code of an error code
+func Code(code string) codes.Code {
+	grpcCode, ok := grpcCodes[code]
+	if !ok {
+		return codes.Internal
+	}
+	return grpcCode
+}
+
+// statusError returns err as a gRPC status error carrying an ErrorDetail,
+// and a RetryInfo when the caller is rate limited
+func statusError(err error) error {
+	coded := entities.ToError(err)
+	st := status.New(Code(coded.Code), coded.Message)
+
+	detail := &ErrorDetail{Code: coded.Code, Field: coded.Field}
+	var limited *rateLimiter.LimitedError
+	for _, cause := range entities.Causes(err) {
+		switch cause := cause.(type) {
+		case *signinUser.StepUpRequiredError:
+			detail.Challenge = cause.Challenge
+			detail.ExpiresAt, _ = ptypes.TimestampProto(cause.ExpiresAt)
+		case *rateLimiter.LimitedError:
+			limited = cause
+		}
+	}
+	withDetails, detailsErr := st.WithDetails(detail)
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	if limited != nil {
+		withRetry, retryErr := withDetails.WithDetails(&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(limited.RetryAfter)})
+		if retryErr == nil {
+			withDetails = withRetry
+		}
+	}
+	return withDetails.Err()
+}
+
+// ToError returns the error of a call as an *entities.Error, with the code and field of
+// its ErrorDetail. Errors raised by gRPC itself get the closest code.
+func ToError(err error) *entities.Error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return entities.ToError(err)
+	}
+
+	for _, detail := range st.Details() {
+		if detail, ok := detail.(*ErrorDetail); ok {
+			return &entities.Error{Code: detail.Code, Field: detail.Field, Message: st.Message(), Err: err}
+		}
+	}
+
+	code := entities.CodeInternal
+	switch st.Code() {
+	case codes.Canceled:
+		code = entities.CodeCancelled
+	case codes.DeadlineExceeded:
+		code = entities.CodeDeadlineExceeded
+	case codes.Unavailable:
+		code = entities.CodeUnavailable
+	case codes.InvalidArgument:
+		code = entities.CodeBadRequest
+	case codes.Unauthenticated:
+		code = entities.CodeTokenInvalid
+	case codes.PermissionDenied:
+		code = entities.CodeForbidden
+	case codes.NotFound, codes.Unimplemented:
+		code = entities.CodeNotFound
+	}
+	return &entities.Error{Code: code, Message: st.Message(), Err: err}
+}
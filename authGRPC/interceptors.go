@@ -0,0 +1,115 @@
+package authGRPC
+
+import (
+	"context"
+	"github.com/bashar-saleh/auth-nanos/authMiddleware"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"google.golang.org/grpc"
+	"strings"
+)
+
+// PublicMethods are the methods of the Auth service served without token
+var PublicMethods = []string{
+	"/auth.v1.Auth/Register",
+	"/auth.v1.Auth/Signin",
+	"/auth.v1.Auth/RefreshToken",
+	"/auth.v1.Auth/Validate",
+}
+
+// InterceptorOptions configure an Interceptor
+type InterceptorOptions struct {
+	// Roles maps full method names, e.g. "/auth.v1.Auth/ListUsers", to the roles they all need.
+	// Methods missing from it only need a valid token.
+	Roles map[string][]string
+	// Public methods are served without token, e.g. PublicMethods
+	Public []string
+}
+
+// Interceptor authenticates calls with the validateJWT nanos before handing them on with
+// their claims in the context, read them with authMiddleware.ClaimsFromContext and its
+// accessors. Calls without a valid bearer token in their "authorization" metadata fail with
+// Unauthenticated, calls missing roles with PermissionDenied.
+type Interceptor struct {
+	validate chan nanos.Message
+	options  InterceptorOptions
+	public   map[string]bool
+}
+
+// NewInterceptor returns the interceptor validating tokens with the channel returned by NewValidateJWTNanos
+func NewInterceptor(validate chan nanos.Message, options InterceptorOptions) *Interceptor {
+	public := make(map[string]bool, len(options.Public))
+	for _, method := range options.Public {
+		public[method] = true
+	}
+	return &Interceptor{
+		validate: validate,
+		options:  options,
+		public:   public,
+	}
+}
+
+// Unary returns the interceptor of unary calls, pass it to grpc.UnaryInterceptor
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := i.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns the interceptor of streaming calls, pass it to grpc.StreamInterceptor
+func (i *Interceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := i.authorize(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &claimsStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authorize returns ctx with the claims of the call to method, its errors are status errors
+func (i *Interceptor) authorize(ctx context.Context, method string) (context.Context, error) {
+	if i.public[method] {
+		return ctx, nil
+	}
+
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, statusError(entities.NewError(entities.CodeTokenInvalid, "bearer token is required"))
+	}
+	if i.validate == nil {
+		return nil, statusError(entities.NewError(entities.CodeInternal, "validateJWT nanos is not set"))
+	}
+	res, err := call(ctx, i.validate, validateJWT.Request{Token: token})
+	if err != nil {
+		return nil, err
+	}
+	response, err := validateJWT.DecodeResponse(res)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	ctx = authMiddleware.NewContext(ctx, response.Claims)
+	roles := i.options.Roles[method]
+	for _, role := range roles {
+		if !authMiddleware.HasRole(ctx, role) {
+			return nil, statusError(entities.NewError(entities.CodeForbidden, "the "+strings.Join(roles, ", ")+" roles are required"))
+		}
+	}
+	return ctx, nil
+}
+
+// claimsStream is a grpc.ServerStream whose context carries the claims
+type claimsStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *claimsStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,449 @@
+// auth.pb.go is generated from auth.proto by protoc-gen-go v1.3.2, the version of
+// github.com/golang/protobuf in go.mod, with its grpc plugin:
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. auth.proto
+
+package authGRPC
+
+import (
+	"context"
+	"github.com/bashar-saleh/auth-nanos/authMiddleware"
+	"github.com/bashar-saleh/auth-nanos/changeUserStatus"
+	"github.com/bashar-saleh/auth-nanos/deleteUser"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/getUser"
+	"github.com/bashar-saleh/auth-nanos/listSessions"
+	"github.com/bashar-saleh/auth-nanos/listUsers"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/refreshToken"
+	"github.com/bashar-saleh/auth-nanos/registerUser"
+	"github.com/bashar-saleh/auth-nanos/revokeSession"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/auth-nanos/updateUser"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"strings"
+	"time"
+)
+
+// AdminRole is the role the ListUsers and ChangeUserStatus calls need
+const AdminRole = "admin"
+
+// Mailboxes are the channels of the nanos behind the server.
+// The calls of a nil channel answer Unimplemented.
+type Mailboxes struct {
+	Register         chan nanos.Message
+	Signin           chan nanos.Message
+	RefreshToken     chan nanos.Message
+	Validate         chan nanos.Message
+	GetUser          chan nanos.Message
+	UpdateUser       chan nanos.Message
+	DeleteUser       chan nanos.Message
+	ListSessions     chan nanos.Message
+	RevokeSession    chan nanos.Message
+	ListUsers        chan nanos.Message
+	ChangeUserStatus chan nanos.Message
+}
+
+// Server is the AuthServer forwarding every call to the nanos behind its mailboxes.
+// The user and admin calls need an "authorization: Bearer <access token>" metadata.
+// Failures are status errors with the gRPC code of their error code, see Code, and an
+// ErrorDetail; ToError reads them back on the client side.
+type Server struct {
+	UnimplementedAuthServer
+	mailboxes Mailboxes
+	options   ServerOptions
+}
+
+// ServerOptions configure a Server
+type ServerOptions struct {
+	// TrustCaller takes the source and ip of Register and Signin requests from the caller
+	// instead of the peer address. Set it only when every caller is a trusted proxy filling
+	// them in itself, any other caller could pick its own rate limit bucket and forge the IP
+	// of sessions, new device checks and audit events.
+	TrustCaller bool
+}
+
+// NewServer returns the server of mailboxes, register it with RegisterAuthServer
+func NewServer(mailboxes Mailboxes, options ServerOptions) *Server {
+	return &Server{mailboxes: mailboxes, options: options}
+}
+
+func (s *Server) Register(ctx context.Context, in *RegisterRequest) (*RegisterResponse, error) {
+	// roles are never taken from the caller
+	req := registerUser.Request{
+		User: entities.User{
+			Name:     in.Name,
+			Username: in.Username,
+			Password: in.Password,
+			Email:    in.Email,
+			Phone:    in.Phone,
+		},
+		Source: s.callerIP(ctx, in.Source),
+	}
+
+	res, err := call(ctx, s.mailboxes.Register, req)
+	if err != nil {
+		return nil, err
+	}
+	response, err := registerUser.DecodeResponse(res)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &RegisterResponse{Id: response.ID}, nil
+}
+
+func (s *Server) Signin(ctx context.Context, in *SigninRequest) (*Tokens, error) {
+	req := signinUser.Request{
+		FirstField:      in.Identifier,
+		Password:        in.Password,
+		Source:          s.callerIP(ctx, in.Source),
+		UserAgent:       in.UserAgent,
+		IP:              s.callerIP(ctx, in.Ip),
+		DeviceID:        in.DeviceId,
+		StepUpChallenge: in.StepUpChallenge,
+		StepUpCode:      in.StepUpCode,
+	}
+	if req.UserAgent == "" {
+		req.UserAgent = firstMetadata(ctx, "user-agent")
+	}
+
+	res, err := call(ctx, s.mailboxes.Signin, req)
+	if err != nil {
+		return nil, err
+	}
+	response, err := signinUser.DecodeResponse(res)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toTokens(response.Tokens), nil
+}
+
+func (s *Server) RefreshToken(ctx context.Context, in *RefreshTokenRequest) (*Tokens, error) {
+	res, err := call(ctx, s.mailboxes.RefreshToken, refreshToken.Request{RefreshToken: in.RefreshToken})
+	if err != nil {
+		return nil, err
+	}
+	response, err := refreshToken.DecodeResponse(res)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toTokens(response.Tokens), nil
+}
+
+func (s *Server) Validate(ctx context.Context, in *ValidateRequest) (*Claims, error) {
+	claims, err := s.validate(ctx, in.Token)
+	if err != nil {
+		return nil, err
+	}
+	return &Claims{
+		Id:        int64(claims.ID),
+		Roles:     claims.Roles,
+		SessionId: claims.SessionID,
+		ExpiresAt: toTimestamp(time.Unix(claims.ExpiresAt, 0)),
+	}, nil
+}
+
+func (s *Server) GetMe(ctx context.Context, _ *empty.Empty) (*User, error) {
+	claims, err := s.claims(ctx, s.mailboxes.GetUser)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := call(ctx, s.mailboxes.GetUser, getUser.Request{ID: int64(claims.ID)})
+	if err != nil {
+		return nil, err
+	}
+	response, err := getUser.DecodeResponse(res)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toUser(response.User), nil
+}
+
+func (s *Server) UpdateMe(ctx context.Context, in *UpdateMeRequest) (*User, error) {
+	claims, err := s.claims(ctx, s.mailboxes.UpdateUser)
+	if err != nil {
+		return nil, err
+	}
+
+	req := updateUser.Request{
+		ID:       int64(claims.ID),
+		Name:     fromStringValue(in.Name),
+		Username: fromStringValue(in.Username),
+		Email:    fromStringValue(in.Email),
+		Phone:    fromStringValue(in.Phone),
+	}
+	res, err := call(ctx, s.mailboxes.UpdateUser, req)
+	if err != nil {
+		return nil, err
+	}
+	response, err := updateUser.DecodeResponse(res)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toUser(response.User), nil
+}
+
+func (s *Server) DeleteMe(ctx context.Context, _ *empty.Empty) (*empty.Empty, error) {
+	claims, err := s.claims(ctx, s.mailboxes.DeleteUser)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = call(ctx, s.mailboxes.DeleteUser, deleteUser.Request{ID: int64(claims.ID)})
+	if err != nil {
+		return nil, err
+	}
+	return &empty.Empty{}, nil
+}
+
+func (s *Server) ListSessions(ctx context.Context, _ *empty.Empty) (*ListSessionsResponse, error) {
+	claims, err := s.claims(ctx, s.mailboxes.ListSessions)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := call(ctx, s.mailboxes.ListSessions, listSessions.Request{ID: int64(claims.ID), SessionID: claims.SessionID})
+	if err != nil {
+		return nil, err
+	}
+	response, err := listSessions.DecodeResponse(res)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	sessions := make([]*Session, 0, len(response.Sessions))
+	for _, session := range response.Sessions {
+		sessions = append(sessions, &Session{
+			Id:         session.ID,
+			CreatedAt:  toTimestamp(session.CreatedAt),
+			LastUsedAt: toTimestamp(session.LastUsedAt),
+			UserAgent:  session.UserAgent,
+			Ip:         session.IP,
+			Current:    session.Current,
+		})
+	}
+	return &ListSessionsResponse{Sessions: sessions}, nil
+}
+
+func (s *Server) RevokeSession(ctx context.Context, in *RevokeSessionRequest) (*empty.Empty, error) {
+	claims, err := s.claims(ctx, s.mailboxes.RevokeSession)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = call(ctx, s.mailboxes.RevokeSession, revokeSession.Request{ID: int64(claims.ID), SessionID: in.SessionId})
+	if err != nil {
+		return nil, err
+	}
+	return &empty.Empty{}, nil
+}
+
+func (s *Server) ListUsers(ctx context.Context, in *ListUsersRequest) (*ListUsersResponse, error) {
+	claims, err := s.adminClaims(ctx, s.mailboxes.ListUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	req := listUsers.Request{
+		ActorID:    int64(claims.ID),
+		Role:       in.Role,
+		Status:     in.Status,
+		Search:     in.Search,
+		SortBy:     in.SortBy,
+		Descending: in.Descending,
+		Limit:      int(in.Limit),
+		Cursor:     in.Cursor,
+	}
+	res, err := call(ctx, s.mailboxes.ListUsers, req)
+	if err != nil {
+		return nil, err
+	}
+	page, err := listUsers.DecodeResponse(res)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	users := make([]*User, 0, len(page.Users))
+	for _, user := range page.Users {
+		users = append(users, toUser(user))
+	}
+	return &ListUsersResponse{Users: users, NextCursor: page.NextCursor}, nil
+}
+
+func (s *Server) ChangeUserStatus(ctx context.Context, in *ChangeUserStatusRequest) (*empty.Empty, error) {
+	claims, err := s.adminClaims(ctx, s.mailboxes.ChangeUserStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	req := changeUserStatus.Request{
+		ActorID: int64(claims.ID),
+		UserID:  in.UserId,
+		Status:  in.Status,
+		Reason:  in.Reason,
+	}
+	if in.Until != nil {
+		req.Until, err = ptypes.Timestamp(in.Until)
+		if err != nil {
+			return nil, statusError(entities.WrapError(entities.CodeBadRequest, err))
+		}
+	}
+	_, err = call(ctx, s.mailboxes.ChangeUserStatus, req)
+	if err != nil {
+		return nil, err
+	}
+	return &empty.Empty{}, nil
+}
+
+// validate returns the claims of token
+func (s *Server) validate(ctx context.Context, token string) (validateJWT.Claims, error) {
+	res, err := call(ctx, s.mailboxes.Validate, validateJWT.Request{Token: token})
+	if err != nil {
+		return validateJWT.Claims{}, err
+	}
+	response, err := validateJWT.DecodeResponse(res)
+	if err != nil {
+		return validateJWT.Claims{}, statusError(err)
+	}
+	return response.Claims, nil
+}
+
+// claims validates the bearer token of the call, mailBox is the nanos the call needs next.
+// The claims of an Interceptor are not validated again.
+func (s *Server) claims(ctx context.Context, mailBox chan nanos.Message) (validateJWT.Claims, error) {
+	if mailBox == nil {
+		return validateJWT.Claims{}, status.Error(codes.Unimplemented, "the nanos of this call is not set")
+	}
+	if claims, ok := authMiddleware.ClaimsFromContext(ctx); ok {
+		return claims, nil
+	}
+	if s.mailboxes.Validate == nil {
+		return validateJWT.Claims{}, status.Error(codes.Unimplemented, "the nanos of this call is not set")
+	}
+
+	token := bearerToken(ctx)
+	if token == "" {
+		return validateJWT.Claims{}, statusError(entities.NewError(entities.CodeTokenInvalid, "bearer token is required"))
+	}
+	return s.validate(ctx, token)
+}
+
+// adminClaims is claims refusing callers without AdminRole
+func (s *Server) adminClaims(ctx context.Context, mailBox chan nanos.Message) (validateJWT.Claims, error) {
+	claims, err := s.claims(ctx, mailBox)
+	if err != nil {
+		return validateJWT.Claims{}, err
+	}
+	for _, role := range claims.Roles {
+		if role == AdminRole {
+			return claims, nil
+		}
+	}
+	return validateJWT.Claims{}, statusError(entities.NewError(entities.CodeForbidden, "the "+AdminRole+" role is required"))
+}
+
+// call sends payload to the nanos behind mailBox, its errors are status errors
+func call(ctx context.Context, mailBox chan nanos.Message, payload interface{}) (nanos.Message, error) {
+	if mailBox == nil {
+		return nanos.Message{}, status.Error(codes.Unimplemented, "the nanos of this call is not set")
+	}
+	res, err := messages.Call(ctx, mailBox, payload)
+	if err != nil {
+		return nanos.Message{}, statusError(err)
+	}
+	return res, nil
+}
+
+// bearerToken returns the token of the authorization metadata, empty when there is none
+func bearerToken(ctx context.Context) string {
+	parts := strings.SplitN(firstMetadata(ctx, "authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+// firstMetadata returns the first value of the incoming metadata key
+func firstMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// callerIP returns supplied when the caller is trusted and sent it, the peer IP otherwise
+func (s *Server) callerIP(ctx context.Context, supplied string) string {
+	if s.options.TrustCaller && supplied != "" {
+		return supplied
+	}
+	return peerIP(ctx)
+}
+
+// peerIP returns the IP of the connection of the call
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func toTokens(tokens signinUser.Tokens) *Tokens {
+	return &Tokens{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		SessionId:    tokens.SessionID,
+	}
+}
+
+func toUser(user entities.User) *User {
+	return &User{
+		Id:            user.ID,
+		Name:          user.Name,
+		Username:      user.Username,
+		Email:         user.Email,
+		Phone:         user.Phone,
+		Roles:         user.Roles,
+		Status:        user.Status,
+		EmailVerified: user.EmailVerified,
+		PhoneVerified: user.PhoneVerified,
+		CreatedAt:     toTimestamp(user.CreatedAt),
+	}
+}
+
+// toTimestamp returns nil for the zero time
+func toTimestamp(t time.Time) *timestamp.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	ts, err := ptypes.TimestampProto(t)
+	if err != nil {
+		return nil
+	}
+	return ts
+}
+
+// fromStringValue returns nil for an unset value, so the field is left unchanged
+func fromStringValue(value *wrappers.StringValue) *string {
+	if value == nil {
+		return nil
+	}
+	s := value.Value
+	return &s
+}
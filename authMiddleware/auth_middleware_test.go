@@ -0,0 +1,177 @@
+package authMiddleware
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+var key = "secretKey"
+
+func TestAuthMiddleware(t *testing.T) {
+	t.Run("Given a valid token in the header or the cookie When request Then the claims are in the context", testClaims)
+	t.Run("Given missing, malformed and invalid tokens When request Then RFC 6750 challenges are answered", testChallenges)
+	t.Run("Given required roles When request Then only users holding them pass", testRoles)
+}
+
+// newHandler returns the handler of middleware answering the id and roles of the context
+func newHandler(middleware func(http.Handler) http.Handler) http.Handler {
+	return middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := UserID(r.Context())
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "sid": SessionID(r.Context()), "roles": Roles(r.Context())})
+	}))
+}
+
+func newToken(t *testing.T, hours int, roles ...string) string {
+	token, err := signinUser.NewAccessToken(key, hours, 7, roles, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func testClaims(t *testing.T) {
+	validate := validateJWT.NewValidateJWTNanos(1, 10, key, validateJWT.Options{})
+	handler := newHandler(NewMiddleware(validate, Options{CookieName: "access_token"}).Handler)
+	token := newToken(t, 1, "editor")
+
+	header := httptest.NewRequest("GET", "/", nil)
+	header.Header.Set("Authorization", "Bearer "+token)
+	cookie := httptest.NewRequest("GET", "/", nil)
+	cookie.AddCookie(&http.Cookie{Name: "access_token", Value: token})
+
+	for i, req := range []*http.Request{header, cookie} {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		var body struct {
+			ID    int64    `json:"id"`
+			Roles []string `json:"roles"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&body)
+		if res.Code != http.StatusOK || body.ID != 7 || len(body.Roles) != 1 || body.Roles[0] != "editor" {
+			t.Fatalf("\t%s\treq[%v] should reach the handler with the claims -- %v %+v", failure, i, res.Code, body)
+		}
+	}
+
+	// the claims of an outer middleware are kept
+	req := httptest.NewRequest("GET", "/", nil).WithContext(NewContext(header.Context(), validateJWT.Claims{ID: 9, Roles: []string{"admin"}}))
+	res := httptest.NewRecorder()
+	NewMiddleware(nil, Options{}).RequireRoles("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !HasRole(r.Context(), "admin") {
+			w.WriteHeader(http.StatusTeapot)
+		}
+	})).ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("\t%s\tauthenticated requests should not be validated again -- %v", failure, res.Code)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testChallenges(t *testing.T) {
+	validate := validateJWT.NewValidateJWTNanos(1, 10, key, validateJWT.Options{})
+	handler := newHandler(NewMiddleware(validate, Options{Realm: "auth", CookieName: "access_token"}).Handler)
+
+	data := []struct {
+		authorization string
+		status        int
+		code          string
+		challenge     string
+	}{
+		{authorization: "", status: http.StatusUnauthorized, code: entities.CodeTokenInvalid, challenge: `Bearer realm="auth"`},
+		{authorization: "Basic dXNlcjpwYXNz", status: http.StatusUnauthorized, code: entities.CodeTokenInvalid, challenge: `Bearer realm="auth"`},
+		{authorization: "Bearer", status: http.StatusBadRequest, code: entities.CodeBadRequest, challenge: `Bearer realm="auth", error="invalid_request"`},
+		{authorization: "Bearer not a token", status: http.StatusBadRequest, code: entities.CodeBadRequest, challenge: `Bearer realm="auth", error="invalid_request"`},
+		{authorization: "Bearer notatoken", status: http.StatusUnauthorized, code: entities.CodeTokenInvalid, challenge: `Bearer realm="auth", error="invalid_token"`},
+		{authorization: "Bearer " + newToken(t, -1), status: http.StatusUnauthorized, code: entities.CodeTokenExpired, challenge: `Bearer realm="auth", error="invalid_token"`},
+	}
+
+	for i := range data {
+		req := httptest.NewRequest("GET", "/", nil)
+		if data[i].authorization != "" {
+			req.Header.Set("Authorization", data[i].authorization)
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		var body struct {
+			Error entities.Error `json:"error"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&body)
+		challenge := res.Header().Get("WWW-Authenticate")
+		if res.Code != data[i].status || body.Error.Code != data[i].code || !strings.HasPrefix(challenge, data[i].challenge) {
+			t.Fatalf("\t%s\tdata[%v] should answer %v %s %s -- %v %s %s", failure, i, data[i].status, data[i].code, data[i].challenge, res.Code, body.Error.Code, challenge)
+		}
+	}
+
+	// failures of the nanos are not challenges
+	handler = newHandler(NewMiddleware(nil, Options{}).Handler)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+newToken(t, 1))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusInternalServerError || res.Header().Get("WWW-Authenticate") != "" {
+		t.Fatalf("\t%s\ta missing nanos should answer 500 without challenge -- %v", failure, res.Code)
+	}
+
+	// nobody reads this mailbox, the request ends with its client
+	handler = newHandler(NewMiddleware(make(chan nanos.Message), Options{}).Handler)
+	ctx, cancel := context.WithCancel(req.Context())
+	cancel()
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req.WithContext(ctx))
+	if res.Code == http.StatusOK || res.Header().Get("WWW-Authenticate") != "" {
+		t.Fatalf("\t%s\ta cancelled request should fail without challenge -- %v", failure, res.Code)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testRoles(t *testing.T) {
+	validate := validateJWT.NewValidateJWTNanos(1, 10, key, validateJWT.Options{})
+	middleware := NewMiddleware(validate, Options{Roles: []string{"editor"}})
+
+	data := []struct {
+		handler http.Handler
+		roles   []string
+		status  int
+	}{
+		{handler: newHandler(middleware.Handler), roles: []string{"editor"}, status: http.StatusOK},
+		{handler: newHandler(middleware.Handler), roles: nil, status: http.StatusForbidden},
+		{handler: newHandler(middleware.RequireRoles("admin", "editor")), roles: []string{"editor", "admin"}, status: http.StatusOK},
+		{handler: newHandler(middleware.RequireRoles("admin", "editor")), roles: []string{"editor"}, status: http.StatusForbidden},
+		{handler: newHandler(middleware.RequireRoles()), roles: nil, status: http.StatusOK},
+	}
+
+	for i := range data {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+newToken(t, 1, data[i].roles...))
+		res := httptest.NewRecorder()
+		data[i].handler.ServeHTTP(res, req)
+
+		if res.Code != data[i].status {
+			t.Fatalf("\t%s\tdata[%v] should answer %v -- %v", failure, i, data[i].status, res.Code)
+		}
+		challenge := res.Header().Get("WWW-Authenticate")
+		if res.Code == http.StatusForbidden && !strings.Contains(challenge, `error="insufficient_scope"`) {
+			t.Fatalf("\t%s\tdata[%v] should answer insufficient_scope -- %s", failure, i, challenge)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+newToken(t, 1))
+	res := httptest.NewRecorder()
+	newHandler(middleware.RequireRoles("admin", "editor")).ServeHTTP(res, req)
+	if challenge := res.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, `scope="admin editor"`) {
+		t.Fatalf("\t%s\tthe challenge should name the required scope -- %s", failure, challenge)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,48 @@
+package authMiddleware
+
+import (
+	"context"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+)
+
+// claimsKey is the context key of the validated claims
+type claimsKey struct{}
+
+// NewContext returns ctx carrying claims, as the middleware does for the requests it lets through
+func NewContext(ctx context.Context, claims validateJWT.Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims of the request, false when the middleware did not run
+func ClaimsFromContext(ctx context.Context) (validateJWT.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(validateJWT.Claims)
+	return claims, ok
+}
+
+// UserID returns the id of the user of the request
+func UserID(ctx context.Context) (int64, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	return int64(claims.ID), ok
+}
+
+// SessionID returns the session the token of the request is bound to, empty when there is none
+func SessionID(ctx context.Context) string {
+	claims, _ := ClaimsFromContext(ctx)
+	return claims.SessionID
+}
+
+// Roles returns the roles of the user of the request
+func Roles(ctx context.Context) []string {
+	claims, _ := ClaimsFromContext(ctx)
+	return claims.Roles
+}
+
+// HasRole tells if the user of the request holds role
+func HasRole(ctx context.Context, role string) bool {
+	for _, held := range Roles(ctx) {
+		if held == role {
+			return true
+		}
+	}
+	return false
+}
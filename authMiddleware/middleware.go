@@ -0,0 +1,221 @@
+package authMiddleware
+
+import (
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RFC 6750 error codes of the WWW-Authenticate challenges
+const (
+	errInvalidRequest    = "invalid_request"
+	errInvalidToken      = "invalid_token"
+	errInsufficientScope = "insufficient_scope"
+)
+
+// b64token is the token syntax of RFC 6750 section 2.1
+var b64token = regexp.MustCompile(`^[A-Za-z0-9\-._~+/]+=*$`)
+
+// Options configure a Middleware
+type Options struct {
+	// CookieName is read when the request has no Authorization header, empty reads no cookie
+	CookieName string
+	// Realm is sent with the challenges, empty sends none
+	Realm string
+	// Roles must all be held by the user, empty lets every valid token through
+	Roles []string
+}
+
+// Middleware authenticates requests with the validateJWT nanos before handing them on with
+// their claims in the context, see ClaimsFromContext.
+// Refused requests are answered as RFC 6750 says, with a WWW-Authenticate challenge, and
+// the {"error": {"code", "message"}} body of the gateway:
+//
+//	no token                       401 Bearer realm="..."
+//	malformed Authorization        400 Bearer error="invalid_request"
+//	invalid, expired or inactive   401 Bearer error="invalid_token"
+//	missing roles                  403 Bearer error="insufficient_scope", scope="..."
+//
+// Other failures of the nanos get the status of their code, see entities.HTTPStatus.
+type Middleware struct {
+	validate chan nanos.Message
+	options  Options
+}
+
+// NewMiddleware returns the middleware validating tokens with the channel returned by NewValidateJWTNanos
+func NewMiddleware(validate chan nanos.Message, options Options) *Middleware {
+	return &Middleware{
+		validate: validate,
+		options:  options,
+	}
+}
+
+// Handler authenticates the requests of next and requires the roles of the options
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return m.RequireRoles(m.options.Roles...)(next)
+}
+
+// RequireRoles returns a middleware requiring every role of roles, e.g. for a single route.
+// Requests already authenticated by an outer middleware are not validated twice.
+func (m *Middleware) RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				var err error
+				claims, err = m.authenticate(r)
+				if err != nil {
+					m.refuse(w, err)
+					return
+				}
+				r = r.WithContext(NewContext(r.Context(), claims))
+			}
+
+			for _, role := range roles {
+				if !HasRole(r.Context(), role) {
+					m.refuse(w, &challengeError{
+						coded:     entities.NewError(entities.CodeForbidden, "the "+strings.Join(roles, ", ")+" roles are required"),
+						challenge: errInsufficientScope,
+						scope:     strings.Join(roles, " "),
+					})
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticate returns the claims of the bearer token of r
+func (m *Middleware) authenticate(r *http.Request) (validateJWT.Claims, error) {
+	token, err := m.token(r)
+	if err != nil {
+		return validateJWT.Claims{}, err
+	}
+	if m.validate == nil {
+		return validateJWT.Claims{}, entities.NewError(entities.CodeInternal, "validateJWT nanos is not set")
+	}
+
+	res, err := messages.Call(r.Context(), m.validate, validateJWT.Request{Token: token})
+	if err != nil {
+		return validateJWT.Claims{}, invalidToken(err)
+	}
+	response, err := validateJWT.DecodeResponse(res)
+	if err != nil {
+		return validateJWT.Claims{}, invalidToken(err)
+	}
+	return response.Claims, nil
+}
+
+// token returns the token of the Authorization header, or of the cookie without the header
+func (m *Middleware) token(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" && m.options.CookieName != "" {
+		cookie, err := r.Cookie(m.options.CookieName)
+		if err == nil && cookie.Value != "" {
+			return m.checkSyntax(cookie.Value)
+		}
+	}
+
+	// other schemes are answered as if no credentials were sent
+	parts := strings.SplitN(header, " ", 2)
+	if !strings.EqualFold(parts[0], "Bearer") {
+		return "", &challengeError{coded: entities.NewError(entities.CodeTokenInvalid, "bearer token is required")}
+	}
+	if len(parts) != 2 {
+		return m.checkSyntax("")
+	}
+	return m.checkSyntax(strings.TrimSpace(parts[1]))
+}
+
+// checkSyntax refuses tokens RFC 6750 does not allow
+func (m *Middleware) checkSyntax(token string) (string, error) {
+	if !b64token.MatchString(token) {
+		return "", &challengeError{
+			coded:     entities.NewError(entities.CodeBadRequest, "the bearer token is malformed"),
+			challenge: errInvalidRequest,
+		}
+	}
+	return token, nil
+}
+
+// refuse answers with the status of err, its challenge and its code and message
+func (m *Middleware) refuse(w http.ResponseWriter, err error) {
+	coded := entities.ToError(err)
+	status := entities.HTTPStatus(coded.Code)
+
+	challenged, ok := err.(*challengeError)
+	if ok {
+		w.Header().Set("WWW-Authenticate", m.challenge(challenged))
+		switch challenged.challenge {
+		case "", errInvalidToken:
+			status = http.StatusUnauthorized
+		case errInvalidRequest:
+			status = http.StatusBadRequest
+		case errInsufficientScope:
+			status = http.StatusForbidden
+		}
+	}
+
+	raw, _ := json.Marshal(struct {
+		Error *entities.Error `json:"error"`
+	}{Error: coded})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(raw)
+}
+
+// challenge returns the WWW-Authenticate value of err
+func (m *Middleware) challenge(err *challengeError) string {
+	var params []string
+	if m.options.Realm != "" {
+		params = append(params, "realm="+quote(m.options.Realm))
+	}
+	if err.challenge != "" {
+		params = append(params, "error="+quote(err.challenge), "error_description="+quote(err.coded.Message))
+	}
+	if err.scope != "" {
+		params = append(params, "scope="+quote(err.scope))
+	}
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// challengeError is an error answered with a WWW-Authenticate challenge,
+// an empty challenge only asks for credentials
+type challengeError struct {
+	coded     *entities.Error
+	challenge string
+	scope     string
+}
+
+func (e *challengeError) Error() string {
+	return e.coded.Message
+}
+
+func (e *challengeError) Unwrap() error {
+	return e.coded
+}
+
+// invalidToken returns the refusals of the validateJWT nanos as invalid_token challenges,
+// its other failures are kept as they are
+func invalidToken(err error) error {
+	coded := entities.ToError(err)
+	switch coded.Code {
+	case entities.CodeTokenInvalid, entities.CodeTokenExpired, entities.CodeAccountSuspended, entities.CodeAccountDisabled:
+		return &challengeError{coded: coded, challenge: errInvalidToken}
+	}
+	return coded
+}
+
+// quote returns s as an RFC 7230 quoted-string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
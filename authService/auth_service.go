@@ -0,0 +1,420 @@
+package authService
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/authClient"
+	"github.com/bashar-saleh/auth-nanos/authGRPC"
+	"github.com/bashar-saleh/auth-nanos/authMiddleware"
+	"github.com/bashar-saleh/auth-nanos/changeUserStatus"
+	"github.com/bashar-saleh/auth-nanos/cookieSession"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/deleteUser"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/getUser"
+	"github.com/bashar-saleh/auth-nanos/httpGateway"
+	"github.com/bashar-saleh/auth-nanos/introspectToken"
+	"github.com/bashar-saleh/auth-nanos/listSessions"
+	"github.com/bashar-saleh/auth-nanos/listUsers"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/paseto"
+	"github.com/bashar-saleh/auth-nanos/queryAuditEvents"
+	"github.com/bashar-saleh/auth-nanos/rateLimiter"
+	"github.com/bashar-saleh/auth-nanos/refreshToken"
+	"github.com/bashar-saleh/auth-nanos/registerUser"
+	"github.com/bashar-saleh/auth-nanos/revokeSession"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/auth-nanos/updateUser"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/auth-nanos/validateSession"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"golang.org/x/crypto/ed25519"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrStopped is sent to the messages that reach the service after Stop
+var ErrStopped error = entities.NewError(entities.CodeUnavailable, "auth service is stopped")
+
+// AuthService runs every auth nanos on one database, key and audit log.
+//
+// Callers send to its channels as they would to the nanos themselves. Messages wait in the
+// channels until Start, and after Stop they fail with ErrStopped. QueryAuditEvents is nil
+// unless the audit events are stored in SQLite.
+type AuthService struct {
+	Register         chan nanos.Message
+	Signin           chan nanos.Message
+	RefreshToken     chan nanos.Message
+	Validate         chan nanos.Message
+	Introspect       chan nanos.Message
+	ValidateSession  chan nanos.Message
+	GetUser          chan nanos.Message
+	UpdateUser       chan nanos.Message
+	DeleteUser       chan nanos.Message
+	ChangeUserStatus chan nanos.Message
+	ListUsers        chan nanos.Message
+	ListSessions     chan nanos.Message
+	RevokeSession    chan nanos.Message
+	QueryAuditEvents chan nanos.Message
+
+	config      Config
+	db          *sql.DB
+	jsonlSink   *audit.JSONLinesSink
+	routes      []route
+	rejections  *messages.Delivery
+	stopPurging chan struct{}
+
+	// mu guards started, stopped and auditClosed, inFlight counts the messages handed to the nanos
+	// and auditWrites the audit events being written
+	mu          sync.Mutex
+	started     bool
+	stopped     bool
+	auditClosed bool
+	inFlight    sync.WaitGroup
+	auditWrites sync.WaitGroup
+}
+
+// route links a channel of the service to the nanos serving it
+type route struct {
+	front chan nanos.Message
+	nanos chan nanos.Message
+}
+
+// NewAuthService opens the database, prepares its tables and constructs every nanos from config.
+// notifier delivers the duplicate registration and new device notices, the features sending them need it.
+func NewAuthService(config Config, notifier entities.Notifier) (*AuthService, error) {
+	config = config.withDefaults()
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+	if config.NewDevice.Enabled && notifier == nil {
+		return nil, errors.New("new_device needs a notifier")
+	}
+	if config.SilentRegistration && notifier == nil {
+		return nil, errors.New("silent_registration needs a notifier")
+	}
+	var window rateLimiter.Limiter
+	if config.RateLimit.Limit > 0 {
+		window, err = rateLimiter.NewSlidingWindow(config.RateLimit.Limit, time.Duration(config.RateLimit.Window))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// open the datastore and run the shared migrations, every nanos prepares its own tables too
+	db := datastores.SqliteConnection(config.DatabasePath)
+	err = db.Ping()
+	if err != nil {
+		return nil, err
+	}
+	datastores.PrepareUsersTable(db)
+	datastores.PrepareSessionsTable(db)
+
+	// the rate limiter and the refusals after Stop are not in-flight tasks
+	untracked := &messages.Delivery{Timeout: time.Duration(config.ReplyTimeout)}
+	s := &AuthService{
+		config:      config,
+		db:          db,
+		rejections:  untracked,
+		stopPurging: make(chan struct{}),
+	}
+
+	// audit sinks
+	var sinks audit.MultiSink
+	if config.Audit.SQLite {
+		sinks = append(sinks, audit.NewSQLiteSink(db, []byte(config.Audit.Key)))
+	}
+	if config.Audit.JSONLinesPath != "" {
+		s.jsonlSink, err = audit.NewJSONLinesSink(config.Audit.JSONLinesPath, []byte(config.Audit.Key))
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		sinks = append(sinks, s.jsonlSink)
+	}
+	var auditSink audit.Sink
+	if len(sinks) > 0 {
+		auditSink = &stoppableSink{sinks: sinks, service: s}
+	}
+
+	// the replies of the nanos behind the channels end their in-flight tasks
+	delivery := &messages.Delivery{
+		Timeout: time.Duration(config.ReplyTimeout),
+		OnDone:  func(nanos.Message) { s.inFlight.Done() },
+	}
+
+	// policies
+	var limiter chan nanos.Message
+	if config.RateLimit.Limit > 0 {
+		limiter = rateLimiter.NewRateLimiterNanos(config.Workers, config.QueueCapacity, window, rateLimiter.Options{Delivery: untracked})
+	}
+	var lockoutPolicy *signinUser.LockoutPolicy
+	if config.Lockout.MaxAttempts > 0 {
+		lockoutPolicy = &signinUser.LockoutPolicy{
+			MaxAttempts: config.Lockout.MaxAttempts,
+			BaseLockout: time.Duration(config.Lockout.BaseLockout),
+			MaxLockout:  time.Duration(config.Lockout.MaxLockout),
+		}
+	}
+	var newDevicePolicy *signinUser.NewDevicePolicy
+	if config.NewDevice.Enabled {
+		newDevicePolicy = &signinUser.NewDevicePolicy{
+			Notifier:          notifier,
+			RequireStepUp:     config.NewDevice.RequireStepUp,
+			StepUpTTL:         time.Duration(config.NewDevice.StepUpTTL),
+			MaxStepUpAttempts: config.NewDevice.MaxStepUpAttempts,
+		}
+	}
+
+	var accessTokens signinUser.AccessTokenIssuer
+	var pasetoKeys *paseto.Keys
+	pasetoKey, _ := hex.DecodeString(config.PasetoKey)
+	switch config.AccessTokenFormat {
+	case AccessTokenFormatOpaque:
+		accessTokens = signinUser.NewOpaqueTokens(db)
+	case AccessTokenFormatPasetoPublic:
+		secretKey := ed25519.NewKeyFromSeed(pasetoKey)
+		accessTokens = signinUser.NewPasetoPublicTokens(secretKey)
+		pasetoKeys = &paseto.Keys{PublicKey: secretKey.Public().(ed25519.PublicKey)}
+	case AccessTokenFormatPasetoLocal:
+		accessTokens = signinUser.NewPasetoLocalTokens(pasetoKey)
+		pasetoKeys = &paseto.Keys{LocalKey: pasetoKey}
+	}
+
+	// nanos
+	workers := config.Workers
+	capacity := config.QueueCapacity
+	var duplicateEmailNotifier entities.Notifier
+	if config.SilentRegistration {
+		duplicateEmailNotifier = notifier
+	}
+	s.Register = s.serve(registerUser.NewRegisterUserNanos(workers, capacity, db, nil, nil, nil, nil, nil, registerUser.Options{
+		RateLimiter:            limiter,
+		DuplicateEmailNotifier: duplicateEmailNotifier,
+		AuditSink:              auditSink,
+		Delivery:               delivery,
+	}))
+	s.Signin = s.serve(signinUser.NewSigninUserNanos(workers, capacity, db, config.JWTKey, config.TokenHours, nil, nil, signinUser.Options{
+		LockoutPolicy:   lockoutPolicy,
+		RateLimiter:     limiter,
+		AuditSink:       auditSink,
+		NewDevicePolicy: newDevicePolicy,
+		AccessTokens:    accessTokens,
+		Delivery:        delivery,
+	}))
+	s.RefreshToken = s.serve(refreshToken.NewRefreshTokenNanos(workers, capacity, db, config.JWTKey, config.TokenHours, refreshToken.Options{AuditSink: auditSink, AccessTokens: accessTokens, Delivery: delivery}))
+	s.Validate = s.serve(validateJWT.NewValidateJWTNanos(workers, capacity, config.JWTKey, validateJWT.Options{
+		DB:         db,
+		PasetoKeys: pasetoKeys,
+		Formats:    []string{config.AccessTokenFormat},
+		AuditSink:  auditSink,
+		Delivery:   delivery,
+	}))
+	// introspection validates through the channel of the service, so its calls are in-flight tasks too
+	s.Introspect = s.serve(introspectToken.NewIntrospectTokenNanos(workers, capacity, s.Validate, introspectToken.Options{AuditSink: auditSink, Delivery: delivery}))
+	s.ValidateSession = s.serve(validateSession.NewValidateSessionNanos(workers, capacity, db, time.Duration(config.Sessions.IdleTimeout), time.Duration(config.Sessions.MaxAge), validateSession.Options{AuditSink: auditSink, Delivery: delivery}))
+	s.GetUser = s.serve(getUser.NewGetUserNanos(workers, capacity, db, getUser.Options{Delivery: delivery}))
+	s.UpdateUser = s.serve(updateUser.NewUpdateUserNanos(workers, capacity, db, nil, nil, nil, nil, updateUser.Options{AuditSink: auditSink, Delivery: delivery}))
+	s.DeleteUser = s.serve(deleteUser.NewDeleteUserNanos(workers, capacity, db, time.Duration(config.DeleteGracePeriod), deleteUser.Options{AuditSink: auditSink, Delivery: delivery}))
+	s.ChangeUserStatus = s.serve(changeUserStatus.NewChangeUserStatusNanos(workers, capacity, db, changeUserStatus.Options{AuditSink: auditSink, Delivery: delivery}))
+	s.ListUsers = s.serve(listUsers.NewListUsersNanos(workers, capacity, db, listUsers.Options{AuditSink: auditSink, Delivery: delivery}))
+	s.ListSessions = s.serve(listSessions.NewListSessionsNanos(workers, capacity, db, listSessions.Options{Delivery: delivery}))
+	s.RevokeSession = s.serve(revokeSession.NewRevokeSessionNanos(workers, capacity, db, revokeSession.Options{AuditSink: auditSink, Delivery: delivery}))
+	if config.Audit.SQLite {
+		s.QueryAuditEvents = s.serve(queryAuditEvents.NewQueryAuditEventsNanos(workers, capacity, db, queryAuditEvents.Options{Delivery: delivery}))
+	}
+
+	return s, nil
+}
+
+// serve returns the channel of the service in front of the nanos channel
+func (s *AuthService) serve(nanosChannel chan nanos.Message) chan nanos.Message {
+	front := make(chan nanos.Message, s.config.QueueCapacity)
+	s.routes = append(s.routes, route{front: front, nanos: nanosChannel})
+	return front
+}
+
+// Client returns the blocking client of the Register, Signin and Validate channels
+func (s *AuthService) Client() *authClient.AuthClient {
+	return authClient.NewAuthClient(s.Register, s.Signin, s.Validate)
+}
+
+// HTTPHandler returns the JSON gateway of the service, its requests are bounded by RequestTimeout
+func (s *AuthService) HTTPHandler() http.Handler {
+	return httpGateway.NewGateway(httpGateway.Mailboxes{
+		Register:      s.Register,
+		Signin:        s.Signin,
+		RefreshToken:  s.RefreshToken,
+		Validate:      s.Validate,
+		GetUser:       s.GetUser,
+		UpdateUser:    s.UpdateUser,
+		DeleteUser:    s.DeleteUser,
+		ListSessions:  s.ListSessions,
+		RevokeSession: s.RevokeSession,
+		Introspect:    s.Introspect,
+	}, time.Duration(s.config.RequestTimeout))
+}
+
+// Middleware returns the net/http middleware authenticating requests with the validateJWT nanos
+func (s *AuthService) Middleware(options authMiddleware.Options) *authMiddleware.Middleware {
+	return authMiddleware.NewMiddleware(s.Validate, options)
+}
+
+// Interceptor returns the gRPC interceptors authenticating calls with the validateJWT nanos
+func (s *AuthService) Interceptor(options authGRPC.InterceptorOptions) *authGRPC.Interceptor {
+	return authGRPC.NewInterceptor(s.Validate, options)
+}
+
+// CookieSessions returns the browser sessions of the service, their cookies last as long as
+// Sessions.MaxAge unless options set their own MaxAge
+func (s *AuthService) CookieSessions(options cookieSession.Options) *cookieSession.Sessions {
+	if options.MaxAge == 0 {
+		options.MaxAge = time.Duration(s.config.Sessions.MaxAge)
+	}
+	return cookieSession.NewSessions(cookieSession.Mailboxes{
+		Signin:          s.Signin,
+		ValidateSession: s.ValidateSession,
+		RevokeSession:   s.RevokeSession,
+	}, options)
+}
+
+// GRPCServer returns the gRPC server of the service, register it with authGRPC.RegisterAuthServer
+func (s *AuthService) GRPCServer(options authGRPC.ServerOptions) *authGRPC.Server {
+	return authGRPC.NewServer(authGRPC.Mailboxes{
+		Register:         s.Register,
+		Signin:           s.Signin,
+		RefreshToken:     s.RefreshToken,
+		Validate:         s.Validate,
+		GetUser:          s.GetUser,
+		UpdateUser:       s.UpdateUser,
+		DeleteUser:       s.DeleteUser,
+		ListSessions:     s.ListSessions,
+		RevokeSession:    s.RevokeSession,
+		ListUsers:        s.ListUsers,
+		ChangeUserStatus: s.ChangeUserStatus,
+	}, options)
+}
+
+// Start hands the messages of the channels to the nanos and starts purging deleted users
+// when PurgeRetention is set
+func (s *AuthService) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started || s.stopped {
+		return errors.New("auth service is already started")
+	}
+	s.started = true
+
+	for i := range s.routes {
+		go s.relay(s.routes[i])
+	}
+	if s.config.PurgeRetention > 0 {
+		deleteUser.StartPurging(s.db, time.Duration(s.config.PurgeRetention), time.Duration(s.config.PurgeInterval), s.stopPurging)
+	}
+	return nil
+}
+
+// Stop refuses new messages with ErrStopped, waits for the nanos to reply to the messages
+// they already have, then closes the audit log and the database.
+// When ctx ends first Stop returns ctx.Err() at once, the remaining tasks keep running and
+// the audit log and the database are closed once they are replied.
+func (s *AuthService) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return errors.New("auth service is already stopped")
+	}
+	s.stopped = true
+	started := s.started
+	s.mu.Unlock()
+
+	// the waiting messages of a service that never started are refused too
+	if !started {
+		for i := range s.routes {
+			go s.relay(s.routes[i])
+		}
+	}
+	close(s.stopPurging)
+
+	// drain in-flight tasks
+	drained := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		go func() {
+			<-drained
+			err := s.closeStores()
+			if err != nil {
+				log.Println("closing the auth service stores:", err)
+			}
+		}()
+		return ctx.Err()
+	}
+	return s.closeStores()
+}
+
+// closeStores closes the audit log and the database once no task uses them
+func (s *AuthService) closeStores() error {
+	// the nanos audit after replying, wait for the writes in progress before closing the stores
+	s.mu.Lock()
+	s.auditClosed = true
+	s.mu.Unlock()
+	s.auditWrites.Wait()
+
+	var err error
+	if s.jsonlSink != nil {
+		err = s.jsonlSink.Close()
+	}
+	closeErr := s.db.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// relay hands the messages of r.front to its nanos until Stop, then refuses them
+func (s *AuthService) relay(r route) {
+	for msg := range r.front {
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			s.rejections.Fail(msg, ErrStopped)
+			continue
+		}
+		s.inFlight.Add(1)
+		s.mu.Unlock()
+
+		r.nanos <- msg
+	}
+}
+
+// stoppableSink writes to sinks until Stop closes them. The nanos record their audit events
+// after replying, so Stop waits for the writes in progress and later ones fail with ErrStopped.
+type stoppableSink struct {
+	sinks   audit.MultiSink
+	service *AuthService
+}
+
+func (ss *stoppableSink) Write(event audit.Event) error {
+	s := ss.service
+	s.mu.Lock()
+	if s.auditClosed {
+		s.mu.Unlock()
+		return ErrStopped
+	}
+	s.auditWrites.Add(1)
+	s.mu.Unlock()
+	defer s.auditWrites.Done()
+
+	return ss.sinks.Write(event)
+}
@@ -0,0 +1,400 @@
+package authService
+
+import (
+	"context"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/introspectToken"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/registerUser"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestAuthService(t *testing.T) {
+	t.Run("Given YAML and JSON files When load config Then both give the same config", testLoadConfig)
+	t.Run("Given environment variables When load config Then they override the file", testConfigEnv)
+	t.Run("Given a started service When use its client Then all nanos share the database and key", testStart)
+	t.Run("Given a notifier with and without silent registration When register a used email Then only silent registration hides the conflict", testSilentRegistration)
+	t.Run("Given the opaque access token format When signin, validate and introspect Then reference tokens are resolved", testOpaqueTokens)
+	t.Run("Given the PASETO access token formats When signin and validate Then v4 tokens are issued and verified", testPasetoTokens)
+	t.Run("Given an in-flight task When stop Then it is drained and new messages are refused", testStop)
+	t.Run("Given tasks outliving the stop context When stop Then they still use the database before it is closed", testStopTimeout)
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "authService")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testLoadConfig(t *testing.T) {
+	yamlPath := writeFile(t, "auth.yaml", `
+database_path: auth.db
+jwt_key: secret
+workers: 4
+reply_timeout: 2s
+audit:
+  sqlite: true
+lockout:
+  max_attempts: 5
+  base_lockout: 15m
+`)
+	jsonPath := writeFile(t, "auth.json", `{
+	"database_path": "auth.db",
+	"jwt_key": "secret",
+	"workers": 4,
+	"reply_timeout": "2s",
+	"audit": {"sqlite": true},
+	"lockout": {"max_attempts": 5, "base_lockout": "15m"}
+}`)
+
+	want := Config{
+		DatabasePath: "auth.db",
+		JWTKey:       "secret",
+		Workers:      4,
+		ReplyTimeout: Duration(2 * time.Second),
+		Audit:        AuditConfig{SQLite: true},
+		Lockout:      LockoutConfig{MaxAttempts: 5, BaseLockout: Duration(15 * time.Minute)},
+	}
+	for _, path := range []string{yamlPath, jsonPath} {
+		config, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("\t%s\tLoadConfig should not return any error -- %v", failure, err)
+		}
+		if config != want {
+			t.Fatalf("\t%s\t%s is not loaded correctly -- %+v", failure, filepath.Ext(path), config)
+		}
+	}
+
+	_, err := LoadConfig(writeFile(t, "auth.yaml", "jwt_kye: secret\n"))
+	if err == nil {
+		t.Fatalf("\t%s\tunknown YAML fields should be refused", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testConfigEnv(t *testing.T) {
+	path := writeFile(t, "auth.yaml", "jwt_key: secret\nworkers: 4\n")
+	env := map[string]string{
+		"AUTH_JWT_KEY":              "from-env",
+		"AUTH_AUDIT_SQLITE":         "true",
+		"AUTH_RATE_LIMIT_WINDOW":    "1m",
+		"AUTH_LOCKOUT_MAX_ATTEMPTS": "3",
+	}
+	for name, value := range env {
+		_ = os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("\t%s\tLoadConfig should not return any error -- %v", failure, err)
+	}
+	if config.JWTKey != "from-env" || config.Workers != 4 || !config.Audit.SQLite ||
+		config.RateLimit.Window != Duration(time.Minute) || config.Lockout.MaxAttempts != 3 {
+		t.Fatalf("\t%s\tthe environment is not applied -- %+v", failure, config)
+	}
+
+	_ = os.Setenv("AUTH_WORKERS", "many")
+	defer os.Unsetenv("AUTH_WORKERS")
+	_, err = LoadConfig(path)
+	if err == nil {
+		t.Fatalf("\t%s\tinvalid values should be refused", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testStart(t *testing.T) {
+	_, err := NewAuthService(Config{DatabasePath: "test.db"}, nil)
+	if err == nil {
+		t.Fatalf("\t%s\ta config without jwt_key should be refused", failure)
+	}
+
+	service, err := NewAuthService(Config{DatabasePath: "test.db", JWTKey: "secret", Audit: AuditConfig{SQLite: true}}, nil)
+	if err != nil {
+		t.Fatalf("\t%s\tNewAuthService should not return any error -- %v", failure, err)
+	}
+	err = service.Start()
+	if err != nil {
+		t.Fatalf("\t%s\tStart should not return any error -- %v", failure, err)
+	}
+	defer service.Stop(context.Background())
+
+	ctx := context.Background()
+	client := service.Client()
+	_, err = client.Register(ctx, entities.User{Username: "bashar_123", Password: "bb123123"})
+	if err != nil {
+		t.Fatalf("\t%s\tRegister should not return any error -- %v", failure, err)
+	}
+	tokens, err := client.Signin(ctx, "bashar_123", "bb123123")
+	if err != nil {
+		t.Fatalf("\t%s\tSignin should not return any error -- %v", failure, err)
+	}
+	claims, err := client.Validate(ctx, tokens.AccessToken)
+	if err != nil || claims.ID != 1 {
+		t.Fatalf("\t%s\tValidate should return the claims of the signed in user -- %v %v", failure, claims, err)
+	}
+	if service.QueryAuditEvents == nil {
+		t.Fatalf("\t%s\tthe audit events stored in SQLite should be queryable", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+// fakeNotifier keeps the notices it was asked to deliver
+type fakeNotifier struct {
+	mu      sync.Mutex
+	notices []entities.Notice
+}
+
+func (n *fakeNotifier) Notify(notice entities.Notice) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notices = append(n.notices, notice)
+	return nil
+}
+
+func testSilentRegistration(t *testing.T) {
+	_, err := NewAuthService(Config{DatabasePath: "test.db", JWTKey: "secret", SilentRegistration: true}, nil)
+	if err == nil {
+		t.Fatalf("\t%s\tsilent registration without a notifier should be refused", failure)
+	}
+
+	data := []struct {
+		silent bool
+		code   string
+	}{
+		{silent: false, code: entities.CodeAlreadyExists},
+		{silent: true, code: ""},
+	}
+
+	for i := range data {
+		notifier := &fakeNotifier{}
+		service, err := NewAuthService(Config{DatabasePath: "test.db", JWTKey: "secret", SilentRegistration: data[i].silent}, notifier)
+		if err != nil {
+			t.Fatalf("\t%s\tdata[%v] NewAuthService should not return any error -- %v", failure, i, err)
+		}
+		err = service.Start()
+		if err != nil {
+			t.Fatalf("\t%s\tdata[%v] Start should not return any error -- %v", failure, i, err)
+		}
+
+		ctx := context.Background()
+		client := service.Client()
+		_, _ = client.Register(ctx, entities.User{Username: "bashar_123", Password: "bb123123", Email: "bashar@example.com"})
+		_, err = client.Register(ctx, entities.User{Username: "other", Password: "bb123123", Email: "bashar@example.com"})
+		_ = service.Stop(ctx)
+		if err != nil && entities.ToError(err).Code != data[i].code || err == nil && data[i].code != "" {
+			t.Fatalf("\t%s\tdata[%v] registering a used email should answer %q -- %v", failure, i, data[i].code, err)
+		}
+		if data[i].silent != (len(notifier.notices) == 1) {
+			t.Fatalf("\t%s\tdata[%v] the owner should be notified only in silent registration -- %v", failure, i, notifier.notices)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testOpaqueTokens(t *testing.T) {
+	_, err := NewAuthService(Config{DatabasePath: "test.db", JWTKey: "secret", AccessTokenFormat: "paseto"}, nil)
+	if err == nil {
+		t.Fatalf("\t%s\tunknown access token formats should be refused", failure)
+	}
+
+	service, err := NewAuthService(Config{DatabasePath: "test.db", JWTKey: "secret", AccessTokenFormat: AccessTokenFormatOpaque}, nil)
+	if err != nil {
+		t.Fatalf("\t%s\tNewAuthService should not return any error -- %v", failure, err)
+	}
+	err = service.Start()
+	if err != nil {
+		t.Fatalf("\t%s\tStart should not return any error -- %v", failure, err)
+	}
+	defer service.Stop(context.Background())
+
+	ctx := context.Background()
+	client := service.Client()
+	_, _ = client.Register(ctx, entities.User{Username: "bashar_123", Password: "bb123123"})
+	tokens, err := client.Signin(ctx, "bashar_123", "bb123123")
+	if err != nil || strings.Contains(tokens.AccessToken, ".") {
+		t.Fatalf("\t%s\tSignin should return an opaque access token -- %v %v", failure, tokens.AccessToken, err)
+	}
+	claims, err := client.Validate(ctx, tokens.AccessToken)
+	if err != nil || claims.ID != 1 || claims.SessionID != tokens.SessionID {
+		t.Fatalf("\t%s\tValidate should resolve the opaque token -- %v %v", failure, claims, err)
+	}
+	jwt, _ := signinUser.NewAccessToken("secret", 4, 1, nil, tokens.SessionID)
+	_, err = client.Validate(ctx, jwt)
+	if entities.ToError(err).Code != entities.CodeTokenInvalid {
+		t.Fatalf("\t%s\tValidate should refuse JWTs with the opaque format -- %v", failure, err)
+	}
+
+	res, err := messages.Call(ctx, service.Introspect, introspectToken.Request{Token: tokens.AccessToken})
+	if err != nil {
+		t.Fatalf("\t%s\tIntrospect should not return any error -- %v", failure, err)
+	}
+	response, err := introspectToken.DecodeResponse(res)
+	if err != nil || !response.Active || response.Subject != "1" {
+		t.Fatalf("\t%s\tIntrospect should answer the opaque token is active -- %+v %v", failure, response, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testPasetoTokens(t *testing.T) {
+	_, err := NewAuthService(Config{DatabasePath: "test.db", JWTKey: "secret", AccessTokenFormat: AccessTokenFormatPasetoLocal, PasetoKey: "short"}, nil)
+	if err == nil {
+		t.Fatalf("\t%s\tPASETO formats without a 32 bytes key should be refused", failure)
+	}
+
+	key := strings.Repeat("07", 32)
+	for _, format := range []string{AccessTokenFormatPasetoPublic, AccessTokenFormatPasetoLocal} {
+		service, err := NewAuthService(Config{DatabasePath: "test.db", JWTKey: "secret", AccessTokenFormat: format, PasetoKey: key}, nil)
+		if err != nil {
+			t.Fatalf("\t%s\tNewAuthService should not return any error -- %v", failure, err)
+		}
+		_ = service.Start()
+
+		ctx := context.Background()
+		client := service.Client()
+		_, _ = client.Register(ctx, entities.User{Username: "bashar_123", Password: "bb123123"})
+		tokens, err := client.Signin(ctx, "bashar_123", "bb123123")
+		if err != nil || !strings.HasPrefix(tokens.AccessToken, format+".") {
+			t.Fatalf("\t%s\tSignin should return a %s access token -- %v %v", failure, format, tokens.AccessToken, err)
+		}
+		claims, err := client.Validate(ctx, tokens.AccessToken)
+		if err != nil || claims.ID != 1 || claims.SessionID != tokens.SessionID {
+			t.Fatalf("\t%s\tValidate should verify the %s token -- %v %v", failure, format, claims, err)
+		}
+
+		// the JWTs signed with jwt_key are not an access token format anymore
+		jwt, _ := signinUser.NewAccessToken("secret", 4, 1, nil, tokens.SessionID)
+		_, err = client.Validate(ctx, jwt)
+		if entities.ToError(err).Code != entities.CodeTokenInvalid {
+			t.Fatalf("\t%s\tValidate should refuse JWTs with the %s format -- %v", failure, format, err)
+		}
+		_ = service.Stop(ctx)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testStop(t *testing.T) {
+	service, err := NewAuthService(Config{DatabasePath: "test.db", JWTKey: "secret", ReplyTimeout: Duration(time.Minute)}, nil)
+	if err != nil {
+		t.Fatalf("\t%s\tNewAuthService should not return any error -- %v", failure, err)
+	}
+	_ = service.Start()
+
+	// nobody reads resTo yet, so the register task stays in flight
+	resTo := make(chan nanos.Message)
+	errTo := make(chan error)
+	msg, _ := registerUser.NewMessage(registerUser.Request{User: entities.User{Username: "bashar_123", Password: "bb123123"}}, resTo, errTo)
+	service.Register <- msg
+	time.Sleep(200 * time.Millisecond)
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- service.Stop(context.Background()) }()
+	select {
+	case err = <-stopped:
+		t.Fatalf("\t%s\tStop should wait for the in-flight task -- %v", failure, err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// messages sent after Stop are refused
+	lateErrTo := make(chan error, 1)
+	service.Register <- nanos.Message{Content: []byte(`{}`), ResTo: make(chan nanos.Message, 1), ErrTo: lateErrTo}
+	select {
+	case err = <-lateErrTo:
+		if entities.ToError(err).Code != entities.CodeUnavailable {
+			t.Fatalf("\t%s\terror code should be unavailable -- %v", failure, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("\t%s\tthe late message should be refused", failure)
+	}
+
+	select {
+	case <-resTo:
+	case err = <-errTo:
+		t.Fatalf("\t%s\tthe in-flight task should succeed -- %v", failure, err)
+	case <-time.After(time.Second * 2):
+		t.Fatalf("\t%s\tthe in-flight task should be replied", failure)
+	}
+	select {
+	case err = <-stopped:
+		if err != nil {
+			t.Fatalf("\t%s\tStop should not return any error -- %v", failure, err)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("\t%s\tStop should return once the task is drained", failure)
+	}
+
+	err = service.Start()
+	if err == nil {
+		t.Fatalf("\t%s\ta stopped service should not start again", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testStopTimeout(t *testing.T) {
+	service, err := NewAuthService(Config{DatabasePath: "test.db", JWTKey: "secret", Workers: 1, ReplyTimeout: Duration(time.Minute)}, nil)
+	if err != nil {
+		t.Fatalf("\t%s\tNewAuthService should not return any error -- %v", failure, err)
+	}
+	_ = service.Start()
+
+	// the only worker waits on the first reply, the second task waits for the worker
+	firstResTo := make(chan nanos.Message)
+	first, _ := registerUser.NewMessage(registerUser.Request{User: entities.User{Username: "bashar_123", Password: "bb123123"}}, firstResTo, make(chan error, 1))
+	service.Register <- first
+	secondResTo := make(chan nanos.Message, 1)
+	secondErrTo := make(chan error, 1)
+	second, _ := registerUser.NewMessage(registerUser.Request{User: entities.User{Username: "roba_123", Password: "bb123123"}}, secondResTo, secondErrTo)
+	service.Register <- second
+	time.Sleep(200 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = service.Stop(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("\t%s\tStop should give up with the context -- %v", failure, err)
+	}
+
+	// the abandoned tasks still have the database
+	<-firstResTo
+	select {
+	case <-secondResTo:
+	case err = <-secondErrTo:
+		t.Fatalf("\t%s\tthe abandoned task should not find the database closed -- %v", failure, err)
+	case <-time.After(time.Second * 2):
+		t.Fatalf("\t%s\tthe abandoned task should be replied", failure)
+	}
+
+	// and it is closed once they are done
+	deadline := time.Now().Add(2 * time.Second)
+	for service.db.Ping() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if service.db.Ping() == nil {
+		t.Fatalf("\t%s\tthe database should be closed after the abandoned tasks", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,261 @@
+package authService
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bashar-saleh/auth-nanos/paseto"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Config holds everything the AuthService needs. Zero values take the defaults of
+// Defaults, zero policies are disabled.
+// Every field can be overridden by the environment variable in its env tag.
+type Config struct {
+	DatabasePath  string `json:"database_path" yaml:"database_path" env:"AUTH_DATABASE_PATH"`
+	JWTKey        string `json:"jwt_key" yaml:"jwt_key" env:"AUTH_JWT_KEY"`
+	TokenHours    int    `json:"token_hours" yaml:"token_hours" env:"AUTH_TOKEN_HOURS"`
+	Workers       int    `json:"workers" yaml:"workers" env:"AUTH_WORKERS"`
+	QueueCapacity int    `json:"queue_capacity" yaml:"queue_capacity" env:"AUTH_QUEUE_CAPACITY"`
+	// AccessTokenFormat is "jwt" for signed JWTs, "opaque" for reference tokens stored hashed
+	// in the database, which Validate and Introspect resolve and revoke with their session, or
+	// "v4.public" and "v4.local" for PASETO tokens
+	AccessTokenFormat string `json:"access_token_format" yaml:"access_token_format" env:"AUTH_ACCESS_TOKEN_FORMAT"`
+	// PasetoKey is the hex of the 32 bytes key of the PASETO formats: the Ed25519 seed of
+	// v4.public or the symmetric key of v4.local
+	PasetoKey string `json:"paseto_key" yaml:"paseto_key" env:"AUTH_PASETO_KEY"`
+	// ReplyTimeout is how long the nanos wait for callers to take their replies
+	ReplyTimeout Duration `json:"reply_timeout" yaml:"reply_timeout" env:"AUTH_REPLY_TIMEOUT"`
+	// RequestTimeout bounds the requests of the HTTP gateway, zero leaves them unbounded
+	RequestTimeout Duration `json:"request_timeout" yaml:"request_timeout" env:"AUTH_REQUEST_TIMEOUT"`
+	// DeleteGracePeriod keeps the identifiers of deleted users reserved
+	DeleteGracePeriod Duration `json:"delete_grace_period" yaml:"delete_grace_period" env:"AUTH_DELETE_GRACE_PERIOD"`
+	// PurgeRetention hard-deletes soft-deleted users after it, every PurgeInterval
+	PurgeRetention Duration `json:"purge_retention" yaml:"purge_retention" env:"AUTH_PURGE_RETENTION"`
+	PurgeInterval  Duration `json:"purge_interval" yaml:"purge_interval" env:"AUTH_PURGE_INTERVAL"`
+	// SilentRegistration answers the registration of a used email as a success and notifies its
+	// owner instead, it needs the notifier of the service and hides the id of new users too
+	SilentRegistration bool `json:"silent_registration" yaml:"silent_registration" env:"AUTH_SILENT_REGISTRATION"`
+
+	Audit     AuditConfig     `json:"audit" yaml:"audit"`
+	RateLimit RateLimitConfig `json:"rate_limit" yaml:"rate_limit"`
+	Lockout   LockoutConfig   `json:"lockout" yaml:"lockout"`
+	NewDevice NewDeviceConfig `json:"new_device" yaml:"new_device"`
+	Sessions  SessionsConfig  `json:"sessions" yaml:"sessions"`
+}
+
+// AuditConfig chooses where the audit events are stored, both sinks may be used at once
+type AuditConfig struct {
+	// SQLite stores the events in the service database, it enables the queryAuditEvents nanos
+	SQLite        bool   `json:"sqlite" yaml:"sqlite" env:"AUTH_AUDIT_SQLITE"`
+	JSONLinesPath string `json:"jsonl_path" yaml:"jsonl_path" env:"AUTH_AUDIT_JSONL_PATH"`
+	// Key makes the hash chain an HMAC chain
+	Key string `json:"key" yaml:"key" env:"AUTH_AUDIT_KEY"`
+}
+
+// RateLimitConfig throttles register and signin per source, zero Limit disables it
+type RateLimitConfig struct {
+	Limit  int      `json:"limit" yaml:"limit" env:"AUTH_RATE_LIMIT"`
+	Window Duration `json:"window" yaml:"window" env:"AUTH_RATE_LIMIT_WINDOW"`
+}
+
+// LockoutConfig is the signinUser.LockoutPolicy, zero MaxAttempts disables it
+type LockoutConfig struct {
+	MaxAttempts int      `json:"max_attempts" yaml:"max_attempts" env:"AUTH_LOCKOUT_MAX_ATTEMPTS"`
+	BaseLockout Duration `json:"base_lockout" yaml:"base_lockout" env:"AUTH_LOCKOUT_BASE"`
+	MaxLockout  Duration `json:"max_lockout" yaml:"max_lockout" env:"AUTH_LOCKOUT_MAX"`
+}
+
+// NewDeviceConfig is the signinUser.NewDevicePolicy, it needs the notifier of the service
+type NewDeviceConfig struct {
+	Enabled           bool     `json:"enabled" yaml:"enabled" env:"AUTH_NEW_DEVICE_ENABLED"`
+	RequireStepUp     bool     `json:"require_step_up" yaml:"require_step_up" env:"AUTH_NEW_DEVICE_REQUIRE_STEP_UP"`
+	StepUpTTL         Duration `json:"step_up_ttl" yaml:"step_up_ttl" env:"AUTH_NEW_DEVICE_STEP_UP_TTL"`
+	MaxStepUpAttempts int      `json:"max_step_up_attempts" yaml:"max_step_up_attempts" env:"AUTH_NEW_DEVICE_MAX_STEP_UP_ATTEMPTS"`
+}
+
+// SessionsConfig expires the browser sessions of cookieSession, zero durations never expire
+type SessionsConfig struct {
+	IdleTimeout Duration `json:"idle_timeout" yaml:"idle_timeout" env:"AUTH_SESSION_IDLE_TIMEOUT"`
+	MaxAge      Duration `json:"max_age" yaml:"max_age" env:"AUTH_SESSION_MAX_AGE"`
+}
+
+// The formats of the access tokens, Validate accepts the configured one only
+const (
+	AccessTokenFormatJWT          = validateJWT.FormatJWT
+	AccessTokenFormatOpaque       = validateJWT.FormatOpaque
+	AccessTokenFormatPasetoPublic = validateJWT.FormatPasetoPublic
+	AccessTokenFormatPasetoLocal  = validateJWT.FormatPasetoLocal
+)
+
+// Defaults are used for the zero fields of a Config
+var Defaults = Config{
+	DatabasePath:      "auth.db",
+	TokenHours:        4,
+	AccessTokenFormat: AccessTokenFormatJWT,
+	Workers:           10,
+	QueueCapacity:     100,
+	DeleteGracePeriod: Duration(30 * 24 * time.Hour),
+	PurgeInterval:     Duration(time.Hour),
+}
+
+// LoadConfig reads the YAML or JSON file at path, chosen by its extension, then applies the
+// environment. An empty path only reads the environment.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	if path != "" {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml":
+			err = yaml.UnmarshalStrict(raw, &config)
+		case ".json":
+			err = json.Unmarshal(raw, &config)
+		default:
+			err = fmt.Errorf("config %s must be .yaml, .yml or .json", path)
+		}
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	err := config.ApplyEnv()
+	if err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// ApplyEnv overrides the fields whose environment variable is set
+func (c *Config) ApplyEnv() error {
+	return applyEnv(reflect.ValueOf(c).Elem())
+}
+
+func applyEnv(value reflect.Value) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(Duration(0)) {
+			err := applyEnv(field)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := value.Type().Field(i).Tag.Get("env")
+		raw, ok := os.LookupEnv(name)
+		if name == "" || !ok {
+			continue
+		}
+
+		var err error
+		switch field.Interface().(type) {
+		case string:
+			field.SetString(raw)
+		case int:
+			var n int
+			n, err = strconv.Atoi(raw)
+			field.SetInt(int64(n))
+		case bool:
+			var b bool
+			b, err = strconv.ParseBool(raw)
+			field.SetBool(b)
+		case Duration:
+			var d time.Duration
+			d, err = time.ParseDuration(raw)
+			field.SetInt(int64(d))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// withDefaults returns c with its zero fields taken from Defaults
+func (c Config) withDefaults() Config {
+	if c.DatabasePath == "" {
+		c.DatabasePath = Defaults.DatabasePath
+	}
+	if c.TokenHours == 0 {
+		c.TokenHours = Defaults.TokenHours
+	}
+	if c.AccessTokenFormat == "" {
+		c.AccessTokenFormat = Defaults.AccessTokenFormat
+	}
+	if c.Workers == 0 {
+		c.Workers = Defaults.Workers
+	}
+	if c.QueueCapacity == 0 {
+		c.QueueCapacity = Defaults.QueueCapacity
+	}
+	if c.DeleteGracePeriod == 0 {
+		c.DeleteGracePeriod = Defaults.DeleteGracePeriod
+	}
+	if c.PurgeInterval == 0 {
+		c.PurgeInterval = Defaults.PurgeInterval
+	}
+	return c
+}
+
+// validate refuses configs the nanos can not work with
+func (c Config) validate() error {
+	if c.JWTKey == "" {
+		return errors.New("jwt_key is required")
+	}
+	switch c.AccessTokenFormat {
+	case AccessTokenFormatJWT, AccessTokenFormatOpaque:
+	case AccessTokenFormatPasetoPublic, AccessTokenFormatPasetoLocal:
+		if key, err := hex.DecodeString(c.PasetoKey); err != nil || len(key) != paseto.KeySize {
+			return fmt.Errorf("paseto_key must be %d bytes of hex with access_token_format %s", paseto.KeySize, c.AccessTokenFormat)
+		}
+	default:
+		return fmt.Errorf("access_token_format must be %q, %q, %q or %q", AccessTokenFormatJWT, AccessTokenFormatOpaque, AccessTokenFormatPasetoPublic, AccessTokenFormatPasetoLocal)
+	}
+	if c.RateLimit.Limit > 0 && c.RateLimit.Window <= 0 {
+		return errors.New("rate_limit.window is required with rate_limit.limit")
+	}
+	if c.Lockout.MaxAttempts > 0 && c.Lockout.BaseLockout <= 0 {
+		return errors.New("lockout.base_lockout is required with lockout.max_attempts")
+	}
+	return nil
+}
+
+// Duration is a time.Duration written as "15m" or "1h30m" in YAML, JSON and the environment
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(raw []byte) error {
+	var s string
+	err := json.Unmarshal(raw, &s)
+	if err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	*d = Duration(parsed)
+	return err
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	err := unmarshal(&s)
+	if err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	*d = Duration(parsed)
+	return err
+}
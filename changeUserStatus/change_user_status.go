@@ -0,0 +1,138 @@
+package changeUserStatus
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"strconv"
+	"time"
+)
+
+// Options are the optional policies of the changeUserStatus nanos
+type Options struct {
+	// AuditSink records the audit events, nil records none
+	AuditSink audit.Sink
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+// NewChangeUserStatusNanos returns the admin nanos that activates, suspends or disables accounts.
+// It trusts its callers, so it must only be reachable by admins.
+func NewChangeUserStatusNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	db *sql.DB,
+	options Options,
+) chan nanos.Message {
+
+	worker := &changeUserStatusWorker{
+		db:        db,
+		auditSink: options.AuditSink,
+		now:       time.Now,
+		delivery:  options.Delivery,
+	}
+
+	worker.prepareStore()
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+type changeUserStatusWorker struct {
+	db        *sql.DB
+	auditSink audit.Sink
+	now       func() time.Time
+	delivery  *messages.Delivery
+}
+
+func (w *changeUserStatusWorker) Work(msg nanos.Message) {
+
+	// audit the change whatever its outcome
+	event := audit.Event{Action: audit.ActionChangeStatus, Outcome: audit.OutcomeFailure, Reason: "internal"}
+	defer func() { audit.Record(w.auditSink, event) }()
+
+	// extract content from msg, ActorID is the admin doing the change
+	var content Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &content)
+	}
+	if err != nil {
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	event.Actor = strconv.FormatInt(content.ActorID, 10)
+	event.Subject = strconv.FormatInt(content.UserID, 10)
+	event.Details = map[string]string{"status": content.Status, "reason": content.Reason}
+
+	// validate the change
+	err = w.validate(content.Status, content.Until, content.Reason)
+	if err != nil {
+		event.Reason = "validation_failed"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	var suspendedUntil int64
+	if content.Status == entities.StatusSuspended {
+		suspendedUntil = content.Until.Unix()
+	}
+
+	// saving to db
+	result, err := w.db.Exec("update users set status = ?, status_reason = ?, suspended_until = ? where id = ? and deleted_at = 0", content.Status, content.Reason, suspendedUntil, content.UserID)
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		event.Reason = "not_found"
+		err = entities.ErrUserNotExist
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// sending the response back
+	reply, err := messages.Reply(versioned, msg.Content, Response{Request: content})
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	event.Outcome = audit.OutcomeSuccess
+	event.Reason = ""
+	w.delivery.Reply(msg, reply)
+
+}
+
+func (w *changeUserStatusWorker) prepareStore() {
+	datastores.PrepareUsersTable(w.db)
+}
+
+func (w *changeUserStatusWorker) validate(status string, until time.Time, reason string) error {
+	if reason == "" {
+		return entities.ValidationError("reason", "reason is required")
+	}
+	switch status {
+	case entities.StatusActive, entities.StatusDisabled:
+		return nil
+	case entities.StatusSuspended:
+		if !until.After(w.now()) {
+			return entities.ValidationError("until", "suspension must end in the future")
+		}
+		return nil
+	default:
+		return entities.ValidationError("status", "status must be one of active, suspended, disabled")
+	}
+}
@@ -0,0 +1,148 @@
+package changeUserStatus
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"log"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestChangeUserStatus(t *testing.T) {
+	t.Run("Given invalid changes When change status Then error is returned", testInvalidChanges)
+	t.Run("Given valid changes When change status Then the users table is updated", testValidChanges)
+	t.Run("Given audit sink When change status Then the admin and the change are recorded", testAudited)
+}
+
+type channelSink chan audit.Event
+
+func (s channelSink) Write(event audit.Event) error {
+	s <- event
+	return nil
+}
+
+func testAudited(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	createUserInDB(db)
+	sink := make(channelSink, 10)
+	mailBox := NewChangeUserStatusNanos(1, 10, db, Options{AuditSink: sink})
+
+	err := changeStatus(mailBox, map[string]interface{}{"ActorID": 7, "UserID": 1, "Status": "disabled", "Reason": "fraud"})
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	select {
+	case event := <-sink:
+		if event.Action != audit.ActionChangeStatus || event.Actor != "7" || event.Subject != "1" || event.Outcome != audit.OutcomeSuccess ||
+			event.Details["status"] != "disabled" || event.Details["reason"] != "fraud" {
+			t.Fatalf("\t%s\twrong event -- %+v", failure, event)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("\t%s\tno event recorded", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func createUserInDB(db *sql.DB) {
+	datastores.PrepareUsersTable(db)
+	_, err := db.Exec("insert into users (name, username, password) values ('Bashar', 'bashar_123', '')")
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func changeStatus(mailBox chan nanos.Message, content interface{}) error {
+	rawContent, _ := json.Marshal(content)
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	mailBox <- nanos.Message{Content: rawContent, ResTo: resTo, ErrTo: errTo}
+
+	select {
+	case <-resTo:
+		return nil
+	case err := <-errTo:
+		return err
+	case <-time.After(time.Second * 2):
+		log.Fatal("timeout")
+		return nil
+	}
+}
+
+func testInvalidChanges(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	createUserInDB(db)
+	mailBox := NewChangeUserStatusNanos(1, 10, db, Options{})
+
+	data := []struct {
+		content  map[string]interface{}
+		expected string
+	}{
+		{content: map[string]interface{}{"UserID": 1, "Status": "disabled"}, expected: "reason"},
+		{content: map[string]interface{}{"UserID": 1, "Status": "banned", "Reason": "spam"}, expected: "status must be"},
+		{content: map[string]interface{}{"UserID": 1, "Status": "suspended", "Reason": "spam"}, expected: "future"},
+		{content: map[string]interface{}{"UserID": 1, "Status": "suspended", "Reason": "spam", "Until": time.Now().Add(-time.Hour)}, expected: "future"},
+		{content: map[string]interface{}{"UserID": 2, "Status": "disabled", "Reason": "spam"}, expected: "not exist"},
+	}
+
+	for i := range data {
+		err := changeStatus(mailBox, data[i].content)
+		if err == nil {
+			t.Fatalf("\t%s\tdata[%v] Nanos should return error", failure, i)
+		}
+		matched, _ := regexp.MatchString(data[i].expected, err.Error())
+		if !matched {
+			t.Fatalf("\t%s\tdata[%v] error should contain //%s// -- %v", failure, i, data[i].expected, err)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testValidChanges(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	createUserInDB(db)
+	mailBox := NewChangeUserStatusNanos(1, 10, db, Options{})
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	data := []struct {
+		content        map[string]interface{}
+		status         string
+		reason         string
+		suspendedUntil int64
+	}{
+		{content: map[string]interface{}{"UserID": 1, "Status": "suspended", "Reason": "spam", "Until": until}, status: entities.StatusSuspended, reason: "spam", suspendedUntil: until.Unix()},
+		{content: map[string]interface{}{"UserID": 1, "Status": "disabled", "Reason": "fraud"}, status: entities.StatusDisabled, reason: "fraud"},
+		{content: map[string]interface{}{"UserID": 1, "Status": "active", "Reason": "appeal accepted"}, status: entities.StatusActive, reason: "appeal accepted"},
+	}
+
+	for i := range data {
+		err := changeStatus(mailBox, data[i].content)
+		if err != nil {
+			t.Fatalf("\t%s\tdata[%v] Nanos should not return any error -- %v", failure, i, err)
+		}
+		var status, reason string
+		var suspendedUntil int64
+		err = db.QueryRow("select status, status_reason, suspended_until from users where id = 1").Scan(&status, &reason, &suspendedUntil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != data[i].status || reason != data[i].reason || suspendedUntil != data[i].suspendedUntil {
+			t.Fatalf("\t%s\tdata[%v] stored (%v, %v, %v)", failure, i, status, reason, suspendedUntil)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,34 @@
+package changeUserStatus
+
+import (
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"time"
+)
+
+// Request is the versioned request of the changeUserStatus nanos, ActorID is the admin doing the change
+type Request struct {
+	ActorID int64
+	UserID  int64
+	Status  string
+	// Until is required when suspending
+	Until  time.Time
+	Reason string
+}
+
+// Response is the versioned response of the changeUserStatus nanos, it echoes the applied change
+type Response struct {
+	Request
+}
+
+// NewMessage wraps req into a message for the changeUserStatus nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
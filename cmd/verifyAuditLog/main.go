@@ -0,0 +1,65 @@
+// Command verifyAuditLog walks an audit log written by the audit sinks and reports the first broken link of its hash chain.
+//
+//	verifyAuditLog -sqlite auth.db
+//	AUDIT_KEY=secret verifyAuditLog -jsonl audit.jsonl -key-env AUDIT_KEY
+//
+// It exits with 0 when the chain is intact, 1 when it is broken and 2 on errors.
+//
+// JSON lines logs do not record how many events they hold, so a file whose newest lines were
+// removed is reported intact. Compare its last hash with one kept elsewhere to detect that.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	_ "github.com/mattn/go-sqlite3"
+	"os"
+)
+
+func main() {
+	sqlitePath := flag.String("sqlite", "", "SQLite database holding the audit_events table")
+	jsonlPath := flag.String("jsonl", "", "JSON lines audit file, removing its newest lines is not detected")
+	keyEnv := flag.String("key-env", "", "environment variable holding the HMAC key, empty for unkeyed chains")
+	flag.Parse()
+
+	var key []byte
+	if *keyEnv != "" {
+		key = []byte(os.Getenv(*keyEnv))
+		if len(key) == 0 {
+			fail("environment variable %s is empty", *keyEnv)
+		}
+	}
+
+	var broken *audit.BrokenLink
+	var err error
+	switch {
+	case *sqlitePath != "" && *jsonlPath == "":
+		var db *sql.DB
+		db, err = sql.Open("sqlite3", "file:"+*sqlitePath+"?mode=ro")
+		if err != nil {
+			fail("%v", err)
+		}
+		defer db.Close()
+		broken, err = audit.VerifySQLite(db, key)
+	case *jsonlPath != "" && *sqlitePath == "":
+		broken, err = audit.VerifyJSONLines(*jsonlPath, key)
+	default:
+		fail("exactly one of -sqlite and -jsonl is required")
+	}
+	if err != nil {
+		fail("%v", err)
+	}
+
+	if broken != nil {
+		fmt.Println(broken.Error())
+		os.Exit(1)
+	}
+	fmt.Println("audit log chain is intact")
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(2)
+}
@@ -0,0 +1,277 @@
+package cookieSession
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/authMiddleware"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/revokeSession"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/auth-nanos/validateSession"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Mailboxes are the channels of the nanos behind the sessions
+type Mailboxes struct {
+	Signin          chan nanos.Message
+	ValidateSession chan nanos.Message
+	RevokeSession   chan nanos.Message
+}
+
+// Options configure the cookies of Sessions, zero fields take the defaults
+type Options struct {
+	// CookieName is the HttpOnly session cookie, "session" by default
+	CookieName string
+	// CSRFCookieName is the cookie scripts read the CSRF token from, "csrf_token" by default
+	CSRFCookieName string
+	// CSRFHeader and CSRFField carry the CSRF token of unsafe requests,
+	// "X-CSRF-Token" and the "csrf_token" form field by default
+	CSRFHeader string
+	CSRFField  string
+	// Path is "/" by default
+	Path   string
+	Domain string
+	// MaxAge of the cookies, zero makes them last until the browser closes.
+	// The server side expiry is the one of the validateSession nanos.
+	MaxAge time.Duration
+	// SameSite is http.SameSiteLaxMode by default
+	SameSite http.SameSite
+	// Insecure drops the Secure attribute, only for development over plain http
+	Insecure bool
+}
+
+// Sessions keeps browser sessions in cookies instead of handing JWTs to scripts.
+//
+// Signin sets an HttpOnly, Secure and SameSite cookie holding the session token of a server
+// side session, and a CSRF cookie scripts can read. Handler resolves the session cookie to the
+// claims of its user, read them with authMiddleware.ClaimsFromContext and its accessors.
+//
+// Requests other than GET, HEAD, OPTIONS and TRACE must send the CSRF token of their session
+// in the CSRF header or form field: pages get it from CSRFToken, scripts from the CSRF cookie.
+// The token is derived from the session token, so it needs no storage and another site can not
+// forge it.
+type Sessions struct {
+	mailboxes Mailboxes
+	options   Options
+}
+
+// NewSessions returns the sessions of mailboxes
+func NewSessions(mailboxes Mailboxes, options Options) *Sessions {
+	if options.CookieName == "" {
+		options.CookieName = "session"
+	}
+	if options.CSRFCookieName == "" {
+		options.CSRFCookieName = "csrf_token"
+	}
+	if options.CSRFHeader == "" {
+		options.CSRFHeader = "X-CSRF-Token"
+	}
+	if options.CSRFField == "" {
+		options.CSRFField = "csrf_token"
+	}
+	if options.Path == "" {
+		options.Path = "/"
+	}
+	if options.SameSite == 0 {
+		options.SameSite = http.SameSiteLaxMode
+	}
+	return &Sessions{
+		mailboxes: mailboxes,
+		options:   options,
+	}
+}
+
+// Signin signs the user of req in with a browser session and sets its cookies on w.
+// The device and source of req default to the ones of r. Errors are the *entities.Error of
+// the signin nanos.
+func (s *Sessions) Signin(w http.ResponseWriter, r *http.Request, req signinUser.Request) error {
+	req.Cookie = true
+	if req.Source == "" {
+		req.Source = clientIP(r)
+	}
+	if req.IP == "" {
+		req.IP = clientIP(r)
+	}
+	if req.UserAgent == "" {
+		req.UserAgent = r.UserAgent()
+	}
+
+	res, err := call(r.Context(), s.mailboxes.Signin, "signinUser", req)
+	if err != nil {
+		return err
+	}
+	response, err := signinUser.DecodeResponse(res)
+	if err != nil {
+		return entities.ToError(err)
+	}
+
+	s.setCookies(w, response.SessionToken)
+	return nil
+}
+
+// Signout revokes the session of the cookie of r and clears the cookies, requests without a
+// valid session only get their cookies cleared
+func (s *Sessions) Signout(w http.ResponseWriter, r *http.Request) error {
+	defer s.clearCookies(w)
+
+	claims, _, err := s.claims(r)
+	if err != nil {
+		return nil
+	}
+	_, err = call(r.Context(), s.mailboxes.RevokeSession, "revokeSession", revokeSession.Request{ID: int64(claims.ID), SessionID: claims.SessionID})
+	return err
+}
+
+// Handler resolves the session cookie of the requests of next and checks the CSRF token of
+// their unsafe methods. Requests without a valid session answer 401, requests failing the
+// CSRF check 403, with the {"error": {"code", "message"}} body of the gateway.
+func (s *Sessions) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, sessionToken, err := s.claims(r)
+		if err != nil {
+			switch entities.ToError(err).Code {
+			case entities.CodeTokenInvalid, entities.CodeTokenExpired, entities.CodeAccountSuspended, entities.CodeAccountDisabled:
+				s.clearCookies(w)
+			}
+			writeError(w, err)
+			return
+		}
+
+		csrfToken := newCSRFToken(sessionToken)
+		if !safeMethod(r.Method) && !s.checkCSRF(r, csrfToken) {
+			writeError(w, entities.NewError(entities.CodeForbidden, "CSRF token is missing or invalid"))
+			return
+		}
+
+		// scripts may have lost the CSRF cookie, e.g. after it was cleared by hand
+		if cookie, err := r.Cookie(s.options.CSRFCookieName); err != nil || cookie.Value != csrfToken {
+			http.SetCookie(w, s.cookie(s.options.CSRFCookieName, csrfToken, false))
+		}
+
+		ctx := authMiddleware.NewContext(r.Context(), claims)
+		ctx = context.WithValue(ctx, csrfKey{}, csrfToken)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CSRFToken returns the CSRF token of the session of the request, for the forms of the page.
+// It is empty outside of Handler.
+func CSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfKey{}).(string)
+	return token
+}
+
+// csrfKey is the context key of the CSRF token
+type csrfKey struct{}
+
+// claims returns the claims and the token of the session cookie of r
+func (s *Sessions) claims(r *http.Request) (validateJWT.Claims, string, error) {
+	cookie, err := r.Cookie(s.options.CookieName)
+	if err != nil || cookie.Value == "" {
+		return validateJWT.Claims{}, "", entities.NewError(entities.CodeTokenInvalid, "session cookie is required")
+	}
+
+	res, err := call(r.Context(), s.mailboxes.ValidateSession, "validateSession", validateSession.Request{SessionToken: cookie.Value})
+	if err != nil {
+		return validateJWT.Claims{}, "", err
+	}
+	response, err := validateSession.DecodeResponse(res)
+	if err != nil {
+		return validateJWT.Claims{}, "", entities.ToError(err)
+	}
+	return response.Claims, cookie.Value, nil
+}
+
+// checkCSRF tells if r carries csrfToken in the CSRF header or form field
+func (s *Sessions) checkCSRF(r *http.Request, csrfToken string) bool {
+	sent := r.Header.Get(s.options.CSRFHeader)
+	if sent == "" {
+		sent = r.PostFormValue(s.options.CSRFField)
+	}
+	return sent != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(csrfToken)) == 1
+}
+
+func (s *Sessions) setCookies(w http.ResponseWriter, sessionToken string) {
+	http.SetCookie(w, s.cookie(s.options.CookieName, sessionToken, true))
+	http.SetCookie(w, s.cookie(s.options.CSRFCookieName, newCSRFToken(sessionToken), false))
+}
+
+func (s *Sessions) clearCookies(w http.ResponseWriter) {
+	for _, name := range []string{s.options.CookieName, s.options.CSRFCookieName} {
+		cookie := s.cookie(name, "", name == s.options.CookieName)
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(0, 0)
+		http.SetCookie(w, cookie)
+	}
+}
+
+// cookie returns a cookie with the attributes of the options, scripts can not read httpOnly ones
+func (s *Sessions) cookie(name string, value string, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     s.options.Path,
+		Domain:   s.options.Domain,
+		Secure:   !s.options.Insecure,
+		HttpOnly: httpOnly,
+		SameSite: s.options.SameSite,
+	}
+	if s.options.MaxAge > 0 {
+		cookie.MaxAge = int(s.options.MaxAge.Seconds())
+		cookie.Expires = time.Now().Add(s.options.MaxAge)
+	}
+	return cookie
+}
+
+// newCSRFToken returns the CSRF token of a session, only the holder of the session token can compute it
+func newCSRFToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, []byte(sessionToken))
+	_, _ = mac.Write([]byte("csrf"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// safeMethod tells if method can not change state, as RFC 7231 defines it
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// call sends payload to the nanos behind mailBox, name tells which one is missing
+func call(ctx context.Context, mailBox chan nanos.Message, name string, payload interface{}) (nanos.Message, error) {
+	if mailBox == nil {
+		return nanos.Message{}, entities.NewError(entities.CodeInternal, name+" nanos is not set")
+	}
+	return messages.Call(ctx, mailBox, payload)
+}
+
+// writeError answers with the status of err and its code, field and message
+func writeError(w http.ResponseWriter, err error) {
+	coded := entities.ToError(err)
+	raw, _ := json.Marshal(struct {
+		Error *entities.Error `json:"error"`
+	}{Error: coded})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(entities.HTTPStatus(coded.Code))
+	_, _ = w.Write(raw)
+}
+
+// clientIP returns the IP of the connection, forwarding headers are not trusted
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
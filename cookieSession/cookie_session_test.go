@@ -0,0 +1,176 @@
+package cookieSession
+
+import (
+	"github.com/bashar-saleh/auth-nanos/authMiddleware"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/registerUser"
+	"github.com/bashar-saleh/auth-nanos/revokeSession"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/auth-nanos/validateSession"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestCookieSession(t *testing.T) {
+	t.Run("Given a signin When set its cookies Then they are secure, HttpOnly and SameSite", testCookies)
+	t.Run("Given a browser When signin, browse, post and signout Then the session cookie and CSRF token are checked", testBrowser)
+}
+
+// newSessions registers bashar_123 on test.db and returns the sessions of its nanos
+func newSessions(t *testing.T, options Options) *Sessions {
+	db := datastores.SqliteConnection("test.db")
+	mailboxes := Mailboxes{
+		Signin:          signinUser.NewSigninUserNanos(1, 10, db, "secretKey", 4, nil, nil, signinUser.Options{}),
+		ValidateSession: validateSession.NewValidateSessionNanos(1, 10, db, time.Hour, 0, validateSession.Options{}),
+		RevokeSession:   revokeSession.NewRevokeSessionNanos(1, 10, db, revokeSession.Options{}),
+	}
+	register := registerUser.NewRegisterUserNanos(1, 10, db, nil, nil, nil, nil, nil, registerUser.Options{})
+	_, err := call(httptest.NewRequest("GET", "/", nil).Context(), register, "registerUser", registerUser.Request{User: entities.User{Username: "bashar_123", Password: "bb123123"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSessions(mailboxes, options)
+}
+
+func testCookies(t *testing.T) {
+	sessions := newSessions(t, Options{MaxAge: time.Hour})
+
+	res := httptest.NewRecorder()
+	err := sessions.Signin(res, httptest.NewRequest("POST", "/signin", nil), signinUser.Request{FirstField: "bashar_123", Password: "bb123123"})
+	if err != nil {
+		t.Fatalf("\t%s\tsignin should succeed -- %v", failure, err)
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range res.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	session, csrf := cookies["session"], cookies["csrf_token"]
+	if session == nil || !session.Secure || !session.HttpOnly || session.SameSite != http.SameSiteLaxMode || session.MaxAge != 3600 || session.Path != "/" {
+		t.Fatalf("\t%s\tthe session cookie should be secure, HttpOnly and SameSite -- %+v", failure, session)
+	}
+	if csrf == nil || !csrf.Secure || csrf.HttpOnly || csrf.Value != newCSRFToken(session.Value) {
+		t.Fatalf("\t%s\tthe CSRF cookie should be readable by scripts and hold the token of the session -- %+v", failure, csrf)
+	}
+
+	res = httptest.NewRecorder()
+	err = sessions.Signin(res, httptest.NewRequest("POST", "/signin", nil), signinUser.Request{FirstField: "bashar_123", Password: "wrong"})
+	if entities.ToError(err).Code != entities.CodeInvalidCredentials || len(res.Result().Cookies()) != 0 {
+		t.Fatalf("\t%s\ta failed signin should set no cookie -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testBrowser(t *testing.T) {
+	// plain http test server, so the cookies can not be Secure
+	sessions := newSessions(t, Options{Insecure: true})
+	app := http.NewServeMux()
+	app.HandleFunc("/signin", func(w http.ResponseWriter, r *http.Request) {
+		err := sessions.Signin(w, r, signinUser.Request{FirstField: r.PostFormValue("username"), Password: r.PostFormValue("password")})
+		if err != nil {
+			writeError(w, err)
+		}
+	})
+	app.Handle("/signout", sessions.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = sessions.Signout(w, r)
+	})))
+	app.Handle("/me", sessions.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := authMiddleware.UserID(r.Context())
+		_, _ = w.Write([]byte(strconv.FormatInt(id, 10) + " " + CSRFToken(r.Context())))
+	})))
+	server := httptest.NewServer(app)
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	base, _ := url.Parse(server.URL)
+	csrfToken := func() string {
+		for _, cookie := range jar.Cookies(base) {
+			if cookie.Name == "csrf_token" {
+				return cookie.Value
+			}
+		}
+		return ""
+	}
+	post := func(path string, form url.Values, header string) int {
+		req, _ := http.NewRequest("POST", server.URL+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header != "" {
+			req.Header.Set("X-CSRF-Token", header)
+		}
+		res, err := browser.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	res, _ := browser.Get(server.URL + "/me")
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("\t%s\trequests without session should answer 401 -- %v", failure, res.StatusCode)
+	}
+
+	if status := post("/signin", url.Values{"username": {"bashar_123"}, "password": {"bb123123"}}, ""); status != http.StatusOK {
+		t.Fatalf("\t%s\tsignin should succeed -- %v", failure, status)
+	}
+	res, _ = browser.Get(server.URL + "/me")
+	body := make([]byte, 256)
+	n, _ := res.Body.Read(body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body[:n]) != "1 "+csrfToken() {
+		t.Fatalf("\t%s\tsafe requests should reach the handler with the claims and CSRF token -- %v %s", failure, res.StatusCode, body[:n])
+	}
+
+	data := []struct {
+		form   url.Values
+		header string
+		status int
+	}{
+		{status: http.StatusForbidden},
+		{header: "forged", status: http.StatusForbidden},
+		{form: url.Values{"csrf_token": {"forged"}}, status: http.StatusForbidden},
+		{header: csrfToken(), status: http.StatusOK},
+		{form: url.Values{"csrf_token": {csrfToken()}}, status: http.StatusOK},
+	}
+	for i := range data {
+		if status := post("/me", data[i].form, data[i].header); status != data[i].status {
+			t.Fatalf("\t%s\tdata[%v] should answer %v -- %v", failure, i, data[i].status, status)
+		}
+	}
+
+	signedIn := jar.Cookies(base)
+	if status := post("/signout", nil, csrfToken()); status != http.StatusOK {
+		t.Fatalf("\t%s\tsignout should succeed -- %v", failure, status)
+	}
+	if csrfToken() != "" {
+		t.Fatalf("\t%s\tsignout should clear the cookies", failure)
+	}
+	// a copy of the cookie kept by another tab or an attacker is refused too
+	req, _ := http.NewRequest("GET", server.URL+"/me", nil)
+	for _, cookie := range signedIn {
+		req.AddCookie(cookie)
+	}
+	res, _ = http.DefaultClient.Do(req)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("\t%s\tthe session should be revoked by signout -- %v", failure, res.StatusCode)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,83 @@
+package datastores
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"log"
+	"time"
+)
+
+// PrepareAccessTokensTable creates the access_tokens table of opaque access tokens when missing.
+// The tokens are never stored, only their SHA-256 hash.
+func PrepareAccessTokensTable(db *sql.DB) {
+	stmt := `
+			create table if not exists access_tokens (
+			    	token_hash text not null primary key,
+			    	user_id integer not null,
+			    	session_id text not null default '',
+			    	roles text not null default '',
+			    	issued_at integer not null,
+			    	expires_at integer not null
+			                    );
+			create index if not exists access_tokens_expires_at on access_tokens (expires_at);`
+	_, err := db.Exec(stmt)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// CreateAccessToken stores a new opaque access token of the user and returns it.
+// The expired tokens of the user are dropped on the way, so the table does not grow with signins.
+func CreateAccessToken(ctx context.Context, db *sql.DB, record entities.AccessToken) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	_, err = db.ExecContext(ctx, "delete from access_tokens where user_id = ? and expires_at <= ?", record.UserID, record.IssuedAt.Unix())
+	if err != nil {
+		return "", err
+	}
+	rawRoles := ""
+	if len(record.Roles) > 0 {
+		raw, err := json.Marshal(record.Roles)
+		if err != nil {
+			return "", err
+		}
+		rawRoles = string(raw)
+	}
+
+	_, err = db.ExecContext(ctx, "insert into access_tokens (token_hash, user_id, session_id, roles, issued_at, expires_at) values (?, ?, ?, ?, ?, ?)",
+		HashToken(token), record.UserID, record.SessionID, rawRoles, record.IssuedAt.Unix(), record.ExpiresAt.Unix())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// AccessTokenByToken returns the record of an opaque access token, expired ones included,
+// entities.ErrAccessTokenNotExist when it is unknown
+func AccessTokenByToken(ctx context.Context, db *sql.DB, token string) (entities.AccessToken, error) {
+	var record entities.AccessToken
+	var rawRoles string
+	var issuedAt, expiresAt int64
+	err := db.QueryRowContext(ctx, "SELECT user_id, session_id, roles, issued_at, expires_at FROM access_tokens WHERE token_hash = ?", HashToken(token)).
+		Scan(&record.UserID, &record.SessionID, &rawRoles, &issuedAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return entities.AccessToken{}, entities.ErrAccessTokenNotExist
+	}
+	if err != nil {
+		return entities.AccessToken{}, err
+	}
+
+	if rawRoles != "" {
+		err = json.Unmarshal([]byte(rawRoles), &record.Roles)
+		if err != nil {
+			return entities.AccessToken{}, err
+		}
+	}
+	record.IssuedAt = time.Unix(issuedAt, 0).UTC()
+	record.ExpiresAt = time.Unix(expiresAt, 0).UTC()
+	return record, nil
+}
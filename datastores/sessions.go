@@ -0,0 +1,278 @@
+package datastores
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"log"
+	"time"
+)
+
+// sessionsColumns are the columns added to the sessions table after its first version
+var sessionsColumns = []Column{
+	// cookie_token_hash is the hash of the cookie of browser sessions, empty for token sessions
+	{Name: "cookie_token_hash", Definition: "text not null default ''"},
+}
+
+// PrepareSessionsTable creates the sessions and spent_refresh_tokens tables when missing and adds
+// the columns older tables lack. Refresh and cookie tokens are never stored, only their SHA-256 hash.
+func PrepareSessionsTable(db *sql.DB) {
+	stmt := `
+			create table if not exists sessions (
+			    	id text not null primary key,
+			    	user_id integer not null,
+			    	created_at integer not null,
+			    	last_used_at integer not null,
+			    	user_agent text not null default '',
+			    	ip text not null default '',
+			    	refresh_token_hash text not null,
+			    	revoked_at integer not null default 0
+			                    );
+			create index if not exists sessions_user_id on sessions (user_id, revoked_at);`
+	_, err := db.Exec(stmt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	AddMissingColumns(db, "sessions", sessionsColumns)
+	_, err = db.Exec("create index if not exists sessions_cookie_token_hash on sessions (cookie_token_hash)")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// spent_refresh_tokens keeps the hashes of rotated refresh tokens to detect their replay
+	stmt = `
+			create table if not exists spent_refresh_tokens (
+			    	token_hash text not null primary key,
+			    	session_id text not null,
+			    	user_id integer not null,
+			    	spent_at integer not null
+			                    );`
+	_, err = db.Exec(stmt)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// RandomToken returns size random bytes encoded with base64url
+func RandomToken(size int) (string, error) {
+	raw := make([]byte, size)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// HashToken returns the hex SHA-256 of a token, the form tokens are stored in
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession stores a new session of the user and returns it with the refresh token bound to it
+func CreateSession(ctx context.Context, db *sql.DB, userID int64, userAgent string, ip string, now time.Time) (entities.Session, string, error) {
+	id, err := RandomToken(16)
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+	refreshToken, err := RandomToken(32)
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+
+	_, err = db.ExecContext(ctx, "insert into sessions (id, user_id, created_at, last_used_at, user_agent, ip, refresh_token_hash) values (?, ?, ?, ?, ?, ?, ?)",
+		id, userID, now.Unix(), now.Unix(), userAgent, ip, HashToken(refreshToken))
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+
+	session := entities.Session{
+		ID:         id,
+		UserID:     userID,
+		CreatedAt:  time.Unix(now.Unix(), 0).UTC(),
+		LastUsedAt: time.Unix(now.Unix(), 0).UTC(),
+		UserAgent:  userAgent,
+		IP:         ip,
+	}
+	return session, refreshToken, nil
+}
+
+// CreateCookieSession stores a new browser session of the user and returns it with the cookie token
+// bound to it. Its refresh token is never handed out, so only the cookie can use the session.
+func CreateCookieSession(ctx context.Context, db *sql.DB, userID int64, userAgent string, ip string, now time.Time) (entities.Session, string, error) {
+	session, _, err := CreateSession(ctx, db, userID, userAgent, ip, now)
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+	cookieToken, err := RandomToken(32)
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+
+	_, err = db.ExecContext(ctx, "update sessions set cookie_token_hash = ? where id = ?", HashToken(cookieToken), session.ID)
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+	return session, cookieToken, nil
+}
+
+// SessionByCookieToken returns the active session the cookie token is bound to,
+// entities.ErrSessionRevoked when there is none
+func SessionByCookieToken(ctx context.Context, db *sql.DB, cookieToken string) (entities.Session, error) {
+	var session entities.Session
+	var createdAt, lastUsedAt int64
+	err := db.QueryRowContext(ctx, "SELECT id, user_id, created_at, last_used_at, user_agent, ip FROM sessions WHERE cookie_token_hash = ? AND revoked_at = 0", HashToken(cookieToken)).
+		Scan(&session.ID, &session.UserID, &createdAt, &lastUsedAt, &session.UserAgent, &session.IP)
+	if err == sql.ErrNoRows {
+		return entities.Session{}, entities.ErrSessionRevoked
+	}
+	if err != nil {
+		return entities.Session{}, err
+	}
+	session.CreatedAt = time.Unix(createdAt, 0).UTC()
+	session.LastUsedAt = time.Unix(lastUsedAt, 0).UTC()
+	return session, nil
+}
+
+// TouchSession marks the session as used now, entities.ErrSessionRevoked when it is revoked or missing
+func TouchSession(ctx context.Context, db *sql.DB, id string, userID int64, now time.Time) error {
+	result, err := db.ExecContext(ctx, "update sessions set last_used_at = ? where id = ? and user_id = ? and revoked_at = 0", now.Unix(), id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return entities.ErrSessionRevoked
+	}
+	return nil
+}
+
+// RotateSession replaces the refresh token of the active session it belongs to and returns the session
+// with the new refresh token, entities.ErrSessionRevoked when no active session has it.
+// allow, when set, is called with the owner of the session before the rotation; its error is returned
+// and the token is kept.
+//
+// The replaced token is kept as spent and can not be used again: presenting a spent token, or racing
+// concurrent calls with the same token, revokes the session as the token was replayed.
+func RotateSession(ctx context.Context, db *sql.DB, refreshToken string, now time.Time, allow func(userID int64) error) (entities.Session, string, error) {
+	newRefreshToken, err := RandomToken(32)
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+
+	var session entities.Session
+	var createdAt int64
+	err = db.QueryRowContext(ctx, "SELECT id, user_id, created_at, user_agent, ip FROM sessions WHERE refresh_token_hash = ? AND revoked_at = 0", HashToken(refreshToken)).
+		Scan(&session.ID, &session.UserID, &createdAt, &session.UserAgent, &session.IP)
+	if err == sql.ErrNoRows {
+		return entities.Session{}, "", revokeSpent(ctx, db, refreshToken, now)
+	}
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+
+	if allow != nil {
+		err = allow(session.UserID)
+		if err != nil {
+			return entities.Session{}, "", err
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+	defer tx.Rollback()
+
+	// the token must still be the one of the session, another call may have rotated it meanwhile
+	result, err := tx.ExecContext(ctx, "update sessions set refresh_token_hash = ?, last_used_at = ? where id = ? and refresh_token_hash = ? and revoked_at = 0",
+		HashToken(newRefreshToken), now.Unix(), session.ID, HashToken(refreshToken))
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+	if affected == 0 {
+		_, err = tx.ExecContext(ctx, "update sessions set revoked_at = ? where id = ? and revoked_at = 0", now.Unix(), session.ID)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			return entities.Session{}, "", err
+		}
+		return entities.Session{}, "", entities.ErrSessionRevoked
+	}
+	_, err = tx.ExecContext(ctx, "insert or ignore into spent_refresh_tokens (token_hash, session_id, user_id, spent_at) values (?, ?, ?, ?)",
+		HashToken(refreshToken), session.ID, session.UserID, now.Unix())
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return entities.Session{}, "", err
+	}
+
+	session.CreatedAt = time.Unix(createdAt, 0).UTC()
+	session.LastUsedAt = time.Unix(now.Unix(), 0).UTC()
+	return session, newRefreshToken, nil
+}
+
+// revokeSpent revokes the session of a spent refresh token, one of its holders replayed it.
+// It returns entities.ErrSessionRevoked for spent and unknown tokens alike.
+func revokeSpent(ctx context.Context, db *sql.DB, refreshToken string, now time.Time) error {
+	_, err := db.ExecContext(ctx, "update sessions set revoked_at = ? where revoked_at = 0 and id = (select session_id from spent_refresh_tokens where token_hash = ?)",
+		now.Unix(), HashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	return entities.ErrSessionRevoked
+}
+
+// ListSessions returns the active sessions of the user, most recently used first
+func ListSessions(db *sql.DB, userID int64) ([]entities.Session, error) {
+	rows, err := db.Query("SELECT id, user_id, created_at, last_used_at, user_agent, ip FROM sessions WHERE user_id = ? AND revoked_at = 0 ORDER BY last_used_at DESC, created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []entities.Session{}
+	for rows.Next() {
+		var session entities.Session
+		var createdAt, lastUsedAt int64
+		err = rows.Scan(&session.ID, &session.UserID, &createdAt, &lastUsedAt, &session.UserAgent, &session.IP)
+		if err != nil {
+			return nil, err
+		}
+		session.CreatedAt = time.Unix(createdAt, 0).UTC()
+		session.LastUsedAt = time.Unix(lastUsedAt, 0).UTC()
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes a session of the user, entities.ErrSessionNotExist when there is no such active session
+func RevokeSession(db *sql.DB, id string, userID int64, now time.Time) error {
+	result, err := db.Exec("update sessions set revoked_at = ? where id = ? and user_id = ? and revoked_at = 0", now.Unix(), id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return entities.ErrSessionNotExist
+	}
+	return nil
+}
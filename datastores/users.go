@@ -0,0 +1,195 @@
+package datastores
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"log"
+	"time"
+)
+
+// usersColumns are the columns added to the users table after its first version.
+// Tables created by older versions get them on PrepareUsersTable.
+var usersColumns = []Column{
+	{Name: "status", Definition: "text not null default 'active'"},
+	{Name: "status_reason", Definition: "text not null default ''"},
+	{Name: "suspended_until", Definition: "integer not null default 0"},
+	{Name: "email_verified", Definition: "integer not null default 0"},
+	{Name: "phone_verified", Definition: "integer not null default 0"},
+	{Name: "deleted_at", Definition: "integer not null default 0"},
+	{Name: "identifiers_released_at", Definition: "integer not null default 0"},
+	{Name: "created_at", Definition: "integer not null default 0"},
+}
+
+// PrepareUsersTable creates the users table when missing and adds the columns older tables lack
+func PrepareUsersTable(db *sql.DB) {
+
+	// create users table
+	stmt := `
+			create table if not exists users (
+			    	id integer not null primary key autoincrement, 
+			    	name text,
+			    	username text,
+			    	password text,
+			    	email text,
+			    	phone text,
+			    	roles text
+			                    );`
+	_, err := db.Exec(stmt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	AddMissingColumns(db, "users", usersColumns)
+}
+
+// Column is a column added to a table after its first version
+type Column struct {
+	Name       string
+	Definition string
+}
+
+// AddMissingColumns adds the columns table lacks, it exits on errors like the Prepare functions
+func AddMissingColumns(db *sql.DB, table string, columns []Column) {
+
+	// find existing columns
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		log.Fatal(err)
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var cid int
+		var name, columnType string
+		var notNull, pk int
+		var defaultValue sql.NullString
+		err = rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk)
+		if err != nil {
+			log.Fatal(err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	// add missing columns
+	for _, column := range columns {
+		if existing[column.Name] {
+			continue
+		}
+		_, err = db.Exec("alter table " + table + " add column " + column.Name + " " + column.Definition)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// UserConflicts returns a *entities.ConflictError naming the fields of user that another user already uses.
+// The user with id exceptID is ignored, so a user does not conflict with itself.
+// Deleted users keep their identifiers until their grace period ends.
+func UserConflicts(db *sql.DB, user entities.User, exceptID int64) error {
+	return UserConflictsContext(context.Background(), db, user, exceptID)
+}
+
+// UserConflictsContext is UserConflicts with the context of the request
+func UserConflictsContext(ctx context.Context, db *sql.DB, user entities.User, exceptID int64) error {
+	q := "SELECT username, email, phone FROM users WHERE (id != ?) AND (identifiers_released_at = 0 OR identifiers_released_at > ?) AND ("
+	qValus := []interface{}{exceptID, time.Now().Unix()}
+
+	if user.Username != "" {
+		q += "(username = ?) "
+		qValus = append(qValus, user.Username)
+	} else {
+		q += "(0 = 1) "
+	}
+	if user.Email != "" {
+		q += "OR (email = ?) "
+		qValus = append(qValus, user.Email)
+	} else {
+		q += "OR (1 = 0) "
+	}
+	if user.Phone != "" {
+		q += "OR (phone = ?) "
+		qValus = append(qValus, user.Phone)
+	} else {
+		q += "OR (1 = 0) "
+	}
+	q += ")"
+
+	rows, err := db.QueryContext(ctx, q, qValus...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	conflicts := map[string]bool{}
+	for rows.Next() {
+		var username string
+		var email string
+		var phone string
+		err := rows.Scan(&username, &email, &phone)
+		if err != nil {
+			return err
+		}
+		conflicts["username"] = conflicts["username"] || (user.Username != "" && username == user.Username)
+		conflicts["email"] = conflicts["email"] || (user.Email != "" && email == user.Email)
+		conflicts["phone"] = conflicts["phone"] || (user.Phone != "" && phone == user.Phone)
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	var fields []string
+	for _, field := range []string{"username", "email", "phone"} {
+		if conflicts[field] {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) > 0 {
+		return &entities.ConflictError{Fields: fields}
+	}
+	return nil
+}
+
+// UsersSelection lists the users columns scanned by ScanUser
+const UsersSelection = "id, name, username, email, phone, roles, status, email_verified, phone_verified, created_at"
+
+// Scanner is implemented by *sql.Row and *sql.Rows
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ScanUser reads a row selected with UsersSelection, the password is never read
+func ScanUser(row Scanner) (entities.User, error) {
+	var user entities.User
+	var name, username, email, phone, rawRoles sql.NullString
+	var createdAt int64
+	err := row.Scan(&user.ID, &name, &username, &email, &phone, &rawRoles, &user.Status, &user.EmailVerified, &user.PhoneVerified, &createdAt)
+	if err != nil {
+		return entities.User{}, err
+	}
+	if createdAt != 0 {
+		user.CreatedAt = time.Unix(createdAt, 0).UTC()
+	}
+	user.Name = name.String
+	user.Username = username.String
+	user.Email = email.String
+	user.Phone = phone.String
+	if rawRoles.String != "" {
+		err = json.Unmarshal([]byte(rawRoles.String), &user.Roles)
+		if err != nil {
+			return entities.User{}, err
+		}
+	}
+	return user, nil
+}
+
+// FindUserByID returns the user without its password, entities.ErrUserNotExist when missing or deleted
+func FindUserByID(db *sql.DB, id int64) (entities.User, error) {
+	user, err := ScanUser(db.QueryRow("SELECT "+UsersSelection+" FROM users WHERE id = ? AND deleted_at = 0", id))
+	if err == sql.ErrNoRows {
+		return entities.User{}, entities.ErrUserNotExist
+	}
+	return user, err
+}
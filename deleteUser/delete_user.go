@@ -0,0 +1,149 @@
+package deleteUser
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"strconv"
+	"time"
+)
+
+// Options are the optional policies of the deleteUser nanos
+type Options struct {
+	// AuditSink records the audit events, nil records none
+	AuditSink audit.Sink
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+// NewDeleteUserNanos returns the nanos that soft-deletes the signed in user.
+// Its content is the claims replied by the validateJWT nanos.
+//
+// A deleted user can not sign in and its tokens are refused by validateJWT nanos that check the status.
+// Its sessions are revoked and its opaque access tokens removed with it.
+// Its username, email and phone stay reserved for gracePeriod, then they can be registered again.
+// The row itself is removed later by Purge.
+func NewDeleteUserNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	db *sql.DB,
+	gracePeriod time.Duration,
+	options Options,
+) chan nanos.Message {
+
+	worker := &deleteUserWorker{
+		db:          db,
+		gracePeriod: gracePeriod,
+		auditSink:   options.AuditSink,
+		now:         time.Now,
+		delivery:    options.Delivery,
+	}
+
+	worker.prepareStore()
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+type deleteUserWorker struct {
+	db          *sql.DB
+	gracePeriod time.Duration
+	auditSink   audit.Sink
+	now         func() time.Time
+	delivery    *messages.Delivery
+}
+
+func (w *deleteUserWorker) Work(msg nanos.Message) {
+
+	// audit the deletion whatever its outcome
+	event := audit.Event{Action: audit.ActionDelete, Outcome: audit.OutcomeFailure, Reason: "internal"}
+	defer func() { audit.Record(w.auditSink, event) }()
+
+	// extract claims from msg
+	var claims Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &claims)
+	}
+	if err == nil && claims.ID == 0 {
+		err = errors.New("claims has no id")
+	}
+	if err != nil {
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	event.Subject = strconv.FormatInt(claims.ID, 10)
+	event.Actor = event.Subject
+
+	// mark the user as deleted and end its sessions
+	err = w.softDelete(claims.ID, w.now())
+	if err == entities.ErrUserNotExist {
+		event.Reason = "not_found"
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// sending the response back
+	reply, err := messages.Reply(versioned, nil, Response{})
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	event.Outcome = audit.OutcomeSuccess
+	event.Reason = ""
+	w.delivery.Reply(msg, reply)
+
+}
+
+func (w *deleteUserWorker) prepareStore() {
+	datastores.PrepareUsersTable(w.db)
+	datastores.PrepareSessionsTable(w.db)
+	datastores.PrepareAccessTokensTable(w.db)
+}
+
+// softDelete marks the user as deleted, revokes its sessions and drops its opaque access tokens
+// in one transaction, entities.ErrUserNotExist when it is missing or already deleted
+func (w *deleteUserWorker) softDelete(id int64, now time.Time) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("update users set deleted_at = ?, identifiers_released_at = ? where id = ? and deleted_at = 0",
+		now.Unix(), now.Add(w.gracePeriod).Unix(), id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return entities.ErrUserNotExist
+	}
+
+	_, err = tx.Exec("update sessions set revoked_at = ? where user_id = ? and revoked_at = 0", now.Unix(), id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("delete from access_tokens where user_id = ?", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,198 @@
+package deleteUser
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestDeleteUser(t *testing.T) {
+	t.Run("Given a user When delete it Then it is not found anymore", testSoftDelete)
+	t.Run("Given a deleted user When its grace period ends Then its identifiers are free again", testIdentifiersRelease)
+	t.Run("Given deleted users When purge Then the rows past retention are removed", testPurge)
+}
+
+func prepareDB() *sql.DB {
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareUsersTable(db)
+	_, err := db.Exec(`insert into users (name, username, password, email, phone, roles) values
+			('Bashar', 'bashar_123', '', 'bashar@example.com', '+963', ''),
+			('Roba', 'roba_123', '', 'roba@example.com', '+964', '')`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+func deleteUser(mailBox chan nanos.Message, claims string) error {
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	mailBox <- nanos.Message{Content: []byte(claims), ResTo: resTo, ErrTo: errTo}
+
+	select {
+	case <-resTo:
+		return nil
+	case err := <-errTo:
+		return err
+	case <-time.After(time.Second * 2):
+		return errors.New("timeout")
+	}
+}
+
+func testSoftDelete(t *testing.T) {
+	db := prepareDB()
+	mailBox := NewDeleteUserNanos(1, 10, db, time.Hour, Options{})
+	session, _, err := datastores.CreateSession(context.Background(), db, 1, "Firefox", "10.0.0.1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := datastores.CreateAccessToken(context.Background(), db, entities.AccessToken{UserID: 1, SessionID: session.ID, IssuedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = deleteUser(mailBox, `{"id":1}`)
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	_, err = datastores.FindUserByID(db, 1)
+	if err != entities.ErrUserNotExist {
+		t.Fatalf("\t%s\tdeleted user should not be found -- %v", failure, err)
+	}
+	var count int
+	_ = db.QueryRow("select count(*) from users where id = 1 and deleted_at != 0").Scan(&count)
+	if count != 1 {
+		t.Fatalf("\t%s\tthe row should be kept until purge", failure)
+	}
+	_ = db.QueryRow("select count(*) from sessions where user_id = 1 and revoked_at = 0").Scan(&count)
+	if count != 0 {
+		t.Fatalf("\t%s\tthe sessions of the deleted user should be revoked", failure)
+	}
+	_, err = datastores.AccessTokenByToken(context.Background(), db, token)
+	if err != entities.ErrAccessTokenNotExist {
+		t.Fatalf("\t%s\tthe access tokens of the deleted user should be removed -- %v", failure, err)
+	}
+
+	for _, claims := range []string{`{"id":1}`, `{"id":3}`} {
+		err = deleteUser(mailBox, claims)
+		if err != entities.ErrUserNotExist {
+			t.Fatalf("\t%s\t%s should not be deleted -- %v", failure, claims, err)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testIdentifiersRelease(t *testing.T) {
+	db := prepareDB()
+	reserved := NewDeleteUserNanos(1, 10, db, time.Hour, Options{})
+	released := NewDeleteUserNanos(1, 10, db, 0, Options{})
+
+	if err := deleteUser(reserved, `{"id":1}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteUser(released, `{"id":2}`); err != nil {
+		t.Fatal(err)
+	}
+
+	err := datastores.UserConflicts(db, entities.User{Username: "bashar_123"}, 0)
+	if _, ok := err.(*entities.ConflictError); !ok {
+		t.Fatalf("\t%s\tidentifiers should stay reserved during the grace period -- %v", failure, err)
+	}
+	err = datastores.UserConflicts(db, entities.User{Username: "roba_123", Email: "roba@example.com"}, 0)
+	if err != nil {
+		t.Fatalf("\t%s\tidentifiers should be free after the grace period -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testPurge(t *testing.T) {
+	db := prepareDB()
+	now := time.Now()
+
+	// the rows of the users in the tables of the other nanos
+	datastores.PrepareSessionsTable(db)
+	datastores.PrepareAccessTokensTable(db)
+	_, err := db.Exec(`
+			create table signin_attempts (user_id integer not null primary key);
+			create table known_devices (user_id integer not null);
+			create table step_up_challenges (user_id integer not null);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range []int64{1, 2} {
+		session, refreshToken, err := datastores.CreateSession(context.Background(), db, userID, "Firefox", "10.0.0.1", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = datastores.RotateSession(context.Background(), db, refreshToken, now, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = datastores.CreateAccessToken(context.Background(), db, entities.AccessToken{UserID: userID, SessionID: session.ID, IssuedAt: now, ExpiresAt: now.Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range []string{"signin_attempts", "known_devices", "step_up_challenges"} {
+			_, err = db.Exec("insert into "+table+" (user_id) values (?)", userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	_, err = db.Exec("update users set deleted_at = ? where id = 1", now.Add(-48*time.Hour).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("update users set deleted_at = ? where id = 2", now.Add(-time.Hour).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := Purge(db, 24*time.Hour, now)
+	if err != nil || purged != 1 {
+		t.Fatalf("\t%s\tone user should be purged -- %v %v", failure, purged, err)
+	}
+	for _, table := range userTables {
+		var purgedRows, keptRows int
+		_ = db.QueryRow("select count(*) from " + table + " where user_id = 1").Scan(&purgedRows)
+		_ = db.QueryRow("select count(*) from " + table + " where user_id = 2").Scan(&keptRows)
+		if purgedRows != 0 || keptRows != 1 {
+			t.Fatalf("\t%s\tthe %s rows of the purged user only should be removed -- %v %v", failure, table, purgedRows, keptRows)
+		}
+	}
+
+	// the background job removes the other one once retention is short enough
+	stop := make(chan struct{})
+	StartPurging(db, time.Minute, 10*time.Millisecond, stop)
+	defer close(stop)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var count int
+		_ = db.QueryRow("select count(*) from users").Scan(&count)
+		if count == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("\t%s\tthe purge job should remove all deleted users -- %v left", failure, count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
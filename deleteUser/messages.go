@@ -0,0 +1,27 @@
+package deleteUser
+
+import (
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the deleteUser nanos, claims replied by validateJWT can be sent as they are
+type Request struct {
+	// ID is the id of the validated claims
+	ID int64 `json:"id"`
+}
+
+// Response is the versioned response of the deleteUser nanos
+type Response struct{}
+
+// NewMessage wraps req into a message for the deleteUser nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
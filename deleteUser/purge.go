@@ -0,0 +1,72 @@
+package deleteUser
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// userTables are the tables with rows of a user, they are purged with it when they exist
+var userTables = []string{"signin_attempts", "known_devices", "step_up_challenges", "access_tokens", "spent_refresh_tokens", "sessions"}
+
+// Purge hard-deletes the users soft-deleted before now minus retention, with every row referencing them,
+// and returns how many were removed
+func Purge(db *sql.DB, retention time.Duration, now time.Time) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	threshold := now.Add(-retention).Unix()
+
+	// drop the rows of the purged users in the tables other nanos created
+	for _, table := range userTables {
+		var name string
+		err = tx.QueryRow("select name from sqlite_master where name = ? and type='table'", table).Scan(&name)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec("delete from "+table+" where user_id in (select id from users where deleted_at != 0 and deleted_at <= ?)", threshold)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec("delete from users where deleted_at != 0 and deleted_at <= ?", threshold)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, tx.Commit()
+}
+
+// StartPurging runs Purge every interval in the background until stop is closed
+func StartPurging(db *sql.DB, retention time.Duration, interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				purged, err := Purge(db, retention, now)
+				if err != nil {
+					log.Println("purging deleted users:", err)
+					continue
+				}
+				if purged > 0 {
+					log.Printf("purged %d deleted users", purged)
+				}
+			}
+		}
+	}()
+}
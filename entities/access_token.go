@@ -0,0 +1,15 @@
+package entities
+
+import "time"
+
+// AccessToken is the server side record of an opaque access token, its token is only stored hashed
+type AccessToken struct {
+	UserID    int64
+	Roles     []string
+	SessionID string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// ErrAccessTokenNotExist is returned when an opaque access token is unknown
+var ErrAccessTokenNotExist error = NewError(CodeTokenInvalid, "token is not valid")
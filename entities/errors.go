@@ -0,0 +1,146 @@
+package entities
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// Error codes, they are stable so callers can map them to statuses and localized messages
+const (
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeValidationFailed   = "validation_failed"
+	CodeAlreadyExists      = "already_exists"
+	CodeTokenExpired       = "token_expired"
+	CodeTokenInvalid       = "token_invalid"
+	CodeLocked             = "locked"
+	CodeInternal           = "internal"
+	CodeBadRequest         = "bad_request"
+	CodeNotFound           = "not_found"
+	CodeRateLimited        = "rate_limited"
+	CodeAccountSuspended   = "account_suspended"
+	CodeAccountDisabled    = "account_disabled"
+	CodeStepUpRequired     = "step_up_required"
+	CodeStepUpFailed       = "step_up_failed"
+	CodeCancelled          = "cancelled"
+	CodeDeadlineExceeded   = "deadline_exceeded"
+	CodeUnavailable        = "unavailable"
+	CodeForbidden          = "forbidden"
+)
+
+// Error is what every nanos sends on ErrTo.
+// Field names the invalid input for validation_failed and the used fields for already_exists.
+// Err keeps the underlying error, e.g. *ConflictError, for Causes and for logging.
+type Error struct {
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+	Err     error  `json:"-"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError returns an *Error with code and message
+func NewError(code string, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// WrapError returns an *Error with code that keeps err and its message
+func WrapError(code string, err error) *Error {
+	return &Error{Code: code, Message: err.Error(), Err: err}
+}
+
+// Causes returns err followed by the errors it wraps, found through their Unwrap method.
+// Callers range over it with type assertions, go.mod targets Go 1.12 which has no errors.As.
+func Causes(err error) []error {
+	var causes []error
+	for err != nil {
+		causes = append(causes, err)
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = wrapper.Unwrap()
+	}
+	return causes
+}
+
+// BadRequest returns err as a bad_request *Error unless it already is an *Error
+func BadRequest(err error) *Error {
+	for _, cause := range Causes(err) {
+		if coded, ok := cause.(*Error); ok {
+			return coded
+		}
+	}
+	return WrapError(CodeBadRequest, err)
+}
+
+// ValidationError returns the validation_failed error of field
+func ValidationError(field string, message string) *Error {
+	return &Error{Code: CodeValidationFailed, Field: field, Message: message}
+}
+
+// ToError returns err as an *Error. Errors with an ErrorCode method keep their message,
+// context errors are cancelled or deadline_exceeded, malformed JSON is a bad_request
+// and any other error is internal with its details hidden.
+func ToError(err error) *Error {
+	causes := Causes(err)
+	for _, cause := range causes {
+		if coded, ok := cause.(*Error); ok {
+			return coded
+		}
+	}
+
+	for _, cause := range causes {
+		withCode, ok := cause.(interface {
+			error
+			ErrorCode() string
+		})
+		if !ok {
+			continue
+		}
+		e := WrapError(withCode.ErrorCode(), err)
+		if conflict, ok := withCode.(*ConflictError); ok {
+			e.Field = strings.Join(conflict.Fields, ",")
+		}
+		return e
+	}
+
+	for _, cause := range causes {
+		switch cause.(type) {
+		case *json.SyntaxError, *json.UnmarshalTypeError:
+			return WrapError(CodeBadRequest, err)
+		}
+		switch cause {
+		case context.Canceled:
+			return WrapError(CodeCancelled, err)
+		case context.DeadlineExceeded:
+			return WrapError(CodeDeadlineExceeded, err)
+		}
+	}
+
+	return &Error{Code: CodeInternal, Message: "internal error", Err: err}
+}
+
+// ConflictError tells which submitted fields are already used by another user.
+// It never carries the other user's data.
+type ConflictError struct {
+	Fields []string
+}
+
+func (e *ConflictError) Error() string {
+	return strings.Join(e.Fields, ", ") + " is exist before"
+}
+
+func (e *ConflictError) ErrorCode() string {
+	return CodeAlreadyExists
+}
+
+// ErrUserNotExist is returned when the requested user is not in the store
+var ErrUserNotExist error = NewError(CodeNotFound, "user is not exist")
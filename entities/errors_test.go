@@ -0,0 +1,78 @@
+package entities
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+type codedError struct{}
+
+func (codedError) Error() string     { return "limited" }
+func (codedError) ErrorCode() string { return CodeRateLimited }
+
+type wrappedError struct{ err error }
+
+func (e wrappedError) Error() string { return "checking: " + e.err.Error() }
+func (e wrappedError) Unwrap() error { return e.err }
+
+func TestToError(t *testing.T) {
+	var syntaxErr error = json.Unmarshal([]byte("{"), &struct{}{})
+
+	data := []struct {
+		err     error
+		code    string
+		field   string
+		message string
+	}{
+		{err: ErrUserNotExist, code: CodeNotFound, message: "user is not exist"},
+		{err: ValidationError("email", "email is not valid"), code: CodeValidationFailed, field: "email", message: "email is not valid"},
+		{err: &ConflictError{Fields: []string{"username", "phone"}}, code: CodeAlreadyExists, field: "username,phone", message: "username, phone is exist before"},
+		{err: &SuspendedError{Until: time.Unix(0, 0)}, code: CodeAccountSuspended, message: "account is suspended until 1970-01-01T00:00:00Z"},
+		{err: wrappedError{err: codedError{}}, code: CodeRateLimited, message: "checking: limited"},
+		{err: wrappedError{err: context.DeadlineExceeded}, code: CodeDeadlineExceeded, message: "checking: context deadline exceeded"},
+		{err: syntaxErr, code: CodeBadRequest, message: syntaxErr.Error()},
+		{err: errors.New("database is locked"), code: CodeInternal, message: "internal error"},
+	}
+
+	for i := range data {
+		coded := ToError(data[i].err)
+		if coded.Code != data[i].code || coded.Field != data[i].field || coded.Message != data[i].message {
+			t.Fatalf("\t%s\tdata[%v] unexpected error -- %#v", failure, i, coded)
+		}
+		kept := false
+		for _, cause := range Causes(coded) {
+			kept = kept || cause == data[i].err
+		}
+		if !kept {
+			t.Fatalf("\t%s\tdata[%v] the original error should be kept", failure, i)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func TestHTTPStatus(t *testing.T) {
+	data := []struct {
+		code   string
+		status int
+	}{
+		{code: CodeValidationFailed, status: http.StatusUnprocessableEntity},
+		{code: CodeTokenExpired, status: http.StatusUnauthorized},
+		{code: CodeLocked, status: http.StatusLocked},
+		{code: CodeCancelled, status: StatusClientClosedRequest},
+		{code: "unknown", status: http.StatusInternalServerError},
+	}
+
+	for i := range data {
+		if status := HTTPStatus(data[i].code); status != data[i].status {
+			t.Fatalf("\t%s\tdata[%v] expected %v got %v", failure, i, data[i].status, status)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,37 @@
+package entities
+
+import "net/http"
+
+// StatusClientClosedRequest answers requests whose client went away, nobody reads it
+const StatusClientClosedRequest = 499
+
+// httpStatuses maps the error codes to HTTP statuses, unknown codes are 500
+var httpStatuses = map[string]int{
+	CodeBadRequest:         http.StatusBadRequest,
+	CodeValidationFailed:   http.StatusUnprocessableEntity,
+	CodeInvalidCredentials: http.StatusUnauthorized,
+	CodeTokenExpired:       http.StatusUnauthorized,
+	CodeTokenInvalid:       http.StatusUnauthorized,
+	CodeStepUpRequired:     http.StatusUnauthorized,
+	CodeStepUpFailed:       http.StatusUnauthorized,
+	CodeAccountSuspended:   http.StatusForbidden,
+	CodeAccountDisabled:    http.StatusForbidden,
+	CodeForbidden:          http.StatusForbidden,
+	CodeNotFound:           http.StatusNotFound,
+	CodeAlreadyExists:      http.StatusConflict,
+	CodeLocked:             http.StatusLocked,
+	CodeRateLimited:        http.StatusTooManyRequests,
+	CodeCancelled:          StatusClientClosedRequest,
+	CodeDeadlineExceeded:   http.StatusGatewayTimeout,
+	CodeUnavailable:        http.StatusServiceUnavailable,
+	CodeInternal:           http.StatusInternalServerError,
+}
+
+// HTTPStatus returns the HTTP status of an error code, shared by the HTTP gateway and middlewares
+func HTTPStatus(code string) int {
+	status, ok := httpStatuses[code]
+	if !ok {
+		return http.StatusInternalServerError
+	}
+	return status
+}
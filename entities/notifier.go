@@ -0,0 +1,24 @@
+package entities
+
+// Notifier delivers notices to users out of band (email, sms, push...)
+type Notifier interface {
+	Notify(notice Notice) error
+}
+
+// Notice kinds
+const (
+	// NoticeRegistrationAttempt is sent to the owner of an email somebody tried to register again
+	NoticeRegistrationAttempt = "registration_attempt"
+	// NoticeNewDevice is sent to a user signed in from a device it never used before
+	NoticeNewDevice = "new_device"
+	// NoticeStepUpCode carries the code that confirms a signin from a new device, Data["code"] holds it
+	NoticeStepUpCode = "step_up_code"
+)
+
+type Notice struct {
+	Kind   string            `json:"kind"`
+	UserID int64             `json:"user_id"`
+	Email  string            `json:"email"`
+	Phone  string            `json:"phone"`
+	Data   map[string]string `json:"data"`
+}
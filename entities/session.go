@@ -0,0 +1,28 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Session is one successful signin of a user, its access and refresh tokens are bound to its id
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int64     `json:"user_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	// Current is true for the session of the token that asked for the listing
+	Current bool `json:"current,omitempty"`
+}
+
+func (s *Session) ToByte() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// ErrSessionNotExist is returned when the session is missing, revoked or owned by another user
+var ErrSessionNotExist error = NewError(CodeNotFound, "session is not exist")
+
+// ErrSessionRevoked is returned when a token bound to a revoked session is used
+var ErrSessionRevoked error = NewError(CodeTokenInvalid, "session is revoked")
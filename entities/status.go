@@ -0,0 +1,47 @@
+package entities
+
+import (
+	"errors"
+	"time"
+)
+
+// Account statuses
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusDisabled  = "disabled"
+)
+
+// ErrAccountDisabled is returned for accounts disabled by an admin
+var ErrAccountDisabled error = NewError(CodeAccountDisabled, "account is disabled")
+
+// SuspendedError is returned for accounts suspended by an admin until a time
+type SuspendedError struct {
+	Until time.Time
+}
+
+func (e *SuspendedError) Error() string {
+	return "account is suspended until " + e.Until.UTC().Format(time.RFC3339)
+}
+
+func (e *SuspendedError) ErrorCode() string {
+	return CodeAccountSuspended
+}
+
+// StatusError returns nil when an account with the given status may be used at now,
+// otherwise the error explaining why not. Suspensions end by themselves once suspendedUntil passes.
+func StatusError(status string, suspendedUntil time.Time, now time.Time) error {
+	switch status {
+	case StatusActive, "":
+		return nil
+	case StatusSuspended:
+		if !suspendedUntil.After(now) {
+			return nil
+		}
+		return &SuspendedError{Until: suspendedUntil}
+	case StatusDisabled:
+		return ErrAccountDisabled
+	default:
+		return errors.New("unknown account status " + status)
+	}
+}
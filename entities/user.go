@@ -1,17 +1,33 @@
 package entities
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+// PasswordHashCost is the bcrypt cost used for stored passwords.
+// signinUser hashes against a dummy hash of the same cost for unknown users,
+// so both must change together.
+const PasswordHashCost = bcrypt.MinCost
 
 type User struct {
-	Name string `json:"name"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Email string `json:"email"`
-	Phone string `json:"phone"`
-	Roles []string `json:"roles"`
+	ID       int64    `json:"id,omitempty"`
+	Name     string   `json:"name"`
+	Username string   `json:"username"`
+	Password string   `json:"password,omitempty"`
+	Email    string   `json:"email"`
+	Phone    string   `json:"phone"`
+	Roles    []string `json:"roles"`
+
+	// set by the store, ignored on register
+	Status        string    `json:"status,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	PhoneVerified bool      `json:"phone_verified"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
-func(u User) ToByte() ([]byte, error){
+func (u User) ToByte() ([]byte, error) {
 
 	raw, err := json.Marshal(u)
 	if err != nil {
@@ -27,4 +43,24 @@ func UserFromBytes(raw []byte) (User, error) {
 		return User{}, err
 	}
 	return user, nil
-}
\ No newline at end of file
+}
+
+// Validate runs the rules against value and returns the first failing rule message
+func Validate(value string, rules []func(value string) (bool, string)) (bool, string) {
+	for i := range rules {
+		isValid, nonValidMsg := rules[i](value)
+		if !isValid {
+			return false, nonValidMsg
+		}
+	}
+	return true, ""
+}
+
+// ValidateField runs the rules on the value of field and returns the validation_failed error of the first broken one
+func ValidateField(field string, value string, rules []func(value string) (bool, string)) error {
+	isValid, nonValidMsg := Validate(value, rules)
+	if !isValid {
+		return ValidationError(field, nonValidMsg)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package getUser
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Options are the optional policies of the getUser nanos
+type Options struct {
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+// NewGetUserNanos returns the nanos that reads the profile of the signed in user.
+// Its content is the claims replied by the validateJWT nanos, so the id always comes from a validated token.
+func NewGetUserNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	db *sql.DB,
+	options Options,
+) chan nanos.Message {
+
+	worker := &getUserWorker{
+		db:       db,
+		delivery: options.Delivery,
+	}
+
+	worker.prepareStore()
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+type getUserWorker struct {
+	db       *sql.DB
+	delivery *messages.Delivery
+}
+
+func (w *getUserWorker) Work(msg nanos.Message) {
+
+	// extract claims from msg
+	var claims Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &claims)
+	}
+	if err == nil && claims.ID == 0 {
+		err = errors.New("claims has no id")
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	// read the user, the password is never selected
+	user, err := datastores.FindUserByID(w.db, claims.ID)
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	rawUser, err := user.ToByte()
+	if err == nil {
+		rawUser, err = messages.Reply(versioned, rawUser, Response{User: user})
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// sending the response back
+	w.delivery.Reply(msg, rawUser)
+
+}
+
+func (w *getUserWorker) prepareStore() {
+	datastores.PrepareUsersTable(w.db)
+}
@@ -0,0 +1,125 @@
+package getUser
+
+import (
+	"database/sql"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestGetUser(t *testing.T) {
+	t.Run("Given claims When get user Then the user is returned without its password", testGetUser)
+	t.Run("Given late, buffered and missing reply channels When get user Then the reply is delivered or reported", testDelivery)
+}
+
+func prepareDB() *sql.DB {
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareUsersTable(db)
+	_, err := db.Exec(`insert into users (name, username, password, email, phone, roles, email_verified)
+			values ('Bashar', 'bashar_123', '$2a$04$hash', 'bashar@example.com', '+963', '["admin"]', 1)`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+func testDelivery(t *testing.T) {
+	dropped := make(chan messages.Dropped, 1)
+	delivery := &messages.Delivery{Timeout: time.Second, OnDropped: func(d messages.Dropped) { dropped <- d }}
+	mailBox := NewGetUserNanos(1, 10, prepareDB(), Options{Delivery: delivery})
+
+	// the caller starts waiting after the reply is ready
+	resTo := make(chan nanos.Message)
+	mailBox <- nanos.Message{Content: []byte(`{"id":1}`), ResTo: resTo, ErrTo: make(chan error)}
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-resTo:
+	case <-time.After(time.Second * 2):
+		t.Fatalf("\t%s\tthe reply to an unbuffered channel should wait for the caller", failure)
+	}
+
+	// buffered channels take the reply at once
+	errTo := make(chan error, 1)
+	mailBox <- nanos.Message{Content: []byte(`{"id":2}`), ResTo: make(chan nanos.Message, 1), ErrTo: errTo}
+	select {
+	case err := <-errTo:
+		if entities.ToError(err).Code != entities.CodeNotFound {
+			t.Fatalf("\t%s\tunexpected error -- %v", failure, err)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("\t%s\t Timeout", failure)
+	}
+
+	// a message without ErrTo is reported instead of blocking the worker
+	mailBox <- nanos.Message{Content: []byte(`{"id":2}`)}
+	select {
+	case d := <-dropped:
+		if d.Reason != messages.DropNilChannel || d.Err == nil {
+			t.Fatalf("\t%s\tunexpected dropped reply -- %v", failure, d)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("\t%s\tthe dropped reply should be reported", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testGetUser(t *testing.T) {
+	mailBox := NewGetUserNanos(1, 10, prepareDB(), Options{})
+
+	data := []struct {
+		claims   string
+		expected string
+	}{
+		{claims: `{"id":1,"roles":["admin"],"exp":1}`, expected: ""},
+		{claims: `{"id":2}`, expected: "not exist"},
+		{claims: `{}`, expected: "no id"},
+		{claims: `{`, expected: "unexpected end"},
+	}
+
+	for i := range data {
+		resTo := make(chan nanos.Message, 1)
+		errTo := make(chan error, 1)
+		mailBox <- nanos.Message{Content: []byte(data[i].claims), ResTo: resTo, ErrTo: errTo}
+
+		select {
+		case res := <-resTo:
+			if data[i].expected != "" {
+				t.Fatalf("\t%s\tdata[%v] Nanos should not return response", failure, i)
+			}
+			if strings.Contains(string(res.Content), "password") || strings.Contains(string(res.Content), "$2a$") {
+				t.Fatalf("\t%s\tdata[%v] response leaks the password -- %s", failure, i, res.Content)
+			}
+			user, err := entities.UserFromBytes(res.Content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.ID != 1 || user.Username != "bashar_123" || user.Email != "bashar@example.com" || !user.EmailVerified || user.Status != entities.StatusActive || len(user.Roles) != 1 {
+				t.Fatalf("\t%s\tdata[%v] the returned user is not correct -- %v", failure, i, user)
+			}
+		case err := <-errTo:
+			matched, _ := regexp.MatchString(data[i].expected, err.Error())
+			if data[i].expected == "" || !matched {
+				t.Fatalf("\t%s\tdata[%v] error should contain //%s// -- %v", failure, i, data[i].expected, err)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("\t%s\t Timeout", failure)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,62 @@
+package httpGateway
+
+import (
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/rateLimiter"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// errorBody is the JSON body of failed requests, {"error": {"code": ..., "field": ..., "message": ...}}.
+// A step_up_required error also carries the challenge to send back with the code.
+type errorBody struct {
+	Error errorDetails `json:"error"`
+}
+
+type errorDetails struct {
+	*entities.Error
+	Challenge string     `json:"challenge,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// writeError answers with the status of err and its code, field and message
+func writeError(w http.ResponseWriter, err error) {
+	coded := entities.ToError(err)
+	details := errorDetails{Error: coded}
+
+	for _, cause := range entities.Causes(err) {
+		switch cause := cause.(type) {
+		case *signinUser.StepUpRequiredError:
+			details.Challenge = cause.Challenge
+			details.ExpiresAt = &cause.ExpiresAt
+		case *rateLimiter.LimitedError:
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cause.RetryAfter.Seconds()))))
+		}
+	}
+	switch coded.Code {
+	case entities.CodeTokenExpired, entities.CodeTokenInvalid:
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+
+	writeJSON(w, entities.HTTPStatus(coded.Code), errorBody{Error: details})
+}
+
+// writeJSON answers with status and body as JSON, a nil body writes no content
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		status = http.StatusInternalServerError
+		raw = []byte(`{"error":{"code":"internal","message":"internal error"}}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(raw)
+}
@@ -0,0 +1,384 @@
+package httpGateway
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/deleteUser"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/getUser"
+	"github.com/bashar-saleh/auth-nanos/introspectToken"
+	"github.com/bashar-saleh/auth-nanos/listSessions"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/refreshToken"
+	"github.com/bashar-saleh/auth-nanos/registerUser"
+	"github.com/bashar-saleh/auth-nanos/revokeSession"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/auth-nanos/updateUser"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxBodySize is the largest JSON body the gateway reads
+const maxBodySize = 1 << 20
+
+// Mailboxes are the channels of the nanos behind the gateway.
+// The routes of a nil channel answer 404.
+type Mailboxes struct {
+	Register      chan nanos.Message
+	Signin        chan nanos.Message
+	RefreshToken  chan nanos.Message
+	Validate      chan nanos.Message
+	GetUser       chan nanos.Message
+	UpdateUser    chan nanos.Message
+	DeleteUser    chan nanos.Message
+	ListSessions  chan nanos.Message
+	RevokeSession chan nanos.Message
+	Introspect    chan nanos.Message
+}
+
+// Gateway is the http.Handler exposing the auth nanos as JSON endpoints:
+//
+//	POST   /register              {"name", "username", "password", "email", "phone"} -> 201 {"id"}
+//	POST   /signin                {"identifier", "password", "device_id", "step_up_challenge", "step_up_code"} -> tokens
+//	POST   /token/refresh         {"refresh_token"} -> tokens
+//	POST   /token/validate        {"token"} -> claims
+//	POST   /token/introspect      token=...&token_type_hint=... -> {"active", claims...}
+//	GET    /me                    -> user
+//	PATCH  /me                    {"name", "username", "email", "phone"} -> user
+//	DELETE /me                    -> 204
+//	GET    /me/sessions           -> {"sessions"}
+//	DELETE /me/sessions/{id}      -> 204
+//
+// The /me and /token/introspect routes need an "Authorization: Bearer <access token>" header,
+// introspection takes an RFC 7662 form and answers {"active": false} for refused tokens.
+// Failures answer {"error": {"code", "field", "message"}} with the status of the code, see Status.
+// Every request is bounded by the timeout of the gateway and ends when its client goes away.
+type Gateway struct {
+	mailboxes Mailboxes
+	timeout   time.Duration
+	mux       *http.ServeMux
+}
+
+// NewGateway returns the gateway of mailboxes, a zero timeout leaves requests unbounded
+func NewGateway(mailboxes Mailboxes, timeout time.Duration) *Gateway {
+	g := &Gateway{
+		mailboxes: mailboxes,
+		timeout:   timeout,
+		mux:       http.NewServeMux(),
+	}
+
+	g.handle("/register", g.mailboxes.Register, map[string]http.HandlerFunc{http.MethodPost: g.register})
+	g.handle("/signin", g.mailboxes.Signin, map[string]http.HandlerFunc{http.MethodPost: g.signin})
+	g.handle("/token/refresh", g.mailboxes.RefreshToken, map[string]http.HandlerFunc{http.MethodPost: g.refresh})
+	g.handle("/token/validate", g.mailboxes.Validate, map[string]http.HandlerFunc{http.MethodPost: g.validate})
+	g.handle("/token/introspect", g.mailboxes.Validate, map[string]http.HandlerFunc{
+		http.MethodPost: g.withClaims(g.mailboxes.Introspect, g.introspect),
+	})
+	g.handle("/me", g.mailboxes.Validate, map[string]http.HandlerFunc{
+		http.MethodGet:    g.withClaims(g.mailboxes.GetUser, g.getMe),
+		http.MethodPatch:  g.withClaims(g.mailboxes.UpdateUser, g.updateMe),
+		http.MethodDelete: g.withClaims(g.mailboxes.DeleteUser, g.deleteMe),
+	})
+	g.handle("/me/sessions", g.mailboxes.Validate, map[string]http.HandlerFunc{
+		http.MethodGet: g.withClaims(g.mailboxes.ListSessions, g.listSessions),
+	})
+	g.handle("/me/sessions/", g.mailboxes.Validate, map[string]http.HandlerFunc{
+		http.MethodDelete: g.withClaims(g.mailboxes.RevokeSession, g.revokeSession),
+	})
+
+	return g
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if g.timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), g.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	g.mux.ServeHTTP(w, r)
+}
+
+// handle routes pattern to the handler of the request method, nothing is routed without mailBox
+func (g *Gateway) handle(pattern string, mailBox chan nanos.Message, handlers map[string]http.HandlerFunc) {
+	if mailBox == nil {
+		return
+	}
+
+	var allowed []string
+	for method := range handlers {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	g.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.Method]
+		if !ok {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			notAllowed := entities.NewError(entities.CodeBadRequest, "method "+r.Method+" is not allowed")
+			writeJSON(w, http.StatusMethodNotAllowed, errorBody{Error: errorDetails{Error: notAllowed}})
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// withClaims validates the bearer token of the request before calling handler with its claims.
+// Routes of a nil mailBox answer 404.
+func (g *Gateway) withClaims(mailBox chan nanos.Message, handler func(w http.ResponseWriter, r *http.Request, claims validateJWT.Claims)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if mailBox == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		token := bearerToken(r)
+		if token == "" {
+			writeError(w, entities.NewError(entities.CodeTokenInvalid, "bearer token is required"))
+			return
+		}
+		res, err := messages.Call(r.Context(), g.mailboxes.Validate, validateJWT.Request{Token: token})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		response, err := validateJWT.DecodeResponse(res)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		handler(w, r, response.Claims)
+	}
+}
+
+func (g *Gateway) register(w http.ResponseWriter, r *http.Request) {
+	// roles are never taken from the caller
+	var body struct {
+		Name     string `json:"name"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Email    string `json:"email"`
+		Phone    string `json:"phone"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	req := registerUser.Request{
+		User: entities.User{
+			Name:     body.Name,
+			Username: body.Username,
+			Password: body.Password,
+			Email:    body.Email,
+			Phone:    body.Phone,
+		},
+		Source: clientIP(r),
+	}
+	res, err := messages.Call(r.Context(), g.mailboxes.Register, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	response, err := registerUser.DecodeResponse(res)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (g *Gateway) signin(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Identifier      string `json:"identifier"`
+		Password        string `json:"password"`
+		DeviceID        string `json:"device_id"`
+		StepUpChallenge string `json:"step_up_challenge"`
+		StepUpCode      string `json:"step_up_code"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	req := signinUser.Request{
+		FirstField:      body.Identifier,
+		Password:        body.Password,
+		Source:          clientIP(r),
+		UserAgent:       r.UserAgent(),
+		IP:              clientIP(r),
+		DeviceID:        body.DeviceID,
+		StepUpChallenge: body.StepUpChallenge,
+		StepUpCode:      body.StepUpCode,
+	}
+	res, err := messages.Call(r.Context(), g.mailboxes.Signin, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	response, err := signinUser.DecodeResponse(res)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response.Tokens)
+}
+
+func (g *Gateway) refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshToken.Request
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	res, err := messages.Call(r.Context(), g.mailboxes.RefreshToken, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	response, err := refreshToken.DecodeResponse(res)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response.Tokens)
+}
+
+func (g *Gateway) validate(w http.ResponseWriter, r *http.Request) {
+	var req validateJWT.Request
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	res, err := messages.Call(r.Context(), g.mailboxes.Validate, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	response, err := validateJWT.DecodeResponse(res)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response.Claims)
+}
+
+// introspect answers whether the token of the form is active, the caller is authorized by its own bearer token
+func (g *Gateway) introspect(w http.ResponseWriter, r *http.Request, _ validateJWT.Claims) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, entities.WrapError(entities.CodeBadRequest, err))
+		return
+	}
+
+	req := introspectToken.Request{Token: r.PostForm.Get("token"), TokenTypeHint: r.PostForm.Get("token_type_hint")}
+	res, err := messages.Call(r.Context(), g.mailboxes.Introspect, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	response, err := introspectToken.DecodeResponse(res)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// the claims of a token must not outlive it in a cache
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (g *Gateway) getMe(w http.ResponseWriter, r *http.Request, claims validateJWT.Claims) {
+	res, err := messages.Call(r.Context(), g.mailboxes.GetUser, getUser.Request{ID: int64(claims.ID)})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	response, err := getUser.DecodeResponse(res)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response.User)
+}
+
+func (g *Gateway) updateMe(w http.ResponseWriter, r *http.Request, claims validateJWT.Claims) {
+	var req updateUser.Request
+	if !readJSON(w, r, &req) {
+		return
+	}
+	req.ID = int64(claims.ID)
+
+	res, err := messages.Call(r.Context(), g.mailboxes.UpdateUser, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	response, err := updateUser.DecodeResponse(res)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response.User)
+}
+
+func (g *Gateway) deleteMe(w http.ResponseWriter, r *http.Request, claims validateJWT.Claims) {
+	_, err := messages.Call(r.Context(), g.mailboxes.DeleteUser, deleteUser.Request{ID: int64(claims.ID)})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+func (g *Gateway) listSessions(w http.ResponseWriter, r *http.Request, claims validateJWT.Claims) {
+	res, err := messages.Call(r.Context(), g.mailboxes.ListSessions, listSessions.Request{ID: int64(claims.ID), SessionID: claims.SessionID})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	response, err := listSessions.DecodeResponse(res)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (g *Gateway) revokeSession(w http.ResponseWriter, r *http.Request, claims validateJWT.Claims) {
+	sessionID := strings.TrimPrefix(r.URL.Path, "/me/sessions/")
+	_, err := messages.Call(r.Context(), g.mailboxes.RevokeSession, revokeSession.Request{ID: int64(claims.ID), SessionID: sessionID})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// readJSON decodes the body of r into v, it answers bad_request and returns false when it can not
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v)
+	if err != nil {
+		writeError(w, entities.WrapError(entities.CodeBadRequest, err))
+		return false
+	}
+	return true
+}
+
+// bearerToken returns the token of the Authorization header, empty when there is none
+func bearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+// clientIP returns the IP of the connection, forwarding headers are not trusted
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
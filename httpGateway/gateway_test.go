@@ -0,0 +1,267 @@
+package httpGateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/deleteUser"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/getUser"
+	"github.com/bashar-saleh/auth-nanos/introspectToken"
+	"github.com/bashar-saleh/auth-nanos/listSessions"
+	"github.com/bashar-saleh/auth-nanos/refreshToken"
+	"github.com/bashar-saleh/auth-nanos/registerUser"
+	"github.com/bashar-saleh/auth-nanos/revokeSession"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/auth-nanos/updateUser"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestGateway(t *testing.T) {
+	t.Run("Given a new user When register, signin and use its tokens Then every endpoint answers JSON", testUserJourney)
+	t.Run("Given bad requests and failed calls When call the endpoints Then coded errors get their status", testErrors)
+	t.Run("Given a bearer token When introspect tokens Then RFC 7662 responses are returned", testIntrospect)
+	t.Run("Given a slow nanos When the request times out Then 504 is returned", testTimeout)
+}
+
+func newServer(timeout time.Duration) *httptest.Server {
+	db := datastores.SqliteConnection("test.db")
+	key := "secretKey"
+	validate := validateJWT.NewValidateJWTNanos(1, 10, key, validateJWT.Options{DB: db})
+	gateway := NewGateway(Mailboxes{
+		Register:      registerUser.NewRegisterUserNanos(1, 10, db, nil, nil, nil, nil, nil, registerUser.Options{}),
+		Signin:        signinUser.NewSigninUserNanos(1, 10, db, key, 4, nil, nil, signinUser.Options{}),
+		RefreshToken:  refreshToken.NewRefreshTokenNanos(1, 10, db, key, 4, refreshToken.Options{}),
+		Validate:      validate,
+		GetUser:       getUser.NewGetUserNanos(1, 10, db, getUser.Options{}),
+		UpdateUser:    updateUser.NewUpdateUserNanos(1, 10, db, nil, nil, nil, nil, updateUser.Options{}),
+		DeleteUser:    deleteUser.NewDeleteUserNanos(1, 10, db, time.Hour, deleteUser.Options{}),
+		ListSessions:  listSessions.NewListSessionsNanos(1, 10, db, listSessions.Options{}),
+		RevokeSession: revokeSession.NewRevokeSessionNanos(1, 10, db, revokeSession.Options{}),
+		Introspect:    introspectToken.NewIntrospectTokenNanos(1, 10, validate, introspectToken.Options{}),
+	}, timeout)
+	return httptest.NewServer(gateway)
+}
+
+// do sends body as JSON with the bearer token when set, and decodes the JSON answer into out
+func do(t *testing.T, server *httptest.Server, method string, path string, token string, body interface{}, out interface{}) *http.Response {
+	var reader *bytes.Reader
+	switch body := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case string:
+		reader = bytes.NewReader([]byte(body))
+	default:
+		raw, _ := json.Marshal(body)
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, server.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if out != nil {
+		_ = json.NewDecoder(res.Body).Decode(out)
+	}
+	return res
+}
+
+type errorResponse struct {
+	Error entities.Error `json:"error"`
+}
+
+func testUserJourney(t *testing.T) {
+	server := newServer(0)
+	defer server.Close()
+
+	var registered registerUser.Response
+	res := do(t, server, "POST", "/register", "", map[string]interface{}{"name": "Bashar", "username": "bashar_123", "password": "bb123123", "roles": []string{"admin"}}, &registered)
+	if res.StatusCode != http.StatusCreated || registered.ID != 1 {
+		t.Fatalf("\t%s\tregister should answer 201 with the id -- %v %v", failure, res.StatusCode, registered)
+	}
+
+	var tokens signinUser.Tokens
+	res = do(t, server, "POST", "/signin", "", map[string]string{"identifier": "bashar_123", "password": "bb123123"}, &tokens)
+	if res.StatusCode != http.StatusOK || tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("\t%s\tsignin should answer the tokens -- %v %v", failure, res.StatusCode, tokens)
+	}
+
+	var claims validateJWT.Claims
+	res = do(t, server, "POST", "/token/validate", "", map[string]string{"token": tokens.AccessToken}, &claims)
+	if res.StatusCode != http.StatusOK || claims.ID != 1 || len(claims.Roles) != 0 {
+		t.Fatalf("\t%s\tvalidate should answer the claims without the roles sent on register -- %v %v", failure, res.StatusCode, claims)
+	}
+
+	var me entities.User
+	res = do(t, server, "GET", "/me", tokens.AccessToken, nil, &me)
+	if res.StatusCode != http.StatusOK || me.Username != "bashar_123" || me.Password != "" {
+		t.Fatalf("\t%s\tGET /me should answer the user without its password -- %v %v", failure, res.StatusCode, me)
+	}
+
+	res = do(t, server, "PATCH", "/me", tokens.AccessToken, map[string]string{"name": "Bashar Saleh"}, &me)
+	if res.StatusCode != http.StatusOK || me.Name != "Bashar Saleh" || me.Username != "bashar_123" {
+		t.Fatalf("\t%s\tPATCH /me should answer the updated user -- %v %v", failure, res.StatusCode, me)
+	}
+
+	var refreshed signinUser.Tokens
+	res = do(t, server, "POST", "/token/refresh", "", map[string]string{"refresh_token": tokens.RefreshToken}, &refreshed)
+	if res.StatusCode != http.StatusOK || refreshed.SessionID != tokens.SessionID || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("\t%s\trefresh should rotate the refresh token of the session -- %v %v", failure, res.StatusCode, refreshed)
+	}
+
+	var sessions listSessions.Response
+	res = do(t, server, "GET", "/me/sessions", refreshed.AccessToken, nil, &sessions)
+	if res.StatusCode != http.StatusOK || len(sessions.Sessions) != 1 || !sessions.Sessions[0].Current {
+		t.Fatalf("\t%s\tGET /me/sessions should answer the current session -- %v %v", failure, res.StatusCode, sessions)
+	}
+
+	res = do(t, server, "DELETE", "/me/sessions/"+tokens.SessionID, refreshed.AccessToken, nil, nil)
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("\t%s\tDELETE /me/sessions/{id} should answer 204 -- %v", failure, res.StatusCode)
+	}
+	var failed errorResponse
+	res = do(t, server, "POST", "/token/refresh", "", map[string]string{"refresh_token": refreshed.RefreshToken}, &failed)
+	if res.StatusCode != http.StatusUnauthorized || failed.Error.Code != entities.CodeTokenInvalid {
+		t.Fatalf("\t%s\tthe refresh token of a revoked session should be refused -- %v %v", failure, res.StatusCode, failed)
+	}
+
+	_ = do(t, server, "POST", "/signin", "", map[string]string{"identifier": "bashar_123", "password": "bb123123"}, &tokens)
+	res = do(t, server, "DELETE", "/me", tokens.AccessToken, nil, nil)
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("\t%s\tDELETE /me should answer 204 -- %v", failure, res.StatusCode)
+	}
+	res = do(t, server, "GET", "/me", tokens.AccessToken, nil, nil)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("\t%s\tthe tokens of a deleted user should be refused -- %v", failure, res.StatusCode)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testErrors(t *testing.T) {
+	server := newServer(0)
+	defer server.Close()
+	_ = do(t, server, "POST", "/register", "", map[string]string{"username": "bashar_123", "password": "bb123123", "email": "bashar@example.com"}, nil)
+
+	data := []struct {
+		method string
+		path   string
+		token  string
+		body   interface{}
+		status int
+		code   string
+		field  string
+	}{
+		{method: "POST", path: "/register", body: map[string]string{"username": "bashar_123", "password": "bb123123"}, status: http.StatusConflict, code: entities.CodeAlreadyExists, field: "username"},
+		{method: "POST", path: "/register", body: `{"username":`, status: http.StatusBadRequest, code: entities.CodeBadRequest},
+		{method: "POST", path: "/signin", body: map[string]string{"identifier": "bashar_123", "password": "wrong"}, status: http.StatusUnauthorized, code: entities.CodeInvalidCredentials},
+		{method: "POST", path: "/token/validate", body: map[string]string{"token": "not a token"}, status: http.StatusUnauthorized, code: entities.CodeTokenInvalid},
+		{method: "POST", path: "/token/refresh", body: map[string]string{}, status: http.StatusUnprocessableEntity, code: entities.CodeValidationFailed, field: "refresh_token"},
+		{method: "GET", path: "/me", status: http.StatusUnauthorized, code: entities.CodeTokenInvalid},
+		{method: "GET", path: "/me", token: "not a token", status: http.StatusUnauthorized, code: entities.CodeTokenInvalid},
+		{method: "GET", path: "/signin", status: http.StatusMethodNotAllowed, code: entities.CodeBadRequest},
+	}
+
+	for i := range data {
+		var failed errorResponse
+		res := do(t, server, data[i].method, data[i].path, data[i].token, data[i].body, &failed)
+		if res.StatusCode != data[i].status || failed.Error.Code != data[i].code || failed.Error.Field != data[i].field {
+			t.Fatalf("\t%s\tdata[%v] should answer %v %s -- %v %+v", failure, i, data[i].status, data[i].code, res.StatusCode, failed)
+		}
+		if data[i].status == http.StatusUnauthorized && data[i].path == "/me" && res.Header.Get("WWW-Authenticate") == "" {
+			t.Fatalf("\t%s\tdata[%v] 401 should carry WWW-Authenticate", failure, i)
+		}
+	}
+
+	res := do(t, server, "GET", "/unknown", "", nil, nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("\t%s\tunknown paths should answer 404 -- %v", failure, res.StatusCode)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testIntrospect(t *testing.T) {
+	server := newServer(0)
+	defer server.Close()
+	_ = do(t, server, "POST", "/register", "", map[string]string{"username": "bashar_123", "password": "bb123123"}, nil)
+	var tokens signinUser.Tokens
+	_ = do(t, server, "POST", "/signin", "", map[string]string{"identifier": "bashar_123", "password": "bb123123"}, &tokens)
+
+	introspect := func(bearer string, token string) (*http.Response, map[string]interface{}) {
+		req, _ := http.NewRequest("POST", server.URL+"/token/introspect", strings.NewReader(url.Values{"token": {token}, "token_type_hint": {"access_token"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body := map[string]interface{}{}
+		_ = json.NewDecoder(res.Body).Decode(&body)
+		return res, body
+	}
+
+	res, body := introspect(tokens.AccessToken, tokens.AccessToken)
+	if res.StatusCode != http.StatusOK || body["active"] != true || body["sub"] != "1" || body["sid"] != tokens.SessionID || body["token_type"] != "Bearer" {
+		t.Fatalf("\t%s\tan active token should answer its claims -- %v %v", failure, res.StatusCode, body)
+	}
+	if res.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("\t%s\tthe introspection should not be cached -- %v", failure, res.Header)
+	}
+
+	res, body = introspect(tokens.AccessToken, "not a token")
+	if res.StatusCode != http.StatusOK || len(body) != 1 || body["active"] != false {
+		t.Fatalf("\t%s\tan unknown token should only answer inactive -- %v %v", failure, res.StatusCode, body)
+	}
+
+	res, _ = introspect("", tokens.AccessToken)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("\t%s\tcallers without bearer token should be refused -- %v", failure, res.StatusCode)
+	}
+
+	res, body = introspect(tokens.AccessToken, "")
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("\t%s\ta form without token should be refused -- %v %v", failure, res.StatusCode, body)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testTimeout(t *testing.T) {
+	// nobody reads this mailbox, so the call waits until the request timeout
+	gateway := NewGateway(Mailboxes{Validate: make(chan nanos.Message)}, 50*time.Millisecond)
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	var failed errorResponse
+	res := do(t, server, "POST", "/token/validate", "", map[string]string{"token": "token"}, &failed)
+	if res.StatusCode != http.StatusGatewayTimeout || failed.Error.Code != entities.CodeDeadlineExceeded {
+		t.Fatalf("\t%s\ta timed out request should answer 504 -- %v %+v", failure, res.StatusCode, failed)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,137 @@
+package introspectToken
+
+import (
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"strconv"
+	"strings"
+)
+
+// Options are the optional policies of the introspectToken nanos
+type Options struct {
+	// AuditSink records the audit events, nil records none
+	AuditSink audit.Sink
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+// NewIntrospectTokenNanos returns the nanos that tells resource servers whether an access token,
+// a JWT or an opaque one, is active, as RFC 7662 token introspection does.
+// Its content is {"token": "...", "token_type_hint": "..."} and it replies {"active": false} for
+// unknown, expired and revoked tokens and tokens of inactive users, the claims otherwise.
+//
+// Tokens are checked by the validateJWT nanos behind validate, which must be given the db the
+// opaque tokens are stored in.
+func NewIntrospectTokenNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	validate chan nanos.Message,
+	options Options,
+) chan nanos.Message {
+
+	worker := &introspectTokenWorker{
+		validate:  validate,
+		auditSink: options.AuditSink,
+		delivery:  options.Delivery,
+	}
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+type introspectTokenWorker struct {
+	validate  chan nanos.Message
+	auditSink audit.Sink
+	delivery  *messages.Delivery
+}
+
+func (w *introspectTokenWorker) Work(msg nanos.Message) {
+
+	// audit the introspection whatever its outcome
+	event := audit.Event{Action: audit.ActionIntrospect, Outcome: audit.OutcomeFailure, Reason: "internal"}
+	defer func() { audit.Record(w.auditSink, event) }()
+
+	// skip requests the caller already gave up on
+	ctx := messages.Context(msg)
+	if err := ctx.Err(); err != nil {
+		event.Reason = "cancelled"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// extract content from msg, unversioned contents have the same shape as the payload
+	var content Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &content)
+	}
+	if err == nil && content.Token == "" {
+		err = entities.ValidationError("token", "token is required")
+	}
+	if err != nil {
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	// validate the token, refused tokens are inactive rather than errors
+	response := Response{}
+	res, err := messages.Call(ctx, w.validate, validateJWT.Request{Token: content.Token})
+	if err == nil {
+		var validated validateJWT.Response
+		validated, err = validateJWT.DecodeResponse(res)
+		if err == nil {
+			response = Response{
+				Active:    true,
+				Scope:     strings.Join(validated.Roles, " "),
+				TokenType: "Bearer",
+				Claims:    &validated.Claims,
+			}
+			response.Subject = strconv.Itoa(validated.ID)
+		}
+	}
+	if err != nil && !inactive(err) {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// an inactive token is a successful introspection, the details tell why it is inactive
+	event.Details = map[string]string{"active": strconv.FormatBool(response.Active)}
+	if response.Active {
+		event.Subject = response.Subject
+	} else {
+		event.Details["reason"] = entities.ToError(err).Code
+	}
+
+	rawResponse, err := json.Marshal(response)
+	if err == nil {
+		rawResponse, err = messages.Reply(versioned, rawResponse, response)
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	event.Outcome = audit.OutcomeSuccess
+	event.Reason = ""
+	w.delivery.Reply(msg, rawResponse)
+
+}
+
+// inactive tells if err refuses the token itself, other errors fail the introspection
+func inactive(err error) bool {
+	switch entities.ToError(err).Code {
+	case entities.CodeTokenInvalid, entities.CodeTokenExpired, entities.CodeAccountSuspended, entities.CodeAccountDisabled:
+		return true
+	}
+	return false
+}
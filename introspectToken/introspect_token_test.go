@@ -0,0 +1,148 @@
+package introspectToken
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"os"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestIntrospectToken(t *testing.T) {
+	t.Run("Given JWT and opaque access tokens When introspect Then they are active with their claims", testActive)
+	t.Run("Given refused tokens When introspect Then only active false is returned", testInactive)
+	t.Run("Given bad requests and failing validation When introspect Then coded errors are returned", testErrors)
+}
+
+// newMailBox returns the introspectToken nanos over a validateJWT nanos of test.db, with the
+// JWT and opaque tokens of bashar_123
+func newMailBox(t *testing.T) (chan nanos.Message, string, string) {
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareUsersTable(db)
+	_, err := db.Exec(`insert into users (name, username, password, email, phone, roles, status, suspended_until) values
+			('Bashar', 'bashar_123', '', '', '', '["admin","user"]', 'active', 0),
+			('Roba', 'roba_123', '', '', '', '', 'disabled', 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtToken, err := signinUser.NewAccessToken("secretKey", 1, 1, []string{"admin", "user"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opaqueToken, err := signinUser.NewOpaqueTokens(db).IssueAccessToken(context.Background(), 1, []string{"admin", "user"}, "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	validate := validateJWT.NewValidateJWTNanos(1, 10, "secretKey", validateJWT.Options{DB: db, Formats: []string{validateJWT.FormatJWT, validateJWT.FormatOpaque}})
+	return NewIntrospectTokenNanos(1, 10, validate, Options{}), jwtToken, opaqueToken
+}
+
+// introspect sends content unversioned and decodes the reply into a map, to see every field sent
+func introspect(mailBox chan nanos.Message, content string) (map[string]interface{}, error) {
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	mailBox <- nanos.Message{Content: []byte(content), ResTo: resTo, ErrTo: errTo}
+
+	select {
+	case res := <-resTo:
+		response := map[string]interface{}{}
+		err := json.Unmarshal(res.Content, &response)
+		return response, err
+	case err := <-errTo:
+		return nil, err
+	case <-time.After(time.Second * 2):
+		return nil, errors.New("timeout")
+	}
+}
+
+func testActive(t *testing.T) {
+	mailBox, jwtToken, opaqueToken := newMailBox(t)
+
+	for _, token := range []string{jwtToken, opaqueToken} {
+		response, err := introspect(mailBox, `{"token":"`+token+`","token_type_hint":"access_token"}`)
+		if err != nil {
+			t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+		}
+		if response["active"] != true || response["sub"] != "1" || response["id"] != 1.0 || response["scope"] != "admin user" || response["token_type"] != "Bearer" {
+			t.Fatalf("\t%s\tthe claims of the token should be returned -- %v", failure, response)
+		}
+		if exp, _ := response["exp"].(float64); time.Unix(int64(exp), 0).Before(time.Now()) {
+			t.Fatalf("\t%s\tthe expiry of the token should be returned -- %v", failure, response)
+		}
+	}
+
+	// versioned requests get the claims validateJWT returns
+	res, err := messages.Call(context.Background(), mailBox, Request{Token: opaqueToken})
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	response, err := DecodeResponse(res)
+	if err != nil || !response.Active || response.Claims == nil || response.ID != 1 || len(response.Roles) != 2 || response.Subject != "1" {
+		t.Fatalf("\t%s\tthe versioned response should carry the claims -- %+v %v", failure, response, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testInactive(t *testing.T) {
+	mailBox, _, _ := newMailBox(t)
+	expired, _ := signinUser.NewAccessToken("secretKey", -1, 1, nil, "")
+	disabled, _ := signinUser.NewAccessToken("secretKey", 1, 2, nil, "")
+
+	data := []string{"unknown", "not.a.jwt", expired, disabled}
+	for i := range data {
+		response, err := introspect(mailBox, `{"token":"`+data[i]+`"}`)
+		if err != nil {
+			t.Fatalf("\t%s\tdata[%v] should not return any error -- %v", failure, i, err)
+		}
+		if len(response) != 1 || response["active"] != false {
+			t.Fatalf("\t%s\tdata[%v] should only be inactive -- %v", failure, i, response)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testErrors(t *testing.T) {
+	mailBox, _, _ := newMailBox(t)
+
+	data := []struct {
+		content string
+		code    string
+	}{
+		{content: `{}`, code: entities.CodeValidationFailed},
+		{content: `not json`, code: entities.CodeBadRequest},
+	}
+	for i := range data {
+		_, err := introspect(mailBox, data[i].content)
+		if entities.ToError(err).Code != data[i].code {
+			t.Fatalf("\t%s\tdata[%v] should fail with %s -- %v", failure, i, data[i].code, err)
+		}
+	}
+
+	// a validation that can not answer is not an inactive token
+	failing := make(chan nanos.Message, 1)
+	go func() {
+		msg := <-failing
+		msg.ErrTo <- entities.NewError(entities.CodeInternal, "database is down")
+	}()
+	_, err := introspect(NewIntrospectTokenNanos(1, 10, failing, Options{}), `{"token":"token"}`)
+	if entities.ToError(err).Code != entities.CodeInternal {
+		t.Fatalf("\t%s\tfailed validations should fail the introspection -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
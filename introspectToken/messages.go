@@ -0,0 +1,35 @@
+package introspectToken
+
+import (
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the introspectToken nanos, unversioned requests have the same shape
+type Request struct {
+	Token string `json:"token"`
+	// TokenTypeHint is accepted as RFC 7662 defines it, only access tokens are ever active
+	TokenTypeHint string `json:"token_type_hint,omitempty"`
+}
+
+// Response is the RFC 7662 introspection response, unversioned requests get the same shape.
+// Inactive tokens only carry Active, active ones the claims validateJWT would return.
+type Response struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	*validateJWT.Claims
+}
+
+// NewMessage wraps req into a message for the introspectToken nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
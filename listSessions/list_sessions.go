@@ -0,0 +1,91 @@
+package listSessions
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Options are the optional policies of the listSessions nanos
+type Options struct {
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+// NewListSessionsNanos returns the nanos that lists the active sessions of the signed in user.
+// Its content is the claims replied by the validateJWT nanos, the session of those claims is marked as current.
+func NewListSessionsNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	db *sql.DB,
+	options Options,
+) chan nanos.Message {
+
+	worker := &listSessionsWorker{
+		db:       db,
+		delivery: options.Delivery,
+	}
+
+	worker.prepareStore()
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+type listSessionsWorker struct {
+	db       *sql.DB
+	delivery *messages.Delivery
+}
+
+func (w *listSessionsWorker) Work(msg nanos.Message) {
+
+	// extract claims from msg
+	var claims Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &claims)
+	}
+	if err == nil && claims.ID == 0 {
+		err = errors.New("claims has no id")
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	// read the sessions
+	sessions, err := datastores.ListSessions(w.db, claims.ID)
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = claims.SessionID != "" && sessions[i].ID == claims.SessionID
+	}
+
+	rawSessions, err := json.Marshal(sessions)
+	if err == nil {
+		rawSessions, err = messages.Reply(versioned, rawSessions, Response{Sessions: sessions})
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// sending the response back
+	w.delivery.Reply(msg, rawSessions)
+
+}
+
+func (w *listSessionsWorker) prepareStore() {
+	datastores.PrepareSessionsTable(w.db)
+}
@@ -0,0 +1,80 @@
+package listSessions
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestListSessions(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareSessionsTable(db)
+	now := time.Now()
+	older, _, err := datastores.CreateSession(context.Background(), db, 1, "Firefox", "10.0.0.1", now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer, _, _ := datastores.CreateSession(context.Background(), db, 1, "Safari", "10.0.0.2", now.Add(-time.Hour))
+	revoked, _, _ := datastores.CreateSession(context.Background(), db, 1, "Chrome", "10.0.0.3", now)
+	_, _, _ = datastores.CreateSession(context.Background(), db, 2, "Edge", "10.0.0.4", now)
+	_ = datastores.RevokeSession(db, revoked.ID, 1, now)
+	mailBox := NewListSessionsNanos(1, 10, db, Options{})
+
+	data := []struct {
+		claims   string
+		expected string
+	}{
+		{claims: `{"id":1,"sid":"` + older.ID + `"}`, expected: ""},
+		{claims: `{}`, expected: "no id"},
+		{claims: `{`, expected: "unexpected end"},
+	}
+
+	for i := range data {
+		resTo := make(chan nanos.Message, 1)
+		errTo := make(chan error, 1)
+		mailBox <- nanos.Message{Content: []byte(data[i].claims), ResTo: resTo, ErrTo: errTo}
+
+		select {
+		case res := <-resTo:
+			if data[i].expected != "" {
+				t.Fatalf("\t%s\tdata[%v] Nanos should not return response", failure, i)
+			}
+			if strings.Contains(string(res.Content), "refresh") {
+				t.Fatalf("\t%s\tdata[%v] response leaks the refresh token -- %s", failure, i, res.Content)
+			}
+			var sessions []entities.Session
+			err := json.Unmarshal(res.Content, &sessions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sessions) != 2 || sessions[0].ID != newer.ID || sessions[1].ID != older.ID ||
+				sessions[0].Current || !sessions[1].Current || sessions[1].UserAgent != "Firefox" || sessions[1].IP != "10.0.0.1" {
+				t.Fatalf("\t%s\tdata[%v] the returned sessions are not correct -- %s", failure, i, res.Content)
+			}
+		case err := <-errTo:
+			matched, _ := regexp.MatchString(data[i].expected, err.Error())
+			if data[i].expected == "" || !matched {
+				t.Fatalf("\t%s\tdata[%v] error should contain //%s// -- %v", failure, i, data[i].expected, err)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("\t%s\t Timeout", failure)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
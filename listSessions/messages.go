@@ -0,0 +1,31 @@
+package listSessions
+
+import (
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the listSessions nanos, claims replied by validateJWT can be sent as they are
+type Request struct {
+	// ID and SessionID are the id and sid of the validated claims
+	ID        int64  `json:"id"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+// Response is the versioned response of the listSessions nanos, unversioned requests get the bare list
+type Response struct {
+	Sessions []entities.Session `json:"sessions"`
+}
+
+// NewMessage wraps req into a message for the listSessions nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
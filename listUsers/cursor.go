@@ -0,0 +1,80 @@
+package listUsers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+)
+
+// cursor is the position of the last row of a page
+type cursor struct {
+	// Sort binds the cursor to the order it was made for
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    int64       `json:"id"`
+}
+
+var errInvalidCursor = entities.ValidationError("cursor", "cursor is not valid")
+
+func sortKey(sortBy string, descending bool) string {
+	if descending {
+		return sortBy + ":desc"
+	}
+	return sortBy + ":asc"
+}
+
+func encodeCursor(c cursor, sortBy string, descending bool) (string, error) {
+	c.Sort = sortKey(sortBy, descending)
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(encoded string, sortBy string, descending bool) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor{}, errInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var c cursor
+	err = decoder.Decode(&c)
+	if err != nil || c.Sort != sortKey(sortBy, descending) {
+		return cursor{}, errInvalidCursor
+	}
+
+	// numbers must reach sqlite as integers
+	if number, ok := c.Value.(json.Number); ok {
+		c.Value, err = number.Int64()
+		if err != nil {
+			return cursor{}, errInvalidCursor
+		}
+	}
+	return c, nil
+}
+
+// scanUserWithSortValue reads a user selected with the sort column appended
+func scanUserWithSortValue(rows *sql.Rows) (entities.User, interface{}, error) {
+	var value interface{}
+	user, err := datastores.ScanUser(scannerFunc(func(dest ...interface{}) error {
+		return rows.Scan(append(dest, &value)...)
+	}))
+	if err != nil {
+		return entities.User{}, nil, err
+	}
+	if raw, ok := value.([]byte); ok {
+		value = string(raw)
+	}
+	return user, value, nil
+}
+
+type scannerFunc func(dest ...interface{}) error
+
+func (f scannerFunc) Scan(dest ...interface{}) error {
+	return f(dest...)
+}
@@ -0,0 +1,240 @@
+package listUsers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// sortColumns maps the accepted Query.SortBy values to their columns
+var sortColumns = map[string]string{
+	"id":         "id",
+	"username":   "coalesce(username, '')",
+	"email":      "coalesce(email, '')",
+	"created_at": "created_at",
+}
+
+// Options are the optional policies of the listUsers nanos
+type Options struct {
+	// AuditSink records the audit events, nil records none
+	AuditSink audit.Sink
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+// NewListUsersNanos returns the admin nanos that browses users page by page.
+// It trusts its callers, so it must only be reachable by admins.
+func NewListUsersNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	db *sql.DB,
+	options Options,
+) chan nanos.Message {
+
+	worker := &listUsersWorker{
+		db:        db,
+		auditSink: options.AuditSink,
+		delivery:  options.Delivery,
+	}
+
+	worker.prepareStore()
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+// Query is the content of a list users message, zero fields do not filter
+type Query struct {
+	// ActorID is the admin browsing, it is only audited
+	ActorID       int64     `json:"actor_id"`
+	Role          string    `json:"role"`
+	Status        string    `json:"status"`
+	CreatedAfter  time.Time `json:"created_after"`
+	CreatedBefore time.Time `json:"created_before"`
+	EmailVerified *bool     `json:"email_verified"`
+	PhoneVerified *bool     `json:"phone_verified"`
+	// Search matches the beginning of the username or the email
+	Search string `json:"search"`
+	// SortBy is one of id (default), username, email, created_at
+	SortBy     string `json:"sort_by"`
+	Descending bool   `json:"descending"`
+	// Limit defaults to 20 and can not exceed 100
+	Limit int `json:"limit"`
+	// Cursor is the NextCursor of the previous page, empty for the first page
+	Cursor string `json:"cursor"`
+}
+
+// Page is the response of the list users nanos, NextCursor is empty on the last page
+type Page struct {
+	Users      []entities.User `json:"users"`
+	NextCursor string          `json:"next_cursor"`
+}
+
+type listUsersWorker struct {
+	db        *sql.DB
+	auditSink audit.Sink
+	delivery  *messages.Delivery
+}
+
+func (w *listUsersWorker) Work(msg nanos.Message) {
+
+	// audit the listing whatever its outcome
+	event := audit.Event{Action: audit.ActionList, Outcome: audit.OutcomeFailure, Reason: "internal"}
+	defer func() { audit.Record(w.auditSink, event) }()
+
+	// extract query from msg
+	var query Query
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &query)
+	}
+	if err != nil {
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	event.Actor = strconv.FormatInt(query.ActorID, 10)
+
+	// read the page
+	page, err := w.list(query)
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	rawPage, err := json.Marshal(page)
+	if err == nil {
+		rawPage, err = messages.Reply(versioned, rawPage, page)
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// sending the response back
+	event.Outcome = audit.OutcomeSuccess
+	event.Reason = ""
+	w.delivery.Reply(msg, rawPage)
+
+}
+
+func (w *listUsersWorker) prepareStore() {
+	datastores.PrepareUsersTable(w.db)
+}
+
+func (w *listUsersWorker) list(query Query) (Page, error) {
+	if query.SortBy == "" {
+		query.SortBy = "id"
+	}
+	sortColumn, ok := sortColumns[query.SortBy]
+	if !ok {
+		return Page{}, entities.ValidationError("sort_by", "sort_by must be one of id, username, email, created_at")
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	// filters
+	where := []string{"deleted_at = 0"}
+	var args []interface{}
+	if query.Role != "" {
+		rawRole, _ := json.Marshal(query.Role)
+		where = append(where, `roles like ? escape '\'`)
+		args = append(args, "%"+escapeLike(string(rawRole))+"%")
+	}
+	if query.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, query.Status)
+	}
+	if !query.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, query.CreatedAfter.Unix())
+	}
+	if !query.CreatedBefore.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, query.CreatedBefore.Unix())
+	}
+	if query.EmailVerified != nil {
+		where = append(where, "email_verified = ?")
+		args = append(args, *query.EmailVerified)
+	}
+	if query.PhoneVerified != nil {
+		where = append(where, "phone_verified = ?")
+		args = append(args, *query.PhoneVerified)
+	}
+	if query.Search != "" {
+		where = append(where, `(username like ? escape '\' or email like ? escape '\')`)
+		prefix := escapeLike(query.Search) + "%"
+		args = append(args, prefix, prefix)
+	}
+
+	// continue after the cursor
+	direction, comparison := "asc", ">"
+	if query.Descending {
+		direction, comparison = "desc", "<"
+	}
+	if query.Cursor != "" {
+		after, err := decodeCursor(query.Cursor, query.SortBy, query.Descending)
+		if err != nil {
+			return Page{}, err
+		}
+		where = append(where, "("+sortColumn+", id) "+comparison+" (?, ?)")
+		args = append(args, after.Value, after.ID)
+	}
+
+	// one more row than the limit tells if there is a next page
+	q := "SELECT " + datastores.UsersSelection + ", " + sortColumn + " FROM users WHERE " + strings.Join(where, " AND ") +
+		" ORDER BY " + sortColumn + " " + direction + ", id " + direction + " LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := w.db.Query(q, args...)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+
+	page := Page{Users: []entities.User{}}
+	var last cursor
+	for rows.Next() {
+		if len(page.Users) == limit {
+			page.NextCursor, err = encodeCursor(last, query.SortBy, query.Descending)
+			if err != nil {
+				return Page{}, err
+			}
+			break
+		}
+		user, value, err := scanUserWithSortValue(rows)
+		if err != nil {
+			return Page{}, err
+		}
+		page.Users = append(page.Users, user)
+		last = cursor{Value: value, ID: user.ID}
+	}
+	return page, rows.Err()
+}
+
+// escapeLike escapes the like wildcards of s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
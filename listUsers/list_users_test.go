@@ -0,0 +1,171 @@
+package listUsers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestListUsers(t *testing.T) {
+	t.Run("Given filters When list users Then only the matching users are returned", testFilters)
+	t.Run("Given a small limit When follow the cursors Then every user is returned once in order", testPagination)
+	t.Run("Given a bad cursor or sort When list users Then error is returned", testInvalidQueries)
+}
+
+func prepareDB() *sql.DB {
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareUsersTable(db)
+	_, err := db.Exec(`insert into users (name, username, password, email, phone, roles, status, email_verified, phone_verified, created_at, deleted_at) values
+			('A', 'alice', 'hash', 'alice@example.com', '+1', '["admin","user"]', 'active', 1, 0, 100, 0),
+			('B', 'bob', 'hash', 'bob@example.com', '+2', '["user"]', 'suspended', 0, 0, 200, 0),
+			('C', 'carol', 'hash', 'carol@test.org', '+3', '["user"]', 'active', 1, 1, 300, 0),
+			('D', 'dave', 'hash', 'dave@example.com', '+4', '["administrator"]', 'disabled', 0, 1, 400, 0),
+			('E', 'al_bundy', 'hash', 'bundy@example.com', '+5', '', 'active', 0, 0, 500, 0),
+			('F', 'alfred', 'hash', 'alfred@example.com', '+6', '["admin"]', 'active', 1, 0, 600, 0),
+			('G', 'albert', 'hash', 'albert@example.com', '+7', '["admin"]', 'active', 1, 0, 700, 50)`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+func list(mailBox chan nanos.Message, query Query) (Page, error) {
+	rawQuery, _ := json.Marshal(query)
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	mailBox <- nanos.Message{Content: rawQuery, ResTo: resTo, ErrTo: errTo}
+
+	select {
+	case res := <-resTo:
+		if strings.Contains(string(res.Content), "hash") {
+			return Page{}, errors.New("response leaks the password")
+		}
+		var page Page
+		err := json.Unmarshal(res.Content, &page)
+		return page, err
+	case err := <-errTo:
+		return Page{}, err
+	case <-time.After(time.Second * 2):
+		return Page{}, errors.New("timeout")
+	}
+}
+
+func usernames(page Page) []string {
+	names := []string{}
+	for _, user := range page.Users {
+		names = append(names, user.Username)
+	}
+	return names
+}
+
+func testFilters(t *testing.T) {
+	mailBox := NewListUsersNanos(1, 10, prepareDB(), Options{})
+	yes, no := true, false
+
+	data := []struct {
+		query    Query
+		expected []string
+	}{
+		{query: Query{}, expected: []string{"alice", "bob", "carol", "dave", "al_bundy", "alfred"}},
+		{query: Query{Role: "admin"}, expected: []string{"alice", "alfred"}},
+		{query: Query{Status: "active"}, expected: []string{"alice", "carol", "al_bundy", "alfred"}},
+		{query: Query{CreatedAfter: time.Unix(200, 0), CreatedBefore: time.Unix(400, 0)}, expected: []string{"bob", "carol"}},
+		{query: Query{EmailVerified: &yes}, expected: []string{"alice", "carol", "alfred"}},
+		{query: Query{EmailVerified: &no, PhoneVerified: &yes}, expected: []string{"dave"}},
+		{query: Query{Search: "al"}, expected: []string{"alice", "al_bundy", "alfred"}},
+		{query: Query{Search: "al_"}, expected: []string{"al_bundy"}},
+		{query: Query{Search: "bundy@"}, expected: []string{"al_bundy"}},
+		{query: Query{Search: "al", SortBy: "username"}, expected: []string{"al_bundy", "alfred", "alice"}},
+		{query: Query{Role: "admin", Descending: true}, expected: []string{"alfred", "alice"}},
+	}
+
+	for i := range data {
+		page, err := list(mailBox, data[i].query)
+		if err != nil {
+			t.Fatalf("\t%s\tdata[%v] Nanos should not return any error -- %v", failure, i, err)
+		}
+		if !reflect.DeepEqual(usernames(page), data[i].expected) || page.NextCursor != "" {
+			t.Fatalf("\t%s\tdata[%v] expected %v got %v %q", failure, i, data[i].expected, usernames(page), page.NextCursor)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testPagination(t *testing.T) {
+	mailBox := NewListUsersNanos(1, 10, prepareDB(), Options{})
+
+	data := []struct {
+		query    Query
+		expected []string
+	}{
+		{query: Query{Limit: 2}, expected: []string{"alice", "bob", "carol", "dave", "al_bundy", "alfred"}},
+		{query: Query{Limit: 4, SortBy: "username"}, expected: []string{"al_bundy", "alfred", "alice", "bob", "carol", "dave"}},
+		{query: Query{Limit: 2, SortBy: "email", Descending: true}, expected: []string{"dave", "carol", "al_bundy", "bob", "alice", "alfred"}},
+		{query: Query{Limit: 1, SortBy: "created_at", Descending: true, Role: "admin"}, expected: []string{"alfred", "alice"}},
+	}
+
+	for i := range data {
+		var names []string
+		query := data[i].query
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatalf("\t%s\tdata[%v] pagination does not end", failure, i)
+			}
+			page, err := list(mailBox, query)
+			if err != nil {
+				t.Fatalf("\t%s\tdata[%v] Nanos should not return any error -- %v", failure, i, err)
+			}
+			if len(page.Users) > query.Limit {
+				t.Fatalf("\t%s\tdata[%v] page is bigger than the limit", failure, i)
+			}
+			names = append(names, usernames(page)...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+		if !reflect.DeepEqual(names, data[i].expected) {
+			t.Fatalf("\t%s\tdata[%v] expected %v got %v", failure, i, data[i].expected, names)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testInvalidQueries(t *testing.T) {
+	mailBox := NewListUsersNanos(1, 10, prepareDB(), Options{})
+	page, err := list(mailBox, Query{Limit: 1, SortBy: "username"})
+	if err != nil || page.NextCursor == "" {
+		t.Fatalf("\t%s\tfirst page should have a cursor -- %v", failure, err)
+	}
+
+	data := []Query{
+		{SortBy: "password"},
+		{Cursor: "not a cursor"},
+		{Cursor: page.NextCursor},
+		{Cursor: page.NextCursor, SortBy: "username", Descending: true},
+	}
+	for i := range data {
+		_, err := list(mailBox, data[i])
+		if err == nil {
+			t.Fatalf("\t%s\tdata[%v] Nanos should return error", failure, i)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
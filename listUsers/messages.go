@@ -0,0 +1,24 @@
+package listUsers
+
+import (
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the listUsers nanos
+type Request = Query
+
+// Response is the versioned response of the listUsers nanos
+type Response = Page
+
+// NewMessage wraps req into a message for the listUsers nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
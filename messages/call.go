@@ -0,0 +1,42 @@
+package messages
+
+import (
+	"context"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Call sends payload in an envelope to the nanos behind mailBox with ctx attached, and waits
+// for the reply or the end of ctx. Errors are *entities.Error, cancelled or deadline_exceeded
+// when ctx ended first. The reply is read with the DecodeResponse of the nanos package.
+func Call(ctx context.Context, mailBox chan nanos.Message, payload interface{}) (nanos.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nanos.Message{}, entities.ToError(err)
+	}
+
+	// buffered so the nanos never waits for us, nor drops the reply after we gave up
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	msg, err := NewMessage(payload, resTo, errTo)
+	if err != nil {
+		return nanos.Message{}, entities.ToError(err)
+	}
+	msg = WithContext(ctx, msg)
+
+	// the task queue may be full
+	select {
+	case mailBox <- msg:
+	case <-ctx.Done():
+		Forget(msg)
+		return nanos.Message{}, entities.ToError(ctx.Err())
+	}
+
+	select {
+	case res := <-resTo:
+		return res, nil
+	case err := <-errTo:
+		return nanos.Message{}, entities.ToError(err)
+	case <-ctx.Done():
+		return nanos.Message{}, entities.ToError(ctx.Err())
+	}
+}
@@ -0,0 +1,144 @@
+package messages
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"sync"
+	"time"
+)
+
+// contexts holds the contexts of in-flight messages by their request id, nanos.Message has no room for one
+var contexts sync.Map
+
+// endedGrace is how long the context of a message is kept once it ended, so a nanos that takes
+// the message from its queue meanwhile still sees the cancellation
+var endedGrace = time.Minute
+
+// attached is a context stored for a message, it only answers to the reply channels of that message.
+// stop ends the watch of its context.
+type attached struct {
+	ctx   context.Context
+	resTo chan<- nanos.Message
+	errTo chan<- error
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// WithContext attaches ctx to msg so the nanos can skip cancelled work, honor the deadline
+// in its DB calls and read request-scoped values such as the request id.
+//
+// Only envelopes can carry a context: msg is returned with a new request id in its envelope
+// and the context is found by it together with the reply channels of msg, so messages may
+// share reply channels. Contents that are not envelopes are returned as they are and get
+// context.Background.
+//
+// The nanos forgets the context once it replied to msg. It is also forgotten a while after ctx
+// is done, so it does not outlive a nanos that never replied. A context that can never be done,
+// such as one derived from context.Background by values only, is forgotten by the reply alone.
+func WithContext(ctx context.Context, msg nanos.Message) nanos.Message {
+	var envelope Envelope
+	err := json.Unmarshal(msg.Content, &envelope)
+	if err != nil || envelope.Version == 0 || envelope.Payload == nil {
+		return msg
+	}
+
+	// ids are never taken from the content, a taken one is drawn again
+	entry := &attached{ctx: ctx, resTo: msg.ResTo, errTo: msg.ErrTo, stop: make(chan struct{})}
+	for {
+		raw := make([]byte, 16)
+		_, err = rand.Read(raw)
+		if err != nil {
+			return msg
+		}
+		envelope.RequestID = hex.EncodeToString(raw)
+		if _, taken := contexts.LoadOrStore(envelope.RequestID, entry); !taken {
+			break
+		}
+	}
+	content, err := json.Marshal(envelope)
+	if err != nil {
+		forget(envelope.RequestID, entry)
+		return msg
+	}
+
+	if ctx.Done() != nil {
+		grace := endedGrace
+		go func(id string) {
+			select {
+			case <-ctx.Done():
+			case <-entry.stop:
+				return
+			}
+			timer := time.NewTimer(grace)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				forget(id, entry)
+			case <-entry.stop:
+			}
+		}(envelope.RequestID)
+	}
+	msg.Content = content
+	return msg
+}
+
+// Context returns the context attached to msg, context.Background when there is none
+// or it was forgotten
+func Context(msg nanos.Message) context.Context {
+	entry := attachedTo(msg)
+	if entry == nil {
+		return context.Background()
+	}
+	return entry.ctx
+}
+
+// Forget drops the context of msg. The nanos calls it once it replied,
+// callers only need it for a message they attached a context to but never sent.
+func Forget(msg nanos.Message) {
+	entry := attachedTo(msg)
+	if entry != nil {
+		forget(requestID(msg), entry)
+	}
+}
+
+// forget drops entry when it is still the context of id
+func forget(id string, entry *attached) {
+	stored, ok := contexts.Load(id)
+	if !ok || stored != entry {
+		return
+	}
+	contexts.Delete(id)
+	entry.once.Do(func() { close(entry.stop) })
+}
+
+// attachedTo returns the context attached to msg, nil when its request id is unknown
+// or was attached to other reply channels
+func attachedTo(msg nanos.Message) *attached {
+	id := requestID(msg)
+	if id == "" {
+		return nil
+	}
+	stored, ok := contexts.Load(id)
+	if !ok {
+		return nil
+	}
+	entry := stored.(*attached)
+	if entry.resTo != msg.ResTo || entry.errTo != msg.ErrTo {
+		return nil
+	}
+	return entry
+}
+
+// requestID returns the request id of the envelope of msg, empty when there is none
+func requestID(msg nanos.Message) string {
+	var envelope struct {
+		RequestID string `json:"request_id"`
+	}
+	if json.Unmarshal(msg.Content, &envelope) != nil {
+		return ""
+	}
+	return envelope.RequestID
+}
@@ -0,0 +1,142 @@
+package messages
+
+import (
+	"github.com/bashar-saleh/gonanos/nanos"
+	"log"
+	"time"
+)
+
+// DefaultReplyTimeout is how long a reply waits for its caller when Delivery.Timeout is zero
+const DefaultReplyTimeout = 5 * time.Second
+
+// Reasons a reply is dropped
+const (
+	DropNilChannel = "nil_channel"
+	DropTimeout    = "timeout"
+	DropNotReady   = "not_ready"
+	DropCancelled  = "cancelled"
+)
+
+// Delivery sends the replies of a nanos to the ResTo and ErrTo channels of its messages.
+//
+// A reply waits for the caller up to Timeout, DefaultReplyTimeout when zero. A negative Timeout
+// only delivers to callers that are already waiting, as the nanos did before Delivery existed.
+// A reply also stops waiting once the context attached to the message with WithContext is done.
+// Replies to nil channels or not taken in time are reported to OnDropped, or logged when it is nil.
+// OnDone, when set, is called once per message after its reply was delivered or dropped,
+// e.g. to count the messages still in flight.
+// A nil *Delivery uses the defaults.
+type Delivery struct {
+	Timeout   time.Duration
+	OnDropped func(dropped Dropped)
+	OnDone    func(msg nanos.Message)
+}
+
+// Dropped describes a reply that was not delivered, exactly one of Content and Err is set
+type Dropped struct {
+	Content []byte
+	Err     error
+	Reason  string
+}
+
+// Reply sends content to msg.ResTo
+func (d *Delivery) Reply(msg nanos.Message, content []byte) {
+	ctx := Context(msg)
+	defer d.done(msg)
+	defer Forget(msg)
+
+	if msg.ResTo == nil {
+		d.drop(Dropped{Content: content, Reason: DropNilChannel})
+		return
+	}
+
+	timeout := d.timeout()
+	if timeout < 0 {
+		select {
+		case msg.ResTo <- nanos.Message{Content: content}:
+		default:
+			d.drop(Dropped{Content: content, Reason: DropNotReady})
+		}
+		return
+	}
+
+	// a caller that is ready gets the reply even when its context is already done
+	select {
+	case msg.ResTo <- nanos.Message{Content: content}:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg.ResTo <- nanos.Message{Content: content}:
+	case <-timer.C:
+		d.drop(Dropped{Content: content, Reason: DropTimeout})
+	case <-ctx.Done():
+		d.drop(Dropped{Content: content, Reason: DropCancelled})
+	}
+}
+
+// Fail sends err to msg.ErrTo
+func (d *Delivery) Fail(msg nanos.Message, err error) {
+	ctx := Context(msg)
+	defer d.done(msg)
+	defer Forget(msg)
+
+	if msg.ErrTo == nil {
+		d.drop(Dropped{Err: err, Reason: DropNilChannel})
+		return
+	}
+
+	timeout := d.timeout()
+	if timeout < 0 {
+		select {
+		case msg.ErrTo <- err:
+		default:
+			d.drop(Dropped{Err: err, Reason: DropNotReady})
+		}
+		return
+	}
+
+	select {
+	case msg.ErrTo <- err:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg.ErrTo <- err:
+	case <-timer.C:
+		d.drop(Dropped{Err: err, Reason: DropTimeout})
+	case <-ctx.Done():
+		d.drop(Dropped{Err: err, Reason: DropCancelled})
+	}
+}
+
+func (d *Delivery) timeout() time.Duration {
+	if d == nil || d.Timeout == 0 {
+		return DefaultReplyTimeout
+	}
+	return d.Timeout
+}
+
+func (d *Delivery) done(msg nanos.Message) {
+	if d != nil && d.OnDone != nil {
+		d.OnDone(msg)
+	}
+}
+
+func (d *Delivery) drop(dropped Dropped) {
+	if d != nil && d.OnDropped != nil {
+		d.OnDropped(dropped)
+		return
+	}
+	if dropped.Err != nil {
+		log.Printf("reply dropped (%s): error %v", dropped.Reason, dropped.Err)
+		return
+	}
+	log.Printf("reply dropped (%s): %d bytes", dropped.Reason, len(dropped.Content))
+}
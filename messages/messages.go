@@ -0,0 +1,97 @@
+// Package messages defines the versioned envelope the auth nanos exchange.
+//
+// Every nanos package exports a Request and a Response type with helpers that wrap them into
+// an Envelope. A nanos that receives an envelope replies with an envelope of the same version.
+// Contents that are not envelopes are still read and replied in the format the nanos used
+// before envelopes existed, so older callers keep working.
+package messages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Version is the envelope format written by this version of auth-nanos
+const Version = 1
+
+// Envelope carries a request or a response with the version of its format.
+// RequestID is set by WithContext on requests that carry a context.
+type Envelope struct {
+	Version   int             `json:"version"`
+	Payload   json.RawMessage `json:"payload"`
+	RequestID string          `json:"request_id,omitempty"`
+}
+
+// UnsupportedVersionError is returned for envelopes written by a newer, unknown format
+type UnsupportedVersionError struct {
+	Version int
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("message version %d is not supported, the newest supported is %d", e.Version, Version)
+}
+
+func (e *UnsupportedVersionError) ErrorCode() string {
+	return "bad_request"
+}
+
+// ErrNotVersioned is returned by Decode when the content is not an envelope
+var ErrNotVersioned = errors.New("message is not versioned")
+
+// Encode wraps payload into an envelope of the current version
+func Encode(payload interface{}) ([]byte, error) {
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{Version: Version, Payload: rawPayload})
+}
+
+// Unwrap returns the payload of an envelope and true.
+// Contents that are not envelopes are returned as they are with false.
+func Unwrap(content []byte) ([]byte, bool, error) {
+	var envelope struct {
+		Version *int            `json:"version"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	err := json.Unmarshal(content, &envelope)
+	if err != nil || envelope.Version == nil || envelope.Payload == nil {
+		return content, false, nil
+	}
+	if *envelope.Version < 1 || *envelope.Version > Version {
+		return nil, true, &UnsupportedVersionError{Version: *envelope.Version}
+	}
+	return envelope.Payload, true, nil
+}
+
+// Decode reads the payload of an envelope into v
+func Decode(content []byte, v interface{}) error {
+	payload, versioned, err := Unwrap(content)
+	if err != nil {
+		return err
+	}
+	if !versioned {
+		return ErrNotVersioned
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// NewMessage wraps payload into a message for a nanos
+func NewMessage(payload interface{}, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	content, err := Encode(payload)
+	if err != nil {
+		return nanos.Message{}, err
+	}
+	return nanos.Message{Content: content, ResTo: resTo, ErrTo: errTo}, nil
+}
+
+// Reply returns the content a nanos replies with: the envelope of payload when the request
+// was versioned, the legacy content otherwise
+func Reply(versioned bool, legacy []byte, payload interface{}) ([]byte, error) {
+	if !versioned {
+		return legacy, nil
+	}
+	return Encode(payload)
+}
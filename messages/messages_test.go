@@ -0,0 +1,221 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMessages(t *testing.T) {
+	t.Run("Given contents in old and new formats When unwrap Then only envelopes are versioned", testUnwrap)
+	t.Run("Given a payload When wrapped and decoded Then it is the same", testRoundTrip)
+	t.Run("Given a request When reply Then the reply follows the request format", testReply)
+	t.Run("Given buffered, unbuffered and nil channels When deliver Then replies wait for the caller or are reported", testDelivery)
+	t.Run("Given a message with a context When the caller gives up Then the reply stops waiting and the context is forgotten", testContext)
+	t.Run("Given messages sharing reply channels When attach contexts Then each keeps its own", testSharedChannels)
+	t.Run("Given a message never replied When its context ends Then the context is forgotten", testContextEnds)
+}
+
+func testUnwrap(t *testing.T) {
+	data := []struct {
+		content   string
+		payload   string
+		versioned bool
+		err       bool
+	}{
+		{content: `{"version":1,"payload":{"id":1}}`, payload: `{"id":1}`, versioned: true},
+		{content: `{"id":1}`, payload: `{"id":1}`},
+		{content: `eyJhbGciOiJIUzI1NiJ9.e30.sig`, payload: `eyJhbGciOiJIUzI1NiJ9.e30.sig`},
+		{content: `{"version":2,"payload":{}}`, versioned: true, err: true},
+		{content: `{"version":0,"payload":{}}`, versioned: true, err: true},
+	}
+
+	for i := range data {
+		payload, versioned, err := Unwrap([]byte(data[i].content))
+		if (err != nil) != data[i].err || versioned != data[i].versioned || (!data[i].err && string(payload) != data[i].payload) {
+			t.Fatalf("\t%s\tdata[%v] unexpected unwrap -- %s %v %v", failure, i, payload, versioned, err)
+		}
+		if _, ok := err.(*UnsupportedVersionError); data[i].err && !ok {
+			t.Fatalf("\t%s\tdata[%v] error should be UnsupportedVersionError -- %v", failure, i, err)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testRoundTrip(t *testing.T) {
+	type payload struct {
+		Name string `json:"name"`
+	}
+	resTo := make(chan nanos.Message, 1)
+	msg, err := NewMessage(payload{Name: "bashar"}, resTo, nil)
+	if err != nil || msg.ResTo == nil {
+		t.Fatalf("\t%s\tNewMessage should not fail -- %v", failure, err)
+	}
+	var decoded payload
+	err = Decode(msg.Content, &decoded)
+	if err != nil || decoded.Name != "bashar" {
+		t.Fatalf("\t%s\tdecoded payload is not correct -- %v %v", failure, decoded, err)
+	}
+
+	err = Decode([]byte(`{"name":"bashar"}`), &decoded)
+	if err != ErrNotVersioned {
+		t.Fatalf("\t%s\tunversioned content should not be decoded -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testReply(t *testing.T) {
+	reply, err := Reply(false, []byte("legacy"), struct{}{})
+	if err != nil || string(reply) != "legacy" {
+		t.Fatalf("\t%s\tunversioned requests get the legacy reply -- %s %v", failure, reply, err)
+	}
+	reply, err = Reply(true, []byte("legacy"), map[string]int{"id": 1})
+	if err != nil || string(reply) != `{"version":1,"payload":{"id":1}}` {
+		t.Fatalf("\t%s\tversioned requests get an envelope -- %s %v", failure, reply, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testDelivery(t *testing.T) {
+	var dropped []Dropped
+	delivery := &Delivery{Timeout: 100 * time.Millisecond, OnDropped: func(d Dropped) { dropped = append(dropped, d) }}
+
+	// a buffered channel takes the reply without a waiting caller
+	buffered := make(chan nanos.Message, 1)
+	delivery.Reply(nanos.Message{ResTo: buffered}, []byte("buffered"))
+	if res := <-buffered; string(res.Content) != "buffered" {
+		t.Fatalf("\t%s\tbuffered reply is not correct -- %s", failure, res.Content)
+	}
+
+	// an unbuffered channel gets the reply when the caller comes within the timeout
+	unbuffered := make(chan error)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-unbuffered
+	}()
+	delivery.Fail(nanos.Message{ErrTo: unbuffered}, errors.New("late caller"))
+	if len(dropped) != 0 {
+		t.Fatalf("\t%s\tno reply should be dropped -- %v", failure, dropped)
+	}
+
+	// nothing waits
+	start := time.Now()
+	delivery.Reply(nanos.Message{ResTo: make(chan nanos.Message)}, []byte("late"))
+	if time.Since(start) < 100*time.Millisecond || len(dropped) != 1 || dropped[0].Reason != DropTimeout || string(dropped[0].Content) != "late" {
+		t.Fatalf("\t%s\tthe reply should wait for the timeout then be dropped -- %v", failure, dropped)
+	}
+	delivery.Fail(nanos.Message{}, errors.New("nowhere"))
+	if len(dropped) != 2 || dropped[1].Reason != DropNilChannel || dropped[1].Err == nil {
+		t.Fatalf("\t%s\ta reply to a nil channel should be dropped -- %v", failure, dropped)
+	}
+
+	// a negative timeout keeps the old non-blocking send
+	delivery.Timeout = -1
+	start = time.Now()
+	delivery.Reply(nanos.Message{ResTo: make(chan nanos.Message)}, nil)
+	if time.Since(start) > 50*time.Millisecond || len(dropped) != 3 || dropped[2].Reason != DropNotReady {
+		t.Fatalf("\t%s\tthe reply should be dropped at once -- %v", failure, dropped)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testContext(t *testing.T) {
+	type requestID struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), requestID{}, "req-1"))
+	resTo := make(chan nanos.Message)
+	msg, _ := NewMessage(map[string]int{"id": 1}, resTo, nil)
+	msg = WithContext(ctx, msg)
+
+	if Context(msg).Value(requestID{}) != "req-1" {
+		t.Fatalf("\t%s\tthe context should be attached to the message", failure)
+	}
+	if Context(nanos.Message{ResTo: make(chan nanos.Message)}) != context.Background() {
+		t.Fatalf("\t%s\tother messages should get the background context", failure)
+	}
+
+	var dropped []Dropped
+	delivery := &Delivery{Timeout: time.Minute, OnDropped: func(d Dropped) { dropped = append(dropped, d) }}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	delivery.Reply(msg, []byte("late"))
+	if time.Since(start) > time.Second || len(dropped) != 1 || dropped[0].Reason != DropCancelled {
+		t.Fatalf("\t%s\tthe reply should stop waiting once the caller gave up -- %v", failure, dropped)
+	}
+	if inFlight() != 0 || Context(msg) != context.Background() {
+		t.Fatalf("\t%s\tthe context should be forgotten after the reply, a resent message is not cancelled", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testSharedChannels(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	resTo := make(chan nanos.Message, 2)
+	errTo := make(chan error, 2)
+	first, _ := NewMessage(map[string]int{"id": 1}, resTo, errTo)
+	second, _ := NewMessage(map[string]int{"id": 2}, resTo, errTo)
+	first = WithContext(ctx, first)
+	second = WithContext(context.Background(), second)
+
+	cancel()
+	if Context(first).Err() != context.Canceled || Context(second).Err() != nil {
+		t.Fatalf("\t%s\tmessages sharing reply channels should keep their own context", failure)
+	}
+	payload, versioned, err := Unwrap(second.Content)
+	if err != nil || !versioned || string(payload) != `{"id":2}` {
+		t.Fatalf("\t%s\tthe request id should not change the payload -- %s", failure, payload)
+	}
+
+	// a content copied with its request id does not reach the context through other channels
+	forged := nanos.Message{Content: first.Content, ResTo: make(chan nanos.Message)}
+	Forget(forged)
+	if Context(forged) != context.Background() || Context(first).Err() != context.Canceled {
+		t.Fatalf("\t%s\tonly the reply channels of the message should reach its context", failure)
+	}
+	Forget(first)
+	Forget(second)
+	if inFlight() != 0 {
+		t.Fatalf("\t%s\tno context should be left in flight -- %d", failure, inFlight())
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testContextEnds(t *testing.T) {
+	defer func(grace time.Duration) { endedGrace = grace }(endedGrace)
+	endedGrace = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	msg, _ := NewMessage(map[string]int{"id": 1}, make(chan nanos.Message), nil)
+	msg = WithContext(ctx, msg)
+
+	// the nanos never replies, as when its worker panicked
+	<-ctx.Done()
+	if Context(msg).Err() != context.DeadlineExceeded {
+		t.Fatalf("\t%s\ta nanos taking the message late should still see it ended", failure)
+	}
+	deadline := time.Now().Add(time.Second)
+	for inFlight() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if inFlight() != 0 || Context(msg) != context.Background() {
+		t.Fatalf("\t%s\tthe context should be forgotten a while after it ended", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+// inFlight counts the contexts still attached to messages
+func inFlight() int {
+	count := 0
+	contexts.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
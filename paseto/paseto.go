@@ -0,0 +1,201 @@
+package paseto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/ed25519"
+	"strings"
+	"time"
+)
+
+// The headers of the PASETO v4 tokens. Version 4 fixes its algorithms, a token can not choose
+// how it is verified as a JWT does with its alg header.
+const (
+	HeaderPublic = "v4.public."
+	HeaderLocal  = "v4.local."
+)
+
+// KeySize is the size of the v4.local keys and of the Ed25519 seeds of the v4.public keys
+const KeySize = 32
+
+// ErrInvalidToken does not tell whether the token is malformed, forged or of another key
+var ErrInvalidToken = errors.New("token is not valid")
+
+// Keys are the keys of the v4 tokens, a purpose without its key is refused
+type Keys struct {
+	// SecretKey signs the v4.public tokens, PublicKey verifies them
+	SecretKey ed25519.PrivateKey
+	PublicKey ed25519.PublicKey
+	// LocalKey encrypts and decrypts the v4.local tokens, KeySize bytes
+	LocalKey []byte
+}
+
+// Claims are the claims of the access tokens, the ones of validateJWT with the PASETO
+// registered claims exp and iat as RFC 3339 times
+type Claims struct {
+	ID        int       `json:"id"`
+	Roles     []string  `json:"roles"`
+	SessionID string    `json:"sid,omitempty"`
+	IssuedAt  time.Time `json:"iat"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// Sign returns the v4.public token of message signed with secretKey, footer is sent in clear
+// and implicit is only authenticated
+func Sign(secretKey ed25519.PrivateKey, message []byte, footer []byte, implicit []byte) (string, error) {
+	if len(secretKey) != ed25519.PrivateKeySize {
+		return "", errors.New("paseto: v4.public needs an Ed25519 secret key")
+	}
+	signature := ed25519.Sign(secretKey, pae([]byte(HeaderPublic), message, footer, implicit))
+	return encode(HeaderPublic, append(append([]byte{}, message...), signature...), footer), nil
+}
+
+// Verify returns the message and footer of a v4.public token signed by the key of publicKey
+func Verify(publicKey ed25519.PublicKey, token string, implicit []byte) ([]byte, []byte, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, nil, errors.New("paseto: v4.public needs an Ed25519 public key")
+	}
+	payload, footer, err := decode(HeaderPublic, token)
+	if err != nil || len(payload) < ed25519.SignatureSize {
+		return nil, nil, ErrInvalidToken
+	}
+	message := payload[:len(payload)-ed25519.SignatureSize]
+	signature := payload[len(payload)-ed25519.SignatureSize:]
+	if !ed25519.Verify(publicKey, pae([]byte(HeaderPublic), message, footer, implicit), signature) {
+		return nil, nil, ErrInvalidToken
+	}
+	return message, footer, nil
+}
+
+// Encrypt returns the v4.local token of message encrypted with key under a random nonce,
+// footer is sent in clear and implicit is only authenticated
+func Encrypt(key []byte, message []byte, footer []byte, implicit []byte) (string, error) {
+	nonce := make([]byte, 32)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	return encrypt(key, nonce, message, footer, implicit)
+}
+
+func encrypt(key []byte, nonce []byte, message []byte, footer []byte, implicit []byte) (string, error) {
+	if len(key) != KeySize {
+		return "", errors.New("paseto: v4.local needs a 32 bytes key")
+	}
+	encryptionKey, counterNonce, authKey := splitKey(key, nonce)
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(message))
+	cipher.XORKeyStream(ciphertext, message)
+
+	tag := mac(authKey, pae([]byte(HeaderLocal), nonce, ciphertext, footer, implicit))
+	payload := append(append(append([]byte{}, nonce...), ciphertext...), tag...)
+	return encode(HeaderLocal, payload, footer), nil
+}
+
+// Decrypt returns the message and footer of a v4.local token encrypted with key
+func Decrypt(key []byte, token string, implicit []byte) ([]byte, []byte, error) {
+	if len(key) != KeySize {
+		return nil, nil, errors.New("paseto: v4.local needs a 32 bytes key")
+	}
+	payload, footer, err := decode(HeaderLocal, token)
+	if err != nil || len(payload) < 64 {
+		return nil, nil, ErrInvalidToken
+	}
+	nonce := payload[:32]
+	ciphertext := payload[32 : len(payload)-32]
+	tag := payload[len(payload)-32:]
+
+	// authenticate before decrypting anything
+	encryptionKey, counterNonce, authKey := splitKey(key, nonce)
+	if subtle.ConstantTimeCompare(tag, mac(authKey, pae([]byte(HeaderLocal), nonce, ciphertext, footer, implicit))) != 1 {
+		return nil, nil, ErrInvalidToken
+	}
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	message := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(message, ciphertext)
+	return message, footer, nil
+}
+
+// splitKey derives the XChaCha20 key and nonce and the BLAKE2b-MAC key of a v4.local token
+func splitKey(key []byte, nonce []byte) ([]byte, []byte, []byte) {
+	derived := keyedHash(56, key, []byte("paseto-encryption-key"), nonce)
+	return derived[:32], derived[32:], keyedHash(32, key, []byte("paseto-auth-key-for-aead"), nonce)
+}
+
+func mac(authKey []byte, message []byte) []byte {
+	return keyedHash(32, authKey, message)
+}
+
+// keyedHash returns the size bytes BLAKE2b of parts keyed with key
+func keyedHash(size int, key []byte, parts ...[]byte) []byte {
+	h, err := blake2b.New(size, key)
+	if err != nil {
+		// only reachable with sizes or keys longer than 64 bytes
+		panic(err)
+	}
+	for _, part := range parts {
+		_, _ = h.Write(part)
+	}
+	return h.Sum(nil)
+}
+
+// pae is the pre-authentication encoding of PASETO, every piece prefixed by its length so no
+// two lists of pieces encode the same
+func pae(pieces ...[]byte) []byte {
+	var buf bytes.Buffer
+	writeLength := func(n int) {
+		var length [8]byte
+		binary.LittleEndian.PutUint64(length[:], uint64(n)&^(1<<63))
+		buf.Write(length[:])
+	}
+	writeLength(len(pieces))
+	for _, piece := range pieces {
+		writeLength(len(piece))
+		buf.Write(piece)
+	}
+	return buf.Bytes()
+}
+
+func encode(header string, payload []byte, footer []byte) string {
+	token := header + base64.RawURLEncoding.EncodeToString(payload)
+	if len(footer) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+	return token
+}
+
+// decode returns the payload and footer of a token of header
+func decode(header string, token string) ([]byte, []byte, error) {
+	if !strings.HasPrefix(token, header) {
+		return nil, nil, ErrInvalidToken
+	}
+	parts := strings.Split(token[len(header):], ".")
+	if len(parts) > 2 {
+		return nil, nil, ErrInvalidToken
+	}
+	// strict decoding refuses the encodings of the same bytes that differ in their padding bits
+	payload, err := base64.RawURLEncoding.Strict().DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+	var footer []byte
+	if len(parts) == 2 {
+		footer, err = base64.RawURLEncoding.Strict().DecodeString(parts[1])
+		if err != nil || len(footer) == 0 {
+			return nil, nil, ErrInvalidToken
+		}
+	}
+	return payload, footer, nil
+}
@@ -0,0 +1,169 @@
+package paseto
+
+import (
+	"encoding/hex"
+	"golang.org/x/crypto/ed25519"
+	"testing"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestPaseto(t *testing.T) {
+	t.Run("Given the v4.local test vectors When encrypt and decrypt Then the tokens and messages match", testLocalVectors)
+	t.Run("Given the v4.public test vectors When sign and verify Then the tokens and messages match", testPublicVectors)
+	t.Run("Given tampered tokens and wrong keys When decrypt or verify Then ErrInvalidToken is returned", testRefused)
+}
+
+// the test vectors of the PASETO specification
+const (
+	localKey  = "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f"
+	publicKey = "1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2"
+	secretKey = "b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a37741eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2"
+)
+
+type vector struct {
+	name     string
+	nonce    string
+	token    string
+	payload  string
+	footer   string
+	implicit string
+}
+
+var localVectors = []vector{
+	{
+		name:    "4-E-1",
+		nonce:   "0000000000000000000000000000000000000000000000000000000000000000",
+		token:   "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg",
+		payload: `{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`,
+	},
+	{
+		name:    "4-E-3",
+		nonce:   "df654812bac492663825520ba2f6e67cf5ca5bdc13d4e7507a98cc4c2fcc3ad8",
+		token:   "v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WkwMsYXw6FSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t6-tyebyWG6Ov7kKvBdkrrAJ837lKP3iDag2hzUPHuMKA",
+		payload: `{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`,
+	},
+	{
+		name:     "4-E-9",
+		nonce:    "df654812bac492663825520ba2f6e67cf5ca5bdc13d4e7507a98cc4c2fcc3ad8",
+		token:    "v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WiA8rd3wgFSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t6tybdlmnMwcDMw0YxA_gFSE_IUWl78aMtOepFYSWYfQA.YXJiaXRyYXJ5LXN0cmluZy10aGF0LWlzbid0LWpzb24",
+		payload:  `{"data":"this is a hidden message","exp":"2022-01-01T00:00:00+00:00"}`,
+		footer:   "arbitrary-string-that-isn't-json",
+		implicit: `{"test-vector":"4-E-9"}`,
+	},
+}
+
+var publicVectors = []vector{
+	{
+		name:    "4-S-1",
+		token:   "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA",
+		payload: `{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`,
+	},
+	{
+		name:     "4-S-3",
+		token:    "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9NPWciuD3d0o5eXJXG5pJy-DiVEoyPYWs1YSTwWHNJq6DZD3je5gf-0M4JR9ipdUSJbIovzmBECeaWmaqcaP0DQ.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+		payload:  `{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`,
+		footer:   `{"kid":"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN"}`,
+		implicit: `{"test-vector":"4-S-3"}`,
+	},
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func testLocalVectors(t *testing.T) {
+	key := decodeHex(t, localKey)
+	for _, v := range localVectors {
+		token, err := encrypt(key, decodeHex(t, v.nonce), []byte(v.payload), []byte(v.footer), []byte(v.implicit))
+		if err != nil || token != v.token {
+			t.Fatalf("\t%s\t%s should encrypt to its token -- %v %v", failure, v.name, token, err)
+		}
+		message, footer, err := Decrypt(key, v.token, []byte(v.implicit))
+		if err != nil || string(message) != v.payload || string(footer) != v.footer {
+			t.Fatalf("\t%s\t%s should decrypt to its payload -- %s %v", failure, v.name, message, err)
+		}
+	}
+
+	// random nonces give distinct tokens of the same message
+	first, _ := Encrypt(key, []byte("message"), nil, nil)
+	second, _ := Encrypt(key, []byte("message"), nil, nil)
+	message, _, err := Decrypt(key, first, nil)
+	if first == second || err != nil || string(message) != "message" {
+		t.Fatalf("\t%s\tEncrypt should use a random nonce -- %v %v %v", failure, first, second, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testPublicVectors(t *testing.T) {
+	for _, v := range publicVectors {
+		token, err := Sign(ed25519.PrivateKey(decodeHex(t, secretKey)), []byte(v.payload), []byte(v.footer), []byte(v.implicit))
+		if err != nil || token != v.token {
+			t.Fatalf("\t%s\t%s should sign to its token -- %v %v", failure, v.name, token, err)
+		}
+		message, footer, err := Verify(ed25519.PublicKey(decodeHex(t, publicKey)), v.token, []byte(v.implicit))
+		if err != nil || string(message) != v.payload || string(footer) != v.footer {
+			t.Fatalf("\t%s\t%s should verify to its payload -- %s %v", failure, v.name, message, err)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testRefused(t *testing.T) {
+	key := decodeHex(t, localKey)
+	public := ed25519.PublicKey(decodeHex(t, publicKey))
+	otherKey := make([]byte, KeySize)
+	otherPublic, _, _ := ed25519.GenerateKey(nil)
+	local, signed := localVectors[2], publicVectors[1]
+
+	data := []struct {
+		name  string
+		check func() error
+	}{
+		// 4-F-4, the last character only differs in padding bits
+		{name: "non canonical base64", check: func() error {
+			_, _, err := Decrypt(key, localVectors[0].token[:len(localVectors[0].token)-1]+"h", nil)
+			return err
+		}},
+		{name: "tampered ciphertext", check: func() error {
+			_, _, err := Decrypt(key, local.token[:20]+"A"+local.token[21:], []byte(local.implicit))
+			return err
+		}},
+		{name: "other implicit assertion", check: func() error {
+			_, _, err := Decrypt(key, local.token, []byte("{}"))
+			return err
+		}},
+		{name: "other local key", check: func() error {
+			_, _, err := Decrypt(otherKey, local.token, []byte(local.implicit))
+			return err
+		}},
+		{name: "tampered footer", check: func() error {
+			_, _, err := Verify(public, signed.token[:len(signed.token)-4]+"fQ", []byte(signed.implicit))
+			return err
+		}},
+		{name: "other public key", check: func() error {
+			_, _, err := Verify(otherPublic, signed.token, []byte(signed.implicit))
+			return err
+		}},
+		// 4-F-1 and 4-F-2, a token is only accepted for its own purpose
+		{name: "public token decrypted", check: func() error {
+			_, _, err := Decrypt(key, signed.token, []byte(signed.implicit))
+			return err
+		}},
+		{name: "local token verified", check: func() error {
+			_, _, err := Verify(public, local.token, []byte(local.implicit))
+			return err
+		}},
+	}
+	for i := range data {
+		if err := data[i].check(); err != ErrInvalidToken {
+			t.Fatalf("\t%s\tdata[%v] %s should be refused -- %v", failure, i, data[i].name, err)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,27 @@
+package queryAuditEvents
+
+import (
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the queryAuditEvents nanos
+type Request = Query
+
+// Response is the versioned response of the queryAuditEvents nanos, unversioned requests get the bare list
+type Response struct {
+	Events []audit.Event `json:"events"`
+}
+
+// NewMessage wraps req into a message for the queryAuditEvents nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
@@ -0,0 +1,158 @@
+package queryAuditEvents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// Options are the optional policies of the queryAuditEvents nanos
+type Options struct {
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+// NewQueryAuditEventsNanos returns the admin nanos that reads the events stored by audit.SQLiteSink.
+// It trusts its callers, so it must only be reachable by admins.
+func NewQueryAuditEventsNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	db *sql.DB,
+	options Options,
+) chan nanos.Message {
+
+	worker := &queryAuditEventsWorker{
+		db:       db,
+		delivery: options.Delivery,
+	}
+
+	// the sink owns the audit_events table
+	audit.NewSQLiteSink(db, nil)
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+// Query is the content of a query audit events message, zero fields do not filter.
+// Events are returned newest first; to read older ones send BeforeID as the id of the last returned event.
+type Query struct {
+	Actor    string    `json:"actor"`
+	Subject  string    `json:"subject"`
+	Action   string    `json:"action"`
+	Outcome  string    `json:"outcome"`
+	Source   string    `json:"source"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	BeforeID int64     `json:"before_id"`
+	// Limit defaults to 50 and can not exceed 500
+	Limit int `json:"limit"`
+}
+
+type queryAuditEventsWorker struct {
+	db       *sql.DB
+	delivery *messages.Delivery
+}
+
+func (w *queryAuditEventsWorker) Work(msg nanos.Message) {
+
+	// extract query from msg
+	var query Query
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &query)
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	events, err := w.query(query)
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	rawEvents, err := json.Marshal(events)
+	if err == nil {
+		rawEvents, err = messages.Reply(versioned, rawEvents, Response{Events: events})
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// sending the response back
+	w.delivery.Reply(msg, rawEvents)
+
+}
+
+func (w *queryAuditEventsWorker) query(query Query) ([]audit.Event, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	where := []string{"1 = 1"}
+	var args []interface{}
+	for _, filter := range []struct {
+		column string
+		value  string
+	}{
+		{column: "actor", value: query.Actor},
+		{column: "subject", value: query.Subject},
+		{column: "action", value: query.Action},
+		{column: "outcome", value: query.Outcome},
+		{column: "source", value: query.Source},
+	} {
+		if filter.value != "" {
+			where = append(where, filter.column+" = ?")
+			args = append(args, filter.value)
+		}
+	}
+	if !query.From.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, query.From.UnixNano())
+	}
+	if !query.To.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, query.To.UnixNano())
+	}
+	if query.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, query.BeforeID)
+	}
+	args = append(args, limit)
+
+	rows, err := w.db.Query("SELECT "+audit.EventsColumns+" FROM audit_events WHERE "+strings.Join(where, " AND ")+" ORDER BY id DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []audit.Event{}
+	for rows.Next() {
+		event, err := audit.ScanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,94 @@
+package queryAuditEvents
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"os"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func query(mailBox chan nanos.Message, q Query) ([]audit.Event, error) {
+	rawQuery, _ := json.Marshal(q)
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	mailBox <- nanos.Message{Content: rawQuery, ResTo: resTo, ErrTo: errTo}
+
+	select {
+	case res := <-resTo:
+		var events []audit.Event
+		err := json.Unmarshal(res.Content, &events)
+		return events, err
+	case err := <-errTo:
+		return nil, err
+	case <-time.After(time.Second * 2):
+		return nil, errors.New("timeout")
+	}
+}
+
+func TestQueryAuditEvents(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	sink := audit.NewSQLiteSink(db, nil)
+	start := time.Unix(1000, 0)
+	events := []audit.Event{
+		{Time: start, Actor: "1", Subject: "1", Action: audit.ActionSignin, Outcome: audit.OutcomeSuccess, Source: "10.0.0.1"},
+		{Time: start.Add(time.Minute), Actor: "", Subject: "bob", Action: audit.ActionSignin, Outcome: audit.OutcomeFailure, Source: "10.0.0.2", Reason: "unknown_user"},
+		{Time: start.Add(2 * time.Minute), Actor: "1", Subject: "2", Action: audit.ActionChangeStatus, Outcome: audit.OutcomeSuccess},
+		{Time: start.Add(3 * time.Minute), Actor: "2", Subject: "2", Action: audit.ActionSignin, Outcome: audit.OutcomeFailure, Reason: "disabled"},
+	}
+	for i := range events {
+		if err := sink.Write(events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mailBox := NewQueryAuditEventsNanos(1, 10, db, Options{})
+
+	data := []struct {
+		query    Query
+		expected []int64
+	}{
+		{query: Query{}, expected: []int64{4, 3, 2, 1}},
+		{query: Query{Action: audit.ActionSignin, Outcome: audit.OutcomeFailure}, expected: []int64{4, 2}},
+		{query: Query{Actor: "1"}, expected: []int64{3, 1}},
+		{query: Query{Subject: "2"}, expected: []int64{4, 3}},
+		{query: Query{Source: "10.0.0.2"}, expected: []int64{2}},
+		{query: Query{From: start.Add(time.Minute), To: start.Add(3 * time.Minute)}, expected: []int64{3, 2}},
+		{query: Query{Limit: 2}, expected: []int64{4, 3}},
+		{query: Query{Limit: 2, BeforeID: 3}, expected: []int64{2, 1}},
+	}
+
+	for i := range data {
+		found, err := query(mailBox, data[i].query)
+		if err != nil {
+			t.Fatalf("\t%s\tdata[%v] Nanos should not return any error -- %v", failure, i, err)
+		}
+		var ids []int64
+		for _, event := range found {
+			ids = append(ids, event.ID)
+		}
+		if len(ids) != len(data[i].expected) {
+			t.Fatalf("\t%s\tdata[%v] expected %v got %v", failure, i, data[i].expected, ids)
+		}
+		for j := range ids {
+			if ids[j] != data[i].expected[j] {
+				t.Fatalf("\t%s\tdata[%v] expected %v got %v", failure, i, data[i].expected, ids)
+			}
+		}
+	}
+	if found, _ := query(mailBox, Query{Source: "10.0.0.2"}); found[0].Reason != "unknown_user" || !found[0].Time.Equal(start.Add(time.Minute)) {
+		t.Fatalf("\t%s\tthe event is not read back as written -- %v", failure, found[0])
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
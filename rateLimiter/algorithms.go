@@ -0,0 +1,139 @@
+package rateLimiter
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Limiter decides whether one more request for the given key is allowed at now.
+// When it is not, it returns how long the caller should wait before retrying.
+// Implementations must be safe for concurrent use.
+type Limiter interface {
+	Allow(key string, now time.Time) (bool, time.Duration)
+}
+
+// keys count above which idle entries are dropped
+const pruneThreshold = 10000
+
+// ErrInvalidLimit is returned by the Limiter constructors for a non-positive count or duration
+var ErrInvalidLimit = errors.New("rate limiter needs a positive count and duration")
+
+type tokenBucket struct {
+	mu          sync.Mutex
+	capacity    float64
+	refillEvery time.Duration
+	buckets     map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a Limiter that allows bursts of up to capacity requests
+// per key and refills one token every refillEvery
+func NewTokenBucket(capacity int, refillEvery time.Duration) (Limiter, error) {
+	if capacity <= 0 || refillEvery <= 0 {
+		return nil, ErrInvalidLimit
+	}
+	return &tokenBucket{
+		capacity:    float64(capacity),
+		refillEvery: refillEvery,
+		buckets:     make(map[string]*bucket),
+	}, nil
+}
+
+func (l *tokenBucket) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buckets) > pruneThreshold {
+		l.prune(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.capacity, last: now}
+		l.buckets[key] = b
+	}
+
+	// refill
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(elapsed) / float64(l.refillEvery)
+		if b.tokens > l.capacity {
+			b.tokens = l.capacity
+		}
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) * float64(l.refillEvery))
+}
+
+// prune drops buckets that are full again, they behave the same as missing ones
+func (l *tokenBucket) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+float64(now.Sub(b.last))/float64(l.refillEvery) >= l.capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+type slidingWindow struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	logs   map[string][]time.Time
+}
+
+// NewSlidingWindow returns a Limiter that allows at most limit requests per key
+// within any window-long period
+func NewSlidingWindow(limit int, window time.Duration) (Limiter, error) {
+	if limit <= 0 || window <= 0 {
+		return nil, ErrInvalidLimit
+	}
+	return &slidingWindow{
+		limit:  limit,
+		window: window,
+		logs:   make(map[string][]time.Time),
+	}, nil
+}
+
+func (l *slidingWindow) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.logs) > pruneThreshold {
+		l.prune(now)
+	}
+
+	log := l.expire(l.logs[key], now)
+	if len(log) < l.limit {
+		l.logs[key] = append(log, now)
+		return true, 0
+	}
+	l.logs[key] = log
+	return false, log[0].Add(l.window).Sub(now)
+}
+
+// expire drops the timestamps that left the window
+func (l *slidingWindow) expire(log []time.Time, now time.Time) []time.Time {
+	start := now.Add(-l.window)
+	i := 0
+	for i < len(log) && !log[i].After(start) {
+		i++
+	}
+	return log[i:]
+}
+
+func (l *slidingWindow) prune(now time.Time) {
+	for key, log := range l.logs {
+		if len(l.expire(log, now)) == 0 {
+			delete(l.logs, key)
+		}
+	}
+}
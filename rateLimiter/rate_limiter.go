@@ -0,0 +1,146 @@
+package rateLimiter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"time"
+)
+
+// Options are the optional policies of the rateLimiter nanos
+type Options struct {
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+func NewRateLimiterNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	limiter Limiter,
+	options Options,
+) chan nanos.Message {
+
+	worker := &rateLimiterWorker{
+		limiter:  limiter,
+		now:      time.Now,
+		delivery: options.Delivery,
+	}
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+// Request asks whether one more request from Key is allowed.
+// Key is built by the caller from the operation and the source, e.g. "signin:10.0.0.1"
+type Request struct {
+	Key string `json:"key"`
+}
+
+// Decision is the response of the rate limiter nanos
+type Decision struct {
+	Allowed    bool          `json:"allowed"`
+	RetryAfter time.Duration `json:"retry_after"`
+}
+
+// LimitedError is returned by Check when the source exceeded its limit
+type LimitedError struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("too many requests for %s, retry after %s", e.Key, e.RetryAfter)
+}
+
+// ErrorCode is the code the nanos that consult the limiter refuse with
+func (e *LimitedError) ErrorCode() string {
+	return "rate_limited"
+}
+
+type rateLimiterWorker struct {
+	limiter  Limiter
+	now      func() time.Time
+	delivery *messages.Delivery
+}
+
+func (w *rateLimiterWorker) Work(msg nanos.Message) {
+
+	// extract content from msg
+	var req Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &req)
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	// consult the limiter
+	allowed, retryAfter := w.limiter.Allow(req.Key, w.now())
+	decision := Decision{Allowed: allowed, RetryAfter: retryAfter}
+	rawDecision, err := json.Marshal(decision)
+	if err == nil {
+		rawDecision, err = messages.Reply(versioned, rawDecision, decision)
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// sending the response back
+	w.delivery.Reply(msg, rawDecision)
+
+}
+
+// Check asks the rate limiter nanos behind mailBox about key and returns a *LimitedError
+// when the request must be refused. A nil mailBox allows everything.
+// It gives up with the error of ctx when ctx ends first, even while the queue of the limiter is full.
+func Check(ctx context.Context, mailBox chan nanos.Message, key string) error {
+	if mailBox == nil {
+		return nil
+	}
+
+	// buffered so the reply is not dropped before we start waiting
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	msg, err := NewMessage(Request{Key: key}, resTo, errTo)
+	if err != nil {
+		return err
+	}
+	msg = messages.WithContext(ctx, msg)
+
+	select {
+	case mailBox <- msg:
+	case <-ctx.Done():
+		messages.Forget(msg)
+		return ctx.Err()
+	}
+
+	select {
+	case res := <-resTo:
+		decision, err := DecodeResponse(res)
+		if err != nil {
+			return err
+		}
+		if !decision.Allowed {
+			return &LimitedError{Key: key, RetryAfter: decision.RetryAfter}
+		}
+		return nil
+	case err := <-errTo:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(5 * time.Second):
+		return errors.New("rate limiter did not respond")
+	}
+}
@@ -0,0 +1,154 @@
+package rateLimiter
+
+import (
+	"context"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("Given token bucket When burst is spent Then requests are refused until refill", testTokenBucket)
+	t.Run("Given sliding window When limit is reached Then requests are refused until the oldest one leaves the window", testSlidingWindow)
+	t.Run("Given non-positive counts or durations When construct limiters Then ErrInvalidLimit is returned", testInvalidLimits)
+	t.Run("Given different keys When one is limited Then the other is still allowed", testKeysAreIndependent)
+	t.Run("Given rate limiter nanos When Check exceeds the limit Then LimitedError is returned", testCheck)
+}
+
+func testTokenBucket(t *testing.T) {
+	limiter, _ := NewTokenBucket(2, time.Second)
+	start := time.Unix(1000, 0)
+
+	data := []struct {
+		at         time.Duration
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{at: 0, allowed: true},
+		{at: 0, allowed: true},
+		{at: 0, allowed: false, retryAfter: time.Second},
+		{at: 500 * time.Millisecond, allowed: false, retryAfter: 500 * time.Millisecond},
+		{at: time.Second, allowed: true},
+		{at: 10 * time.Second, allowed: true},
+		{at: 10 * time.Second, allowed: true},
+		{at: 10 * time.Second, allowed: false, retryAfter: time.Second},
+	}
+
+	for i := range data {
+		allowed, retryAfter := limiter.Allow("signin:10.0.0.1", start.Add(data[i].at))
+		if allowed != data[i].allowed || retryAfter != data[i].retryAfter {
+			t.Fatalf("\t%s\tdata[%v] expected (%v, %v) got (%v, %v)", failure, i, data[i].allowed, data[i].retryAfter, allowed, retryAfter)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testSlidingWindow(t *testing.T) {
+	limiter, _ := NewSlidingWindow(2, time.Minute)
+	start := time.Unix(1000, 0)
+
+	data := []struct {
+		at         time.Duration
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{at: 0, allowed: true},
+		{at: 20 * time.Second, allowed: true},
+		{at: 30 * time.Second, allowed: false, retryAfter: 30 * time.Second},
+		{at: 60 * time.Second, allowed: true},
+		{at: 70 * time.Second, allowed: false, retryAfter: 10 * time.Second},
+		{at: 80 * time.Second, allowed: true},
+	}
+
+	for i := range data {
+		allowed, retryAfter := limiter.Allow("register:10.0.0.1", start.Add(data[i].at))
+		if allowed != data[i].allowed || retryAfter != data[i].retryAfter {
+			t.Fatalf("\t%s\tdata[%v] expected (%v, %v) got (%v, %v)", failure, i, data[i].allowed, data[i].retryAfter, allowed, retryAfter)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testInvalidLimits(t *testing.T) {
+	data := []struct {
+		count    int
+		duration time.Duration
+	}{
+		{count: 0, duration: time.Minute},
+		{count: -1, duration: time.Minute},
+		{count: 1, duration: 0},
+		{count: 1, duration: -time.Second},
+	}
+
+	for i := range data {
+		if _, err := NewTokenBucket(data[i].count, data[i].duration); err != ErrInvalidLimit {
+			t.Fatalf("\t%s\tdata[%v] token bucket should be refused -- %v", failure, i, err)
+		}
+		if _, err := NewSlidingWindow(data[i].count, data[i].duration); err != ErrInvalidLimit {
+			t.Fatalf("\t%s\tdata[%v] sliding window should be refused -- %v", failure, i, err)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testKeysAreIndependent(t *testing.T) {
+	now := time.Unix(1000, 0)
+	bucket, _ := NewTokenBucket(1, time.Minute)
+	window, _ := NewSlidingWindow(1, time.Minute)
+	for _, limiter := range []Limiter{bucket, window} {
+		if allowed, _ := limiter.Allow("signin:10.0.0.1", now); !allowed {
+			t.Fatalf("\t%s\tfirst request should be allowed", failure)
+		}
+		if allowed, _ := limiter.Allow("signin:10.0.0.1", now); allowed {
+			t.Fatalf("\t%s\tsecond request of the same key should be refused", failure)
+		}
+		if allowed, _ := limiter.Allow("signin:10.0.0.2", now); !allowed {
+			t.Fatalf("\t%s\tanother key should be allowed", failure)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testCheck(t *testing.T) {
+	window, _ := NewSlidingWindow(1, time.Minute)
+	mailBox := NewRateLimiterNanos(1, 10, window, Options{})
+
+	err := Check(context.Background(), mailBox, "signin:10.0.0.1")
+	if err != nil {
+		t.Fatalf("\t%s\tfirst request should be allowed -- %v", failure, err)
+	}
+	err = Check(context.Background(), mailBox, "signin:10.0.0.1")
+	limitedErr, ok := err.(*LimitedError)
+	if !ok {
+		t.Fatalf("\t%s\tsecond request should return *LimitedError -- %v", failure, err)
+	}
+	if limitedErr.RetryAfter <= 0 {
+		t.Fatalf("\t%s\tRetryAfter should be positive -- %v", failure, limitedErr.RetryAfter)
+	}
+
+	// malformed request
+	errTo := make(chan error, 1)
+	mailBox <- nanos.Message{Content: []byte("{"), ErrTo: errTo}
+	select {
+	case <-errTo:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("\t%s\t Timeout", failure)
+	}
+
+	// a full queue does not hold the caller past its context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := Check(ctx, make(chan nanos.Message), "signin:10.0.0.1"); err != context.DeadlineExceeded || time.Since(start) > time.Second {
+		t.Fatalf("\t%s\tCheck should give up with the context -- %v", failure, err)
+	}
+
+	// nil mailBox allows everything
+	if err := Check(context.Background(), nil, "signin:10.0.0.1"); err != nil {
+		t.Fatalf("\t%s\tnil mailBox should allow -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
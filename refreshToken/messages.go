@@ -0,0 +1,29 @@
+package refreshToken
+
+import (
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the refreshToken nanos, unversioned requests have the same shape
+type Request struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Response is the versioned response of the refreshToken nanos, unversioned requests get the bare tokens
+type Response struct {
+	signinUser.Tokens
+}
+
+// NewMessage wraps req into a message for the refreshToken nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
@@ -0,0 +1,178 @@
+package refreshToken
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"strconv"
+	"time"
+)
+
+// Options are the optional policies of the refreshToken nanos
+type Options struct {
+	// AuditSink records the audit events, nil records none
+	AuditSink audit.Sink
+	// AccessTokens issues the access tokens like the ones of signin, nil signs JWTs with key
+	AccessTokens signinUser.AccessTokenIssuer
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+// NewRefreshTokenNanos returns the nanos that trades the refresh token of a session for new tokens.
+// Its content is {"refresh_token": "..."} and it replies like signin, with the same session id.
+//
+// The refresh token is rotated, the one sent can not be used again and replaying it revokes its session.
+// Tokens of revoked sessions and of suspended, disabled or deleted users are refused without rotation.
+func NewRefreshTokenNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	db *sql.DB,
+	key string,
+	hours int,
+	options Options,
+) chan nanos.Message {
+
+	worker := &refreshTokenWorker{
+		db:           db,
+		key:          key,
+		hours:        hours,
+		auditSink:    options.AuditSink,
+		accessTokens: options.AccessTokens,
+		now:          time.Now,
+		delivery:     options.Delivery,
+	}
+
+	worker.prepareStore()
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+type refreshTokenWorker struct {
+	db           *sql.DB
+	key          string
+	hours        int
+	auditSink    audit.Sink
+	accessTokens signinUser.AccessTokenIssuer
+	now          func() time.Time
+	delivery     *messages.Delivery
+}
+
+func (w *refreshTokenWorker) Work(msg nanos.Message) {
+
+	// audit the refresh whatever its outcome
+	event := audit.Event{Action: audit.ActionRefresh, Outcome: audit.OutcomeFailure, Reason: "internal"}
+	defer func() { audit.Record(w.auditSink, event) }()
+
+	// skip requests the caller already gave up on
+	ctx := messages.Context(msg)
+	if err := ctx.Err(); err != nil {
+		event.Reason = "cancelled"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// extract content from msg, unversioned contents have the same shape as the payload
+	var content Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &content)
+	}
+	if err == nil && content.RefreshToken == "" {
+		err = entities.ValidationError("refresh_token", "refresh_token is required")
+	}
+	if err != nil {
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	// rotate the refresh token of its session once its owner is known to be allowed to signin,
+	// the roles may have changed since
+	var roles []string
+	session, refreshToken, err := datastores.RotateSession(ctx, w.db, content.RefreshToken, w.now(), func(userID int64) error {
+		event.Subject = strconv.FormatInt(userID, 10)
+		event.Actor = event.Subject
+		var err error
+		roles, err = w.activeUserRoles(ctx, userID)
+		if err != nil {
+			event.Reason = "inactive_user"
+		}
+		return err
+	})
+	if err == entities.ErrSessionRevoked {
+		event.Reason = "invalid_refresh_token"
+		w.delivery.Fail(msg, errInvalidRefreshToken)
+		return
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	event.Details = map[string]string{"session_id": session.ID}
+
+	// return new tokens
+	token, err := signinUser.IssueAccessToken(ctx, w.accessTokens, w.key, w.hours, int(session.UserID), roles, session.ID)
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	tokens := signinUser.Tokens{AccessToken: token, RefreshToken: refreshToken, SessionID: session.ID}
+	rawTokens, err := json.Marshal(tokens)
+	if err == nil {
+		rawTokens, err = messages.Reply(versioned, rawTokens, Response{Tokens: tokens})
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	event.Outcome = audit.OutcomeSuccess
+	event.Reason = ""
+	w.delivery.Reply(msg, rawTokens)
+
+}
+
+// activeUserRoles returns the roles of the user, or why it can not get tokens
+func (w *refreshTokenWorker) activeUserRoles(ctx context.Context, id int64) ([]string, error) {
+	var rawRoles string
+	var status string
+	var suspendedUntil int64
+	err := w.db.QueryRowContext(ctx, "SELECT roles, status, suspended_until FROM users WHERE id = ? AND deleted_at = 0", id).Scan(&rawRoles, &status, &suspendedUntil)
+	if err == sql.ErrNoRows {
+		return nil, errInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = entities.StatusError(status, time.Unix(suspendedUntil, 0), w.now())
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []string
+	if rawRoles != "" {
+		err = json.Unmarshal([]byte(rawRoles), &roles)
+	}
+	return roles, err
+}
+
+func (w *refreshTokenWorker) prepareStore() {
+	datastores.PrepareUsersTable(w.db)
+	datastores.PrepareSessionsTable(w.db)
+}
+
+// errInvalidRefreshToken does not tell whether the token is unknown, already used or revoked
+var errInvalidRefreshToken = entities.NewError(entities.CodeTokenInvalid, "refresh token is not valid")
@@ -0,0 +1,215 @@
+package refreshToken
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/signinUser"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"github.com/dgrijalva/jwt-go"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestRefreshToken(t *testing.T) {
+	t.Run("Given a refresh token When refresh Then new tokens of the same session are returned and the old one is spent", testRotation)
+	t.Run("Given a refresh token already rotated When it is replayed Then its session is revoked", testReplay)
+	t.Run("Given concurrent refreshes with the same token When refresh Then only one gets new tokens", testConcurrentRefresh)
+	t.Run("Given revoked sessions, inactive users and bad requests When refresh Then coded errors are returned", testRefused)
+	t.Run("Given a versioned request When refresh Then a versioned response is returned", testVersioned)
+}
+
+func prepareDB() *sql.DB {
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareUsersTable(db)
+	datastores.PrepareSessionsTable(db)
+	_, err := db.Exec(`insert into users (name, username, password, email, phone, roles, status, suspended_until) values
+			('Bashar', 'bashar_123', '', '', '', '["admin"]', 'active', 0),
+			('Roba', 'roba_123', '', '', '', '', 'suspended', ?)`, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+func refresh(mailBox chan nanos.Message, content string) (signinUser.Tokens, error) {
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	mailBox <- nanos.Message{Content: []byte(content), ResTo: resTo, ErrTo: errTo}
+
+	select {
+	case res := <-resTo:
+		var tokens signinUser.Tokens
+		err := json.Unmarshal(res.Content, &tokens)
+		return tokens, err
+	case err := <-errTo:
+		return signinUser.Tokens{}, err
+	case <-time.After(time.Second * 2):
+		return signinUser.Tokens{}, errors.New("timeout")
+	}
+}
+
+func testRotation(t *testing.T) {
+	db := prepareDB()
+	session, refreshToken, err := datastores.CreateSession(context.Background(), db, 1, "Firefox", "10.0.0.1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailBox := NewRefreshTokenNanos(1, 10, db, "secretKey", 4, Options{})
+
+	tokens, err := refresh(mailBox, `{"refresh_token":"`+refreshToken+`"}`)
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	if tokens.SessionID != session.ID || tokens.RefreshToken == "" || tokens.RefreshToken == refreshToken {
+		t.Fatalf("\t%s\tthe session should be kept and its refresh token rotated -- %v", failure, tokens)
+	}
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokens.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte("secretKey"), nil
+	})
+	if err != nil || claims["id"] != float64(1) || claims["sid"] != session.ID || claims["roles"].([]interface{})[0] != "admin" {
+		t.Fatalf("\t%s\tthe access token should carry the user, roles and session -- %v %v", failure, claims, err)
+	}
+
+	rotated, err := refresh(mailBox, `{"refresh_token":"`+tokens.RefreshToken+`"}`)
+	if err != nil || rotated.SessionID != session.ID {
+		t.Fatalf("\t%s\tthe new refresh token should be accepted -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testReplay(t *testing.T) {
+	db := prepareDB()
+	session, refreshToken, err := datastores.CreateSession(context.Background(), db, 1, "Firefox", "10.0.0.1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailBox := NewRefreshTokenNanos(1, 10, db, "secretKey", 4, Options{})
+
+	tokens, err := refresh(mailBox, `{"refresh_token":"`+refreshToken+`"}`)
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// the old token is replayed long after its rotation, by the thief or by the victim
+	_, err = refresh(mailBox, `{"refresh_token":"`+refreshToken+`"}`)
+	if entities.ToError(err).Code != entities.CodeTokenInvalid {
+		t.Fatalf("\t%s\ta spent refresh token should be refused -- %v", failure, err)
+	}
+	var revokedAt int64
+	_ = db.QueryRow("SELECT revoked_at FROM sessions WHERE id = ?", session.ID).Scan(&revokedAt)
+	if revokedAt == 0 {
+		t.Fatalf("\t%s\tthe session should be revoked on replay", failure)
+	}
+	_, err = refresh(mailBox, `{"refresh_token":"`+tokens.RefreshToken+`"}`)
+	if entities.ToError(err).Code != entities.CodeTokenInvalid {
+		t.Fatalf("\t%s\tthe current refresh token of a revoked session should be refused -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testConcurrentRefresh(t *testing.T) {
+	db := prepareDB()
+	_, refreshToken, err := datastores.CreateSession(context.Background(), db, 1, "Firefox", "10.0.0.1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailBox := NewRefreshTokenNanos(8, 10, db, "secretKey", 4, Options{})
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := refresh(mailBox, `{"refresh_token":"`+refreshToken+`"}`)
+			errs <- err
+		}()
+	}
+	refreshed := 0
+	for i := 0; i < cap(errs); i++ {
+		err := <-errs
+		if err == nil {
+			refreshed++
+			continue
+		}
+		if entities.ToError(err).Code != entities.CodeTokenInvalid {
+			t.Fatalf("\t%s\treplayed refresh tokens should be refused -- %v", failure, err)
+		}
+	}
+	if refreshed != 1 {
+		t.Fatalf("\t%s\tonly one refresh should get new tokens -- %v", failure, refreshed)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testRefused(t *testing.T) {
+	db := prepareDB()
+	revoked, revokedToken, _ := datastores.CreateSession(context.Background(), db, 1, "Firefox", "10.0.0.1", time.Now())
+	_ = datastores.RevokeSession(db, revoked.ID, 1, time.Now())
+	_, suspendedToken, _ := datastores.CreateSession(context.Background(), db, 2, "Firefox", "10.0.0.1", time.Now())
+	mailBox := NewRefreshTokenNanos(1, 10, db, "secretKey", 4, Options{})
+
+	data := []struct {
+		content string
+		code    string
+	}{
+		{content: `{"refresh_token":"` + revokedToken + `"}`, code: entities.CodeTokenInvalid},
+		{content: `{"refresh_token":"unknown"}`, code: entities.CodeTokenInvalid},
+		{content: `{"refresh_token":"` + suspendedToken + `"}`, code: entities.CodeAccountSuspended},
+		{content: `{}`, code: entities.CodeValidationFailed},
+		{content: `refresh`, code: entities.CodeBadRequest},
+	}
+
+	for i := range data {
+		_, err := refresh(mailBox, data[i].content)
+		if entities.ToError(err).Code != data[i].code {
+			t.Fatalf("\t%s\tdata[%v] error code should be %s -- %v", failure, i, data[i].code, err)
+		}
+	}
+
+	// the refresh token of the suspended user is refused before it is rotated
+	var hash string
+	_ = db.QueryRow("SELECT refresh_token_hash FROM sessions WHERE user_id = 2").Scan(&hash)
+	if hash != datastores.HashToken(suspendedToken) {
+		t.Fatalf("\t%s\tthe refresh token of an inactive user should not be rotated", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testVersioned(t *testing.T) {
+	db := prepareDB()
+	session, refreshToken, _ := datastores.CreateSession(context.Background(), db, 1, "Firefox", "10.0.0.1", time.Now())
+	mailBox := NewRefreshTokenNanos(1, 10, db, "secretKey", 4, Options{})
+
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	msg, _ := NewMessage(Request{RefreshToken: refreshToken}, resTo, errTo)
+	mailBox <- msg
+
+	select {
+	case res := <-resTo:
+		response, err := DecodeResponse(res)
+		if err != nil || response.SessionID != session.ID || response.AccessToken == "" {
+			t.Fatalf("\t%s\tthe versioned response is not correct -- %v %v", failure, response, err)
+		}
+	case err := <-errTo:
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	case <-time.After(time.Second * 2):
+		t.Fatalf("\t%s\t Timeout", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
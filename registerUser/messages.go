@@ -0,0 +1,32 @@
+package registerUser
+
+import (
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the registerUser nanos
+type Request struct {
+	entities.User
+	// Source identifies the caller for rate limiting, requests without it are not limited
+	Source string `json:"source"`
+}
+
+// Response is the versioned response of the registerUser nanos.
+// ID is 0 in silent mode, whether the user was registered or a duplicate email was silenced.
+type Response struct {
+	ID int64 `json:"id,omitempty"`
+}
+
+// NewMessage wraps req into a message for the registerUser nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
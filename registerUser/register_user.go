@@ -1,18 +1,34 @@
 package registerUser
 
 import (
+	"context"
 	"database/sql"
 	"encoding/binary"
 	"encoding/json"
-	"errors"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
 	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/rateLimiter"
 	"github.com/bashar-saleh/gonanos/nanos"
-	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/bcrypt"
-	"log"
+	"strconv"
 	"time"
 )
 
+// Options are the optional policies of the registerUser nanos, the zero value enables none of them
+type Options struct {
+	// RateLimiter is the channel of a rateLimiter nanos throttling each source
+	RateLimiter chan nanos.Message
+	// DuplicateEmailNotifier turns on silent mode: registrations reply id 0 and a used email
+	// is notified to its owner instead of being reported to the caller
+	DuplicateEmailNotifier entities.Notifier
+	// AuditSink records the audit events, nil records none
+	AuditSink audit.Sink
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
 func NewRegisterUserNanos(
 	workersMaxCount int,
 	taskQueueCapacity int,
@@ -22,7 +38,7 @@ func NewRegisterUserNanos(
 	passwordValidationRules []func(password string) (bool, string),
 	emailValidationRules []func(email string) (bool, string),
 	phoneValidationRules []func(phone string) (bool, string),
-
+	options Options,
 ) chan nanos.Message {
 
 	worker := &registerUserWorker{
@@ -32,6 +48,10 @@ func NewRegisterUserNanos(
 		passwordValidationRules: passwordValidationRules,
 		phoneValidationRules:    phoneValidationRules,
 		usernameValidationRules: usernameValidationRules,
+		rateLimiter:             options.RateLimiter,
+		duplicateEmailNotifier:  options.DuplicateEmailNotifier,
+		auditSink:               options.AuditSink,
+		delivery:                options.Delivery,
 	}
 
 	worker.prepareStore()
@@ -53,79 +73,122 @@ type registerUserWorker struct {
 	passwordValidationRules []func(password string) (bool, string)
 	emailValidationRules    []func(email string) (bool, string)
 	phoneValidationRules    []func(phone string) (bool, string)
+	rateLimiter             chan nanos.Message
+	// when set, registering a used email notifies its owner instead of replying with a conflict, and
+	// no reply carries the id so a used email can not be told from a new registration
+	duplicateEmailNotifier entities.Notifier
+	auditSink              audit.Sink
+	delivery               *messages.Delivery
 }
 
 func (w *registerUserWorker) Work(msg nanos.Message) {
 
-	// extract content from message
-	userData, err := entities.UserFromBytes(msg.Content)
+	// audit the attempt whatever its outcome
+	event := audit.Event{Action: audit.ActionRegister, Outcome: audit.OutcomeFailure, Reason: "internal"}
+	defer func() { audit.Record(w.auditSink, event) }()
+
+	// skip requests the caller already gave up on
+	ctx := messages.Context(msg)
+	if err := ctx.Err(); err != nil {
+		event.Reason = "cancelled"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// extract content from message, unversioned contents have the same shape as the payload
+	var content Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &content)
+	}
 	if err != nil {
-		select {
-		case msg.ErrTo <- err:
-			return
-		default:
-			return
-		}
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
 	}
 
+	userData := content.User
+	event.Subject = userData.Username
+	event.Source = content.Source
+
 	// validate user data
-	isValid, nonValidMsg := w.validate(userData)
-	if !isValid {
-		select {
-		case msg.ErrTo <- errors.New(nonValidMsg):
-			return
-		default:
+	err = w.validate(userData)
+	if err != nil {
+		event.Reason = "validation_failed"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// throttle the source before touching the db, requests without one would all share a single bucket
+	if content.Source != "" {
+		err = rateLimiter.Check(ctx, w.rateLimiter, "register:"+content.Source)
+		if err != nil {
+			event.Reason = "rate_limited"
+			w.delivery.Fail(msg, entities.ToError(err))
 			return
 		}
 	}
 
-
-
 	// check if the username or email or phone exist before
-	err = w.isUserExist(userData)
-	if err != nil {
-		select {
-		case msg.ErrTo <- err:
-			return
-		default:
+	err = w.isUserExist(ctx, userData)
+	if conflict, ok := err.(*entities.ConflictError); ok && w.duplicateEmailNotifier != nil {
+		var silenced bool
+		silenced, err = w.silenceEmailConflict(ctx, userData, conflict)
+		if silenced {
+			event.Reason = "silenced_duplicate_email"
+			w.replyID(msg, versioned, 0)
 			return
 		}
 	}
+	if _, ok := err.(*entities.ConflictError); ok {
+		event.Reason = "already_exists"
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
 
+	// do not spend the hashing time on a caller that gave up
+	if err = ctx.Err(); err != nil {
+		event.Reason = "cancelled"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
 
 	// saving to db
-	id, err := w.saveUserToDB(userData)
+	id, err := w.saveUserToDB(ctx, userData)
 	if err != nil {
-		select {
-		case msg.ErrTo <- err:
-			return
-		default:
-			return
-		}
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
 	}
 
 	// return response
+	event.Subject = strconv.FormatInt(id, 10)
+	event.Actor = event.Subject
+	event.Outcome = audit.OutcomeSuccess
+	event.Reason = ""
+
+	if w.duplicateEmailNotifier != nil {
+		id = 0
+	}
+	w.replyID(msg, versioned, id)
+
+}
+
+// replyID replies with id, the raw id is 8 little endian bytes
+func (w *registerUserWorker) replyID(msg nanos.Message, versioned bool, id int64) {
 	rawID := make([]byte, 8)
 	binary.LittleEndian.PutUint64(rawID, uint64(id))
-
+	reply, err := messages.Reply(versioned, rawID, Response{ID: id})
 	if err != nil {
-		select {
-		case msg.ErrTo <- err:
-		default:
-			return
-		}
-	}
-	select {
-	case msg.ResTo <- nanos.Message{Content: rawID}:
-		return
-	default:
+		w.delivery.Fail(msg, entities.ToError(err))
 		return
 	}
-
+	w.delivery.Reply(msg, reply)
 }
 
 func (w *registerUserWorker) hashPassword(pass string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.MinCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), entities.PasswordHashCost)
 	if err != nil {
 		return "", err
 	}
@@ -133,129 +196,95 @@ func (w *registerUserWorker) hashPassword(pass string) (string, error) {
 }
 
 func (w *registerUserWorker) prepareStore() {
-
-	// check if table exists
-	rows, err := w.db.Query("select name from sqlite_master where name='users' and type='table'")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer rows.Close()
-	if rows.Next() {
-		return
-	}
-
-	// create users table
-	stmt := `
-			create table  users (
-			    	id integer not null primary key autoincrement, 
-			    	name text,
-			    	username text,
-			    	password text,
-			    	email text,
-			    	phone text,
-			    	roles text
-			                    );
-			delete from users;`
-	_, err = w.db.Exec(stmt)
-	if err != nil {
-		log.Fatal(err)
-	}
-
+	datastores.PrepareUsersTable(w.db)
 }
 
-func (w *registerUserWorker) validate(userData entities.User) (bool, string) {
+func (w *registerUserWorker) validate(userData entities.User) error {
 
 	// validate name
-	for i := range w.nameValidationRules {
-		isValid, nonValidMsg := w.nameValidationRules[i](userData.Name)
-		if !isValid {
-			return false, nonValidMsg
-		}
+	err := entities.ValidateField("name", userData.Name, w.nameValidationRules)
+	if err != nil {
+		return err
 	}
 
 	// validate username
-	for i := range w.usernameValidationRules {
-		isValid, nonValidMsg := w.usernameValidationRules[i](userData.Username)
-		if !isValid {
-			return false, nonValidMsg
-		}
+	err = entities.ValidateField("username", userData.Username, w.usernameValidationRules)
+	if err != nil {
+		return err
 	}
 
 	// validate password
-	for i := range w.passwordValidationRules {
-		isValid, nonValidMsg := w.passwordValidationRules[i](userData.Password)
-		if !isValid {
-			return false, nonValidMsg
-		}
+	err = entities.ValidateField("password", userData.Password, w.passwordValidationRules)
+	if err != nil {
+		return err
 	}
 
 	// validate email
-	for i := range w.emailValidationRules {
-		isValid, nonValidMsg := w.emailValidationRules[i](userData.Email)
-		if !isValid {
-			return false, nonValidMsg
-		}
+	err = entities.ValidateField("email", userData.Email, w.emailValidationRules)
+	if err != nil {
+		return err
 	}
 
 	// validate phone
-	for i := range w.phoneValidationRules {
-		isValid, nonValidMsg := w.phoneValidationRules[i](userData.Phone)
-		if !isValid {
-			return false, nonValidMsg
-		}
+	err = entities.ValidateField("phone", userData.Phone, w.phoneValidationRules)
+	if err != nil {
+		return err
 	}
 
-	return true, ""
+	return nil
 }
 
-func (w *registerUserWorker) isUserExist(userData entities.User) error {
-	q := "SELECT username, email, phone FROM users WHERE "
-	var qValus []interface{}
+// isUserExist returns a *entities.ConflictError naming the submitted fields that are used before
+func (w *registerUserWorker) isUserExist(ctx context.Context, userData entities.User) error {
+	return datastores.UserConflictsContext(ctx, w.db, userData, 0)
+}
 
-	if userData.Username != "" {
-		q += "(username = ?) "
-		qValus = append(qValus, userData.Username)
-	} else {
-		q += "(0 = 1) "
-	}
-	if userData.Email != "" {
-		q += "OR (email = ?) "
-		qValus = append(qValus, userData.Email)
-	} else {
-		q += "OR (1 = 0) "
+// silenceEmailConflict handles a conflict in silent mode. When the email is the only conflicting field
+// the owner of the email is notified and true is returned so the caller replies as if the user was registered.
+// Otherwise the conflict is returned without the email field.
+func (w *registerUserWorker) silenceEmailConflict(ctx context.Context, userData entities.User, conflict *entities.ConflictError) (bool, error) {
+	var fields []string
+	for _, field := range conflict.Fields {
+		if field != "email" {
+			fields = append(fields, field)
+		}
 	}
-	if userData.Phone != "" {
-		q += "OR (phone = ?) "
-		qValus = append(qValus, userData.Phone)
-	} else {
-		q += "OR (1 = 0) "
+	if len(fields) > 0 {
+		return false, &entities.ConflictError{Fields: fields}
 	}
 
-	rows, err := w.db.Query(q, qValus...)
+	// spend the hashing time a real registration would spend
+	_, err := w.hashPassword(userData.Password)
 	if err != nil {
-		return err
+		return false, err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var username string
-		var email string
-		var phone string
-		err := rows.Scan(&username, &email, &phone)
-		if err != nil {
-			return err
-		}
-
-		return errors.New("User with data: username=" + username + " email=" + email + " phone=" + phone + " is exist before")
 
+	var ownerID int64
+	var ownerPhone string
+	err = w.db.QueryRowContext(ctx, "SELECT id, phone FROM users WHERE email = ? AND deleted_at = 0", userData.Email).Scan(&ownerID, &ownerPhone)
+	if err == sql.ErrNoRows {
+		// the owner deleted the account and the email is still in its grace period
+		return true, nil
 	}
-	return nil
+	if err != nil {
+		return false, err
+	}
+	err = w.duplicateEmailNotifier.Notify(entities.Notice{
+		Kind:   entities.NoticeRegistrationAttempt,
+		UserID: ownerID,
+		Email:  userData.Email,
+		Phone:  ownerPhone,
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-func (w *registerUserWorker) saveUserToDB(userData entities.User) (int64, error) {
-	tx, err := w.db.Begin()
+func (w *registerUserWorker) saveUserToDB(ctx context.Context, userData entities.User) (int64, error) {
+	tx, err := w.db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
 
 	// stringify roles
@@ -270,7 +299,7 @@ func (w *registerUserWorker) saveUserToDB(userData entities.User) (int64, error)
 		rolesString = string(raw)
 	}
 
-	stmt, err := tx.Prepare("insert into users (name, username, email, phone,password, roles) values (?, ?, ?, ?, ?, ?)")
+	stmt, err := tx.PrepareContext(ctx, "insert into users (name, username, email, phone,password, roles, created_at) values (?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return 0, err
 	}
@@ -279,7 +308,7 @@ func (w *registerUserWorker) saveUserToDB(userData entities.User) (int64, error)
 	// hashing password
 	hashedPassword, err := w.hashPassword(userData.Password)
 
-	result, err := stmt.Exec(userData.Name, userData.Username, userData.Email, userData.Phone, hashedPassword, rolesString)
+	result, err := stmt.ExecContext(ctx, userData.Name, userData.Username, userData.Email, userData.Phone, hashedPassword, rolesString, time.Now().Unix())
 	if err != nil {
 		return 0, err
 	}
@@ -295,5 +324,3 @@ func (w *registerUserWorker) saveUserToDB(userData entities.User) (int64, error)
 
 	return id, nil
 }
-
-
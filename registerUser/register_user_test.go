@@ -1,12 +1,19 @@
 package registerUser
 
 import (
-
+	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"github.com/bashar-saleh/auth-nanos/datastores"
 	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/rateLimiter"
 	"github.com/bashar-saleh/gonanos/nanos"
+	"os"
+	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 )
@@ -14,12 +21,160 @@ import (
 var failure = "\u2717"
 var succeed = "\u2713"
 
-
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
 
 func TestRegisterUser(t *testing.T) {
 	t.Run("testValidationRules", testValidationRules)
 	t.Run("When register an existed user Then error must be return And contains msg of //exist before//", registerExistedUser)
 	t.Run("When register a new user Then the id should be return", registerNewUser)
+	t.Run("Given a source over its rate limit When register Then LimitedError is returned", registerRateLimited)
+	t.Run("Given an existing user When register with some of its data Then ConflictError names only the submitted fields", registerConflictFields)
+	t.Run("Given silent mode When register an existing email Then the owner is notified and no conflict is revealed", registerSilentDuplicateEmail)
+	t.Run("Given a versioned request When register Then a versioned response is returned", registerVersioned)
+	t.Run("Given a cancelled context When register Then no user is saved", registerCancelled)
+}
+
+type fakeNotifier struct {
+	notices []entities.Notice
+}
+
+func (n *fakeNotifier) Notify(notice entities.Notice) error {
+	n.notices = append(n.notices, notice)
+	return nil
+}
+
+func register(mailBox chan nanos.Message, user entities.User) (int64, error) {
+	rawUser, _ := user.ToByte()
+	var resTo = make(chan nanos.Message, 1)
+	var errTo = make(chan error, 1)
+	mailBox <- nanos.Message{Content: rawUser, ResTo: resTo, ErrTo: errTo}
+
+	select {
+	case res := <-resTo:
+		return int64(binary.LittleEndian.Uint64(res.Content)), nil
+	case err := <-errTo:
+		return 0, err
+	case <-time.After(time.Second * 2):
+		return 0, errors.New("timeout")
+	}
+}
+
+func registerConflictFields(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	mailBox := NewRegisterUserNanos(1, 2000, db, nil, nil, nil, nil, nil, Options{})
+	_, err := register(mailBox, entities.User{Username: "Roba", Email: "roba@example.com", Phone: "+963991347770", Password: "123123"})
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+
+	data := []struct {
+		user   entities.User
+		fields []string
+	}{
+		{user: entities.User{Username: "other", Email: "roba@example.com", Password: "123123"}, fields: []string{"email"}},
+		{user: entities.User{Username: "Roba", Phone: "+1", Password: "123123"}, fields: []string{"username"}},
+		{user: entities.User{Username: "Roba", Email: "other@example.com", Phone: "+963991347770", Password: "123123"}, fields: []string{"username", "phone"}},
+	}
+
+	for i := range data {
+		_, err := register(mailBox, data[i].user)
+		conflict, ok := entities.ToError(err).Err.(*entities.ConflictError)
+		if !ok {
+			t.Fatalf("\t%s\tdata[%v] Nanos should return *entities.ConflictError -- %v", failure, i, err)
+		}
+		coded, ok := err.(*entities.Error)
+		if !ok || coded.Code != entities.CodeAlreadyExists || coded.Field != strings.Join(data[i].fields, ",") {
+			t.Fatalf("\t%s\tdata[%v] Nanos should return already_exists naming the fields -- %#v", failure, i, err)
+		}
+		if !reflect.DeepEqual(conflict.Fields, data[i].fields) {
+			t.Fatalf("\t%s\tdata[%v] conflicting fields should be %v -- %v", failure, i, data[i].fields, conflict.Fields)
+		}
+		for _, leaked := range []string{"roba@example.com", "+963991347770"} {
+			if strings.Contains(err.Error(), leaked) {
+				t.Fatalf("\t%s\tdata[%v] error leaks existing user data -- %s", failure, i, err.Error())
+			}
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func registerSilentDuplicateEmail(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	notifier := &fakeNotifier{}
+	mailBox := NewRegisterUserNanos(1, 2000, db, nil, nil, nil, nil, nil, Options{DuplicateEmailNotifier: notifier})
+	registeredID, err := register(mailBox, entities.User{Username: "Roba", Email: "roba@example.com", Password: "123123"})
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	if registeredID != 0 {
+		t.Fatalf("\t%s\tsilent mode should not reply with the id of a new user -- %v", failure, registeredID)
+	}
+	var ownerID int64
+	_ = db.QueryRow("SELECT id FROM users WHERE email = ?", "roba@example.com").Scan(&ownerID)
+
+	id, err := register(mailBox, entities.User{Username: "other", Email: "roba@example.com", Password: "123123"})
+	if err != nil {
+		t.Fatalf("\t%s\tduplicate email should not be revealed -- %v", failure, err)
+	}
+	if id != 0 {
+		t.Fatalf("\t%s\tsilenced registration should reply like a new registration -- %v", failure, id)
+	}
+	if len(notifier.notices) != 1 || notifier.notices[0].UserID != ownerID || notifier.notices[0].Kind != entities.NoticeRegistrationAttempt {
+		t.Fatalf("\t%s\tthe owner should be notified once -- %v", failure, notifier.notices)
+	}
+
+	// other conflicting fields are still reported, without the email
+	_, err = register(mailBox, entities.User{Username: "Roba", Email: "roba@example.com", Password: "123123"})
+	conflict, ok := entities.ToError(err).Err.(*entities.ConflictError)
+	if !ok || !reflect.DeepEqual(conflict.Fields, []string{"username"}) {
+		t.Fatalf("\t%s\tNanos should return username conflict only -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func registerRateLimited(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	bucket, _ := rateLimiter.NewTokenBucket(1, time.Minute)
+	limiter := rateLimiter.NewRateLimiterNanos(1, 10, bucket, rateLimiter.Options{})
+	mailBox := NewRegisterUserNanos(1, 2000, db, nil, nil, nil, nil, nil, Options{RateLimiter: limiter})
+
+	data := []struct {
+		username string
+		source   string
+		limited  bool
+	}{
+		{username: "first", source: "10.0.0.1", limited: false},
+		{username: "second", source: "10.0.0.1", limited: true},
+		{username: "third", source: "10.0.0.2", limited: false},
+		{username: "fourth", limited: false},
+		{username: "fifth", limited: false},
+	}
+
+	for i := range data {
+		rawContent, _ := json.Marshal(map[string]string{"username": data[i].username, "password": "123123", "source": data[i].source})
+		var resTo = make(chan nanos.Message, 1)
+		var errTo = make(chan error, 1)
+		mailBox <- nanos.Message{Content: rawContent, ResTo: resTo, ErrTo: errTo}
+
+		select {
+		case <-resTo:
+			if data[i].limited {
+				t.Fatalf("\t%s\tdata[%v] should be limited", failure, i)
+			}
+		case err := <-errTo:
+			_, ok := entities.ToError(err).Err.(*rateLimiter.LimitedError)
+			if !ok || entities.ToError(err).Code != entities.CodeRateLimited || !data[i].limited {
+				t.Fatalf("\t%s\tdata[%v] unexpected error -- %v", failure, i, err)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("\t%s\t [Timeout] - data[%v] ", failure, i)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
 }
 
 func testValidationRules(t *testing.T) {
@@ -294,16 +449,7 @@ func testValidationRules(t *testing.T) {
 		{
 			db := datastores.SqliteConnection("test.db")
 
-			mailBox := NewRegisterUserNanos(
-				1,
-				1000,
-				db,
-				data[i].nameValidationRules,
-				data[i].usernameValidationRules,
-				data[i].passwordValidationRules,
-				data[i].emailValidationRules,
-				data[i].phoneValidationRules,
-			)
+			mailBox := NewRegisterUserNanos(1, 1000, db, data[i].nameValidationRules, data[i].usernameValidationRules, data[i].passwordValidationRules, data[i].emailValidationRules, data[i].phoneValidationRules, Options{})
 
 			var resTo = make(chan nanos.Message)
 			var errTo = make(chan error)
@@ -343,7 +489,7 @@ func testValidationRules(t *testing.T) {
 
 func registerNewUser(t *testing.T) {
 	db := datastores.SqliteConnection("test.db")
-	mailBox := NewRegisterUserNanos(1, 2000, db, nil, nil, nil, nil, nil)
+	mailBox := NewRegisterUserNanos(1, 2000, db, nil, nil, nil, nil, nil, Options{})
 	user := entities.User{
 		Name:     "Bashar Saleh",
 		Username: "Roba",
@@ -373,7 +519,7 @@ func registerNewUser(t *testing.T) {
 
 func registerExistedUser(t *testing.T) {
 	db := datastores.SqliteConnection("test.db")
-	mailBox := NewRegisterUserNanos(1, 2000, db, nil, nil, nil, nil, nil)
+	mailBox := NewRegisterUserNanos(1, 2000, db, nil, nil, nil, nil, nil, Options{})
 	user := entities.User{
 		Name:     "Bashar Saleh",
 		Username: "Roba",
@@ -411,3 +557,57 @@ func registerExistedUser(t *testing.T) {
 	}
 
 }
+
+func registerVersioned(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	mailBox := NewRegisterUserNanos(1, 2000, db, nil, nil, nil, nil, nil, Options{})
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	msg, err := NewMessage(Request{User: entities.User{Username: "Roba", Password: "123123"}, Source: "10.0.0.1"}, resTo, errTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailBox <- msg
+
+	select {
+	case err := <-errTo:
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	case res := <-resTo:
+		response, err := DecodeResponse(res)
+		if err != nil || response.ID != 1 {
+			t.Fatalf("\t%s\tthe response is not correct -- %s %v", failure, res.Content, err)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("\t%s\t Timeout", failure)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func registerCancelled(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	mailBox := NewRegisterUserNanos(1, 2000, db, nil, nil, nil, nil, nil, Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	msg, _ := NewMessage(Request{User: entities.User{Username: "Roba", Password: "123123"}}, resTo, errTo)
+	mailBox <- messages.WithContext(ctx, msg)
+
+	select {
+	case <-resTo:
+		t.Fatalf("\t%s\ta cancelled registration should not reply with an id", failure)
+	case err := <-errTo:
+		if entities.ToError(err).Code != entities.CodeCancelled {
+			t.Fatalf("\t%s\terror code should be cancelled -- %v", failure, err)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatalf("\t%s\t Timeout", failure)
+	}
+	var count int
+	_ = db.QueryRow("select count(*) from users").Scan(&count)
+	if count != 0 {
+		t.Fatalf("\t%s\tno user should be saved -- %v", failure, count)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,28 @@
+package revokeSession
+
+import (
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the revokeSession nanos
+type Request struct {
+	// ID is the id of the validated claims
+	ID        int64  `json:"id"`
+	SessionID string `json:"session_id"`
+}
+
+// Response is the versioned response of the revokeSession nanos
+type Response struct{}
+
+// NewMessage wraps req into a message for the revokeSession nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
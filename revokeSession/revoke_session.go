@@ -0,0 +1,113 @@
+package revokeSession
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"strconv"
+	"time"
+)
+
+// Options are the optional policies of the revokeSession nanos
+type Options struct {
+	// AuditSink records the audit events, nil records none
+	AuditSink audit.Sink
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+// NewRevokeSessionNanos returns the nanos that signs the user out of one of its sessions.
+// Its content is {"id": <user id from the validated claims>, "session_id": "..."}.
+//
+// The refresh token of a revoked session can not be used anymore, and its access tokens
+// are refused by validateJWT nanos that have a db.
+func NewRevokeSessionNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	db *sql.DB,
+	options Options,
+) chan nanos.Message {
+
+	worker := &revokeSessionWorker{
+		db:        db,
+		auditSink: options.AuditSink,
+		now:       time.Now,
+		delivery:  options.Delivery,
+	}
+
+	worker.prepareStore()
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+type revokeSessionWorker struct {
+	db        *sql.DB
+	auditSink audit.Sink
+	now       func() time.Time
+	delivery  *messages.Delivery
+}
+
+func (w *revokeSessionWorker) Work(msg nanos.Message) {
+
+	// audit the revocation whatever its outcome
+	event := audit.Event{Action: audit.ActionRevokeSession, Outcome: audit.OutcomeFailure, Reason: "internal"}
+	defer func() { audit.Record(w.auditSink, event) }()
+
+	// extract content from msg
+	var content Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &content)
+	}
+	if err == nil && content.ID == 0 {
+		err = errors.New("claims has no id")
+	}
+	if err == nil && content.SessionID == "" {
+		err = entities.ValidationError("session_id", "session_id is required")
+	}
+	if err != nil {
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	event.Actor = strconv.FormatInt(content.ID, 10)
+	event.Subject = event.Actor
+	event.Details = map[string]string{"session_id": content.SessionID}
+
+	// revoke the session, only its owner can revoke it
+	err = datastores.RevokeSession(w.db, content.SessionID, content.ID, w.now())
+	if err == entities.ErrSessionNotExist {
+		event.Reason = "not_found"
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// sending the response back
+	reply, err := messages.Reply(versioned, nil, Response{})
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	event.Outcome = audit.OutcomeSuccess
+	event.Reason = ""
+	w.delivery.Reply(msg, reply)
+
+}
+
+func (w *revokeSessionWorker) prepareStore() {
+	datastores.PrepareSessionsTable(w.db)
+}
@@ -0,0 +1,66 @@
+package revokeSession
+
+import (
+	"context"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestRevokeSession(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareSessionsTable(db)
+	session, _, err := datastores.CreateSession(context.Background(), db, 1, "Firefox", "10.0.0.1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailBox := NewRevokeSessionNanos(1, 10, db, Options{})
+
+	data := []struct {
+		content  string
+		expected string
+	}{
+		{content: `{"id":2,"session_id":"` + session.ID + `"}`, expected: "not exist"},
+		{content: `{"id":1,"session_id":"` + session.ID + `"}`, expected: ""},
+		{content: `{"id":1,"session_id":"` + session.ID + `"}`, expected: "not exist"},
+		{content: `{"id":1}`, expected: "session_id is required"},
+		{content: `{"session_id":"` + session.ID + `"}`, expected: "no id"},
+	}
+
+	for i := range data {
+		resTo := make(chan nanos.Message, 1)
+		errTo := make(chan error, 1)
+		mailBox <- nanos.Message{Content: []byte(data[i].content), ResTo: resTo, ErrTo: errTo}
+
+		select {
+		case <-resTo:
+			if data[i].expected != "" {
+				t.Fatalf("\t%s\tdata[%v] Nanos should not return response", failure, i)
+			}
+			sessions, _ := datastores.ListSessions(db, 1)
+			if len(sessions) != 0 {
+				t.Fatalf("\t%s\tdata[%v] the session should not be active -- %v", failure, i, sessions)
+			}
+		case err := <-errTo:
+			matched, _ := regexp.MatchString(data[i].expected, err.Error())
+			if data[i].expected == "" || !matched {
+				t.Fatalf("\t%s\tdata[%v] error should contain //%s// -- %v", failure, i, data[i].expected, err)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("\t%s\t Timeout", failure)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,87 @@
+package signinUser
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/paseto"
+	"golang.org/x/crypto/ed25519"
+	"time"
+)
+
+// AccessTokenIssuer issues the access tokens of signin and refresh instead of the JWTs signed with their key
+type AccessTokenIssuer interface {
+	IssueAccessToken(ctx context.Context, ID int, roles []string, sessionID string, expiresAt time.Time) (string, error)
+}
+
+// OpaqueTokens issues random reference tokens, their claims stay on the server and only the
+// hash of the token is stored. validateJWT resolves them when it is given the same db, so they
+// can be revoked at once with their session, and introspectToken tells resource servers about them.
+type OpaqueTokens struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewOpaqueTokens returns the opaque tokens stored in db
+func NewOpaqueTokens(db *sql.DB) *OpaqueTokens {
+	datastores.PrepareAccessTokensTable(db)
+	return &OpaqueTokens{db: db, now: time.Now}
+}
+
+// IssueAccessToken stores the claims of a new opaque token and returns it
+func (o *OpaqueTokens) IssueAccessToken(ctx context.Context, ID int, roles []string, sessionID string, expiresAt time.Time) (string, error) {
+	return datastores.CreateAccessToken(ctx, o.db, entities.AccessToken{
+		UserID:    int64(ID),
+		Roles:     roles,
+		SessionID: sessionID,
+		IssuedAt:  o.now(),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// IssueAccessToken returns the access token of issuer valid for hours, the JWT of NewAccessToken
+// signed with key when issuer is nil
+func IssueAccessToken(ctx context.Context, issuer AccessTokenIssuer, key string, hours int, ID int, roles []string, sessionID string) (string, error) {
+	if issuer == nil {
+		return NewAccessToken(key, hours, ID, roles, sessionID)
+	}
+	return issuer.IssueAccessToken(ctx, ID, roles, sessionID, time.Now().Add(time.Duration(hours)*time.Hour))
+}
+
+// PasetoTokens issues PASETO v4 tokens carrying the claims of the JWTs, see paseto.Claims.
+// v4 fixes the algorithms of a token, none can be swapped by the sender as the alg of a JWT.
+type PasetoTokens struct {
+	secretKey ed25519.PrivateKey
+	localKey  []byte
+	now       func() time.Time
+}
+
+// NewPasetoPublicTokens returns the tokens of v4.public, signed with secretKey and verified with its public key
+func NewPasetoPublicTokens(secretKey ed25519.PrivateKey) *PasetoTokens {
+	return &PasetoTokens{secretKey: secretKey, now: time.Now}
+}
+
+// NewPasetoLocalTokens returns the tokens of v4.local, encrypted with key so only its holders can read them
+func NewPasetoLocalTokens(key []byte) *PasetoTokens {
+	return &PasetoTokens{localKey: key, now: time.Now}
+}
+
+// IssueAccessToken signs or encrypts the claims of a new token
+func (p *PasetoTokens) IssueAccessToken(ctx context.Context, ID int, roles []string, sessionID string, expiresAt time.Time) (string, error) {
+	claims, err := json.Marshal(paseto.Claims{
+		ID:        ID,
+		Roles:     roles,
+		SessionID: sessionID,
+		IssuedAt:  p.now().UTC().Truncate(time.Second),
+		ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		return "", err
+	}
+	if p.secretKey != nil {
+		return paseto.Sign(p.secretKey, claims, nil, nil)
+	}
+	return paseto.Encrypt(p.localKey, claims, nil, nil)
+}
@@ -0,0 +1,276 @@
+package signinUser
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"log"
+	"math/big"
+	"time"
+)
+
+// NewDevicePolicy controls what happens when a user signs in from a device it never used before.
+//
+// Devices are recognized by a fingerprint of the DeviceID and UserAgent sent with the signin.
+// The first device of a user is trusted silently. Any other unknown device sends a
+// entities.NoticeNewDevice through Notifier, or when RequireStepUp is set, no tokens are issued
+// until the caller signs in again with the code sent as entities.NoticeStepUpCode.
+type NewDevicePolicy struct {
+	Notifier      entities.Notifier
+	RequireStepUp bool
+	// StepUpTTL is how long a step-up code stays valid
+	StepUpTTL time.Duration
+	// MaxStepUpAttempts is how many wrong codes a device may send before its challenge expires,
+	// asking for a new challenge does not reset them
+	MaxStepUpAttempts int
+}
+
+// StepUpRequiredError is returned instead of tokens when the signin must be confirmed with a code.
+// The caller signs in again with the same credentials plus StepUpChallenge and StepUpCode.
+type StepUpRequiredError struct {
+	Challenge string
+	ExpiresAt time.Time
+}
+
+func (e *StepUpRequiredError) Error() string {
+	return "new device, step-up verification is required"
+}
+
+func (e *StepUpRequiredError) ErrorCode() string {
+	return entities.CodeStepUpRequired
+}
+
+// ErrStepUpFailed is returned when the step-up challenge is unknown, expired or the code is wrong
+var ErrStepUpFailed error = entities.NewError(entities.CodeStepUpFailed, "step-up code is wrong or expired")
+
+// ErrStepUpLocked is returned instead of a new challenge when the device spent its attempts,
+// until its last challenge expires
+var ErrStepUpLocked error = entities.NewError(entities.CodeLocked, "too many wrong step-up codes, try again later")
+
+// device describes where a signin comes from
+type device struct {
+	ID        string
+	UserAgent string
+	IP        string
+}
+
+func (d device) fingerprint() string {
+	return datastores.HashToken(d.ID + "\n" + d.UserAgent)
+}
+
+func (w *signinUserWorker) prepareDevicesStore() {
+	if w.newDevicePolicy == nil {
+		return
+	}
+
+	stmt := `
+			create table if not exists known_devices (
+			    	user_id integer not null,
+			    	fingerprint text not null,
+			    	first_seen integer not null,
+			    	last_seen integer not null,
+			    	primary key (user_id, fingerprint)
+			                    );
+			create table if not exists step_up_challenges (
+			    	id text not null primary key,
+			    	user_id integer not null,
+			    	fingerprint text not null,
+			    	code_hash text not null,
+			    	expires_at integer not null,
+			    	attempts integer not null default 0
+			                    );`
+	_, err := w.db.Exec(stmt)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// checkDevice lets the signin continue when the device is known, trusted or confirmed by a step-up code.
+// It returns *StepUpRequiredError when a code was just sent, ErrStepUpFailed when the submitted code is not valid.
+func (w *signinUserWorker) checkDevice(ctx context.Context, userID int, email string, phone string, d device, challenge string, code string) error {
+	if w.newDevicePolicy == nil {
+		return nil
+	}
+	now := w.now()
+	fingerprint := d.fingerprint()
+
+	// known devices only refresh their last use
+	result, err := w.db.ExecContext(ctx, "update known_devices set last_seen = ? where user_id = ? and fingerprint = ?", now.Unix(), userID, fingerprint)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	// the first device of the user is trusted
+	var known int
+	err = w.db.QueryRowContext(ctx, "select count(*) from known_devices where user_id = ?", userID).Scan(&known)
+	if err != nil {
+		return err
+	}
+	if known == 0 {
+		return w.rememberDevice(ctx, userID, fingerprint, now)
+	}
+
+	if !w.newDevicePolicy.RequireStepUp {
+		err = w.notify(entities.Notice{
+			Kind:   entities.NoticeNewDevice,
+			UserID: int64(userID),
+			Email:  email,
+			Phone:  phone,
+			Data:   map[string]string{"user_agent": d.UserAgent, "ip": d.IP},
+		})
+		if err != nil {
+			return err
+		}
+		return w.rememberDevice(ctx, userID, fingerprint, now)
+	}
+
+	if challenge == "" {
+		return w.startStepUp(ctx, userID, email, phone, d, now)
+	}
+	err = w.verifyStepUp(ctx, userID, fingerprint, challenge, code, now)
+	if err != nil {
+		return err
+	}
+	return w.rememberDevice(ctx, userID, fingerprint, now)
+}
+
+func (w *signinUserWorker) rememberDevice(ctx context.Context, userID int, fingerprint string, now time.Time) error {
+	_, err := w.db.ExecContext(ctx, "insert into known_devices (user_id, fingerprint, first_seen, last_seen) values (?, ?, ?, ?) on conflict(user_id, fingerprint) do update set last_seen = excluded.last_seen",
+		userID, fingerprint, now.Unix(), now.Unix())
+	return err
+}
+
+// startStepUp stores a new challenge for the device in place of the previous one and sends its code
+// to the user. The new challenge keeps the attempts already spent, none is made once they are all spent.
+func (w *signinUserWorker) startStepUp(ctx context.Context, userID int, email string, phone string, d device, now time.Time) error {
+	challenge, err := datastores.RandomToken(16)
+	if err != nil {
+		return err
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	ttl := w.newDevicePolicy.StepUpTTL
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	expiresAt := now.Add(ttl)
+
+	// drop the challenges nobody came back for
+	_, err = w.db.ExecContext(ctx, "delete from step_up_challenges where expires_at <= ?", now.UnixNano())
+	if err != nil {
+		return err
+	}
+
+	// the attempts of the live challenges of the device carry over, the insert is skipped once they are spent
+	result, err := w.db.ExecContext(ctx, `insert into step_up_challenges (id, user_id, fingerprint, code_hash, expires_at, attempts)
+			select ?, ?, ?, ?, ?, spent from (select coalesce(max(attempts), 0) as spent from step_up_challenges where user_id = ? and fingerprint = ?)
+			where spent < ?`,
+		challenge, userID, d.fingerprint(), datastores.HashToken(code), expiresAt.UnixNano(), userID, d.fingerprint(), w.maxStepUpAttempts())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrStepUpLocked
+	}
+	_, err = w.db.ExecContext(ctx, "delete from step_up_challenges where user_id = ? and fingerprint = ? and id != ?", userID, d.fingerprint(), challenge)
+	if err != nil {
+		return err
+	}
+
+	err = w.notify(entities.Notice{
+		Kind:   entities.NoticeStepUpCode,
+		UserID: int64(userID),
+		Email:  email,
+		Phone:  phone,
+		Data:   map[string]string{"code": code, "user_agent": d.UserAgent, "ip": d.IP},
+	})
+	if err != nil {
+		return err
+	}
+	return &StepUpRequiredError{Challenge: challenge, ExpiresAt: expiresAt}
+}
+
+// verifyStepUp consumes the challenge when the code matches. Every guess takes one of its attempts
+// before the code is compared, so parallel guesses can not try more codes than MaxStepUpAttempts.
+// A challenge with its attempts spent is kept until it expires, it locks the device out of new ones.
+func (w *signinUserWorker) verifyStepUp(ctx context.Context, userID int, fingerprint string, challenge string, code string, now time.Time) error {
+	var codeHash string
+	var expiresAt int64
+	err := w.db.QueryRowContext(ctx, "select code_hash, expires_at from step_up_challenges where id = ? and user_id = ? and fingerprint = ?",
+		challenge, userID, fingerprint).Scan(&codeHash, &expiresAt)
+	if err == sql.ErrNoRows {
+		return ErrStepUpFailed
+	}
+	if err != nil {
+		return err
+	}
+	if !time.Unix(0, expiresAt).After(now) {
+		_, err = w.db.ExecContext(ctx, "delete from step_up_challenges where id = ?", challenge)
+		if err != nil {
+			return err
+		}
+		return ErrStepUpFailed
+	}
+
+	result, err := w.db.ExecContext(ctx, "update step_up_challenges set attempts = attempts + 1 where id = ? and attempts < ?", challenge, w.maxStepUpAttempts())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// the attempts are spent or the challenge was consumed meanwhile
+		return ErrStepUpFailed
+	}
+
+	if datastores.HashToken(code) != codeHash {
+		return ErrStepUpFailed
+	}
+
+	// only one of parallel right guesses consumes the challenge
+	result, err = w.db.ExecContext(ctx, "delete from step_up_challenges where id = ?", challenge)
+	if err != nil {
+		return err
+	}
+	affected, err = result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrStepUpFailed
+	}
+	return nil
+}
+
+func (w *signinUserWorker) maxStepUpAttempts() int {
+	if w.newDevicePolicy.MaxStepUpAttempts <= 0 {
+		return 5
+	}
+	return w.newDevicePolicy.MaxStepUpAttempts
+}
+
+func (w *signinUserWorker) notify(notice entities.Notice) error {
+	if w.newDevicePolicy.Notifier == nil {
+		return nil
+	}
+	return w.newDevicePolicy.Notifier.Notify(notice)
+}
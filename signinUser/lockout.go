@@ -0,0 +1,141 @@
+package signinUser
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"log"
+	"time"
+)
+
+// LockoutPolicy controls how many wrong passwords an account tolerates
+// before signin is refused for a while.
+//
+// After MaxAttempts consecutive failures the account is locked for
+// BaseLockout; every further lockout doubles the window up to MaxLockout.
+// The lock is lifted automatically once the window passes, and a successful
+// signin resets all counters.
+type LockoutPolicy struct {
+	MaxAttempts int
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+// window returns the lockout duration for the n-th lockout (starting at 1)
+func (p *LockoutPolicy) window(n int) time.Duration {
+	d := p.BaseLockout
+	for i := 1; i < n; i++ {
+		d *= 2
+		if p.MaxLockout > 0 && d >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+	if p.MaxLockout > 0 && d > p.MaxLockout {
+		return p.MaxLockout
+	}
+	return d
+}
+
+// LockedError is returned when signin is refused because the account is locked
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("account is locked until %s", e.Until.UTC().Format(time.RFC3339))
+}
+
+func (e *LockedError) ErrorCode() string {
+	return entities.CodeLocked
+}
+
+func (w *signinUserWorker) prepareStore() {
+	datastores.PrepareUsersTable(w.db)
+	datastores.PrepareSessionsTable(w.db)
+	w.prepareDevicesStore()
+
+	if w.lockoutPolicy == nil {
+		return
+	}
+
+	stmt := `
+			create table if not exists signin_attempts (
+			    	user_id integer not null primary key,
+			    	failed_count integer not null default 0,
+			    	lockout_count integer not null default 0,
+			    	locked_until integer not null default 0
+			                    );`
+	_, err := w.db.Exec(stmt)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// lockedUntil returns the time the account is locked until, zero time if it is not locked
+func (w *signinUserWorker) lockedUntil(ctx context.Context, userID int) (time.Time, error) {
+	if w.lockoutPolicy == nil {
+		return time.Time{}, nil
+	}
+
+	var lockedUntil int64
+	err := w.db.QueryRowContext(ctx, "SELECT locked_until FROM signin_attempts WHERE user_id = ?", userID).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	until := time.Unix(0, lockedUntil)
+	if !until.After(w.now()) {
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+// recordFailure counts a wrong password and locks the account when the policy threshold is reached
+func (w *signinUserWorker) recordFailure(ctx context.Context, userID int) error {
+	if w.lockoutPolicy == nil {
+		return nil
+	}
+
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var failedCount, lockoutCount int
+	err = tx.QueryRowContext(ctx, "SELECT failed_count, lockout_count FROM signin_attempts WHERE user_id = ?", userID).Scan(&failedCount, &lockoutCount)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	failedCount++
+	var lockedUntil int64
+	if failedCount >= w.lockoutPolicy.MaxAttempts {
+		lockoutCount++
+		failedCount = 0
+		lockedUntil = w.now().Add(w.lockoutPolicy.window(lockoutCount)).UnixNano()
+	}
+
+	_, err = tx.ExecContext(ctx, `insert into signin_attempts (user_id, failed_count, lockout_count, locked_until) values (?, ?, ?, ?)
+			on conflict(user_id) do update set failed_count = excluded.failed_count, lockout_count = excluded.lockout_count, locked_until = excluded.locked_until`,
+		userID, failedCount, lockoutCount, lockedUntil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// resetFailures clears the counters after a successful signin
+func (w *signinUserWorker) resetFailures(ctx context.Context, userID int) error {
+	if w.lockoutPolicy == nil {
+		return nil
+	}
+	_, err := w.db.ExecContext(ctx, "delete from signin_attempts where user_id = ?", userID)
+	return err
+}
@@ -0,0 +1,43 @@
+package signinUser
+
+import (
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the signinUser nanos
+type Request struct {
+	// FirstField is the username, email or phone of the user
+	FirstField string
+	Password   string
+	// Source identifies the caller (IP or client id) for rate limiting, requests without it are not limited
+	Source string
+	// UserAgent and IP describe the device, they are kept with the session
+	UserAgent string
+	IP        string
+	// DeviceID is an optional stable id of the client install, it sharpens device recognition
+	DeviceID string
+	// StepUpChallenge and StepUpCode confirm a signin from a new device, see NewDevicePolicy
+	StepUpChallenge string
+	StepUpCode      string
+	// Cookie asks for a browser session, the reply carries a session token for a cookie
+	// instead of the access and refresh tokens
+	Cookie bool
+}
+
+// Response is the versioned response of the signinUser nanos
+type Response struct {
+	Tokens
+}
+
+// NewMessage wraps req into a message for the signinUser nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
@@ -0,0 +1,60 @@
+//go:build timing
+// +build timing
+
+package signinUser
+
+import (
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"sort"
+	"testing"
+	"time"
+)
+
+// The timings depend on the machine load, run them on a quiet machine with
+//
+//	go test -tags timing ./signinUser
+
+func TestSigninTiming(t *testing.T) {
+	t.Run("Given existing and missing users When we signin with wrong passwords Then response times are indistinguishable", signinTimingIndistinguishable)
+}
+
+func signinTimingIndistinguishable(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+	})
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{})
+
+	measure := func(firstField string) time.Duration {
+		start := time.Now()
+		_, err := signin(mailBox, firstField, "wrong password")
+		if err == nil || err.Error() != "username or password is wrong" {
+			t.Fatalf("\t%s\tNanos should return //username or password is wrong// -- %v", failure, err)
+		}
+		return time.Since(start)
+	}
+
+	// interleave the samples so load changes hit both paths alike
+	const samples = 40
+	var existing, missing []time.Duration
+	for i := 0; i < samples; i++ {
+		existing = append(existing, measure("bashar_123"))
+		missing = append(missing, measure("nobody_123"))
+	}
+
+	existingMedian := median(existing)
+	missingMedian := median(missing)
+	ratio := float64(missingMedian) / float64(existingMedian)
+	t.Logf("\tmedian existing=%v missing=%v ratio=%.2f", existingMedian, missingMedian, ratio)
+	if ratio < 0.75 || ratio > 1.33 {
+		t.Fatalf("\t%s\tmissing user path is distinguishable from existing user path -- ratio %.2f", failure, ratio)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func median(durations []time.Duration) time.Duration {
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
@@ -1,15 +1,38 @@
 package signinUser
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"encoding/json"
-	"errors"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/rateLimiter"
 	"github.com/bashar-saleh/gonanos/nanos"
 	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/bcrypt"
+	"log"
+	"strconv"
 	"time"
 )
 
+// Options are the optional policies of the signinUser nanos, the zero value enables none of them
+type Options struct {
+	// LockoutPolicy locks accounts after repeated failed signins
+	LockoutPolicy *LockoutPolicy
+	// RateLimiter is the channel of a rateLimiter nanos throttling each source
+	RateLimiter chan nanos.Message
+	// AuditSink records the audit events, nil records none
+	AuditSink audit.Sink
+	// NewDevicePolicy notifies or confirms the signins from new devices
+	NewDevicePolicy *NewDevicePolicy
+	// AccessTokens issues the access tokens, nil signs JWTs with key
+	AccessTokens AccessTokenIssuer
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
 func NewSigninUserNanos(
 	workersMaxCount int,
 	taskQueueCapacity int,
@@ -18,16 +41,30 @@ func NewSigninUserNanos(
 	hours int,
 	firstFieldValidationRules []func(firstField string) (bool, string),
 	passwordValidationRules []func(password string) (bool, string),
+	options Options,
 ) chan nanos.Message {
 
+	worker := &signinUserWorker{
+		db:                        db,
+		key:                       key,
+		hours:                     hours,
+		firstFieldValidationRules: firstFieldValidationRules,
+		passwordValidationRules:   passwordValidationRules,
+		lockoutPolicy:             options.LockoutPolicy,
+		rateLimiter:               options.RateLimiter,
+		auditSink:                 options.AuditSink,
+		newDevicePolicy:           options.NewDevicePolicy,
+		accessTokens:              options.AccessTokens,
+		now:                       time.Now,
+		compareHash:               bcrypt.CompareHashAndPassword,
+		delivery:                  options.Delivery,
+	}
+
+	worker.prepareStore()
+	worker.prepareDummyHash()
+
 	myNanos := nanos.Nanos{
-		Worker: &signinUserWorker{
-			db:                        db,
-			key:                       key,
-			hours:                     hours,
-			firstFieldValidationRules: firstFieldValidationRules,
-			passwordValidationRules:   passwordValidationRules,
-		},
+		Worker:            worker,
 		TaskQueueCapacity: taskQueueCapacity,
 		WorkersMaxCount:   workersMaxCount,
 	}
@@ -42,35 +79,53 @@ type signinUserWorker struct {
 	hours                     int
 	firstFieldValidationRules []func(firstField string) (bool, string)
 	passwordValidationRules   []func(password string) (bool, string)
+	lockoutPolicy             *LockoutPolicy
+	rateLimiter               chan nanos.Message
+	auditSink                 audit.Sink
+	newDevicePolicy           *NewDevicePolicy
+	accessTokens              AccessTokenIssuer
+	dummyHash                 []byte
+	now                       func() time.Time
+	compareHash               func(hash []byte, password []byte) error
+	delivery                  *messages.Delivery
 }
 
 func (w *signinUserWorker) Work(msg nanos.Message) {
 
-	// extract content from msg
-	var content struct {
-		FirstField string
-		Password   string
+	// audit the attempt whatever its outcome
+	event := audit.Event{Action: audit.ActionSignin, Outcome: audit.OutcomeFailure, Reason: "internal"}
+	defer func() { audit.Record(w.auditSink, event) }()
+
+	// skip requests the caller already gave up on
+	ctx := messages.Context(msg)
+	if err := ctx.Err(); err != nil {
+		event.Reason = "cancelled"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// extract content from msg, unversioned contents have the same shape as the payload
+	var content Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &content)
 	}
-	err := json.Unmarshal(msg.Content, &content)
 	if err != nil {
-		select {
-		case msg.ErrTo <- err:
-			return
-		default:
-			return
-		}
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
 	}
 
+	event.Subject = content.FirstField
+	event.Source = content.Source
+
 	// validate FirstField
 	for i := range w.firstFieldValidationRules {
 		isValid, errString := w.firstFieldValidationRules[i](content.FirstField)
 		if !isValid {
-			select {
-			case msg.ErrTo <- errors.New(errString):
-				return
-			default:
-				return
-			}
+			event.Reason = "validation_failed"
+			w.delivery.Fail(msg, entities.ValidationError("first_field", errString))
+			return
 		}
 	}
 
@@ -78,33 +133,36 @@ func (w *signinUserWorker) Work(msg nanos.Message) {
 	for i := range w.passwordValidationRules {
 		isValid, errString := w.passwordValidationRules[i](content.Password)
 		if !isValid {
-			select {
-			case msg.ErrTo <- errors.New(errString):
-				return
-			default:
-				return
-			}
+			event.Reason = "validation_failed"
+			w.delivery.Fail(msg, entities.ValidationError("password", errString))
+			return
 		}
 	}
 
-	// check if the first field exist in the db
-	rows, err := w.db.Query("SELECT  id, name, username, email, phone, password, roles FROM users WHERE (username == ?) OR (email == ?) OR (phone == ?)", content.FirstField, content.FirstField, content.FirstField)
-	if err != nil {
-		select {
-		case msg.ErrTo <- err:
-			return
-		default:
+	// throttle the source before the expensive work, requests without one would all share a single bucket
+	if content.Source != "" {
+		err = rateLimiter.Check(ctx, w.rateLimiter, "signin:"+content.Source)
+		if err != nil {
+			event.Reason = "rate_limited"
+			w.delivery.Fail(msg, entities.ToError(err))
 			return
 		}
 	}
-	defer rows.Close()
+
+	// check if the first field exist in the db
+	rows, err := w.db.QueryContext(ctx, "SELECT  id, name, username, email, phone, password, roles, status, suspended_until FROM users WHERE deleted_at = 0 AND ((username == ?) OR (email == ?) OR (phone == ?))", content.FirstField, content.FirstField, content.FirstField)
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
 	if !rows.Next() {
-		select {
-		case msg.ErrTo <- errors.New("username or password is wrong"):
-			return
-		default:
-			return
-		}
+		rows.Close()
+
+		// spend the same bcrypt time as for existing users so timing does not reveal the account
+		_ = w.compareHash(w.dummyHash, []byte(content.Password))
+		event.Reason = "unknown_user"
+		w.delivery.Fail(msg, errWrongCredentials)
+		return
 	}
 	var id int
 	var name string
@@ -113,68 +171,156 @@ func (w *signinUserWorker) Work(msg nanos.Message) {
 	var phone string
 	var hashedPassword string
 	var rawRoles string
-	err = rows.Scan(&id, &name, &username, &email, &phone, &hashedPassword, &rawRoles)
+	var status string
+	var suspendedUntil int64
+	err = rows.Scan(&id, &name, &username, &email, &phone, &hashedPassword, &rawRoles, &status, &suspendedUntil)
+	rows.Close()
 	if err != nil {
-		select {
-		case msg.ErrTo <- err:
-			return
-		default:
-			return
-		}
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	event.Subject = strconv.Itoa(id)
+	event.Actor = event.Subject
+
+	// refuse locked accounts
+	lockedUntil, err := w.lockedUntil(ctx, id)
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	if !lockedUntil.IsZero() {
+		event.Reason = "locked"
+		w.delivery.Fail(msg, entities.ToError(&LockedError{Until: lockedUntil}))
+		return
+	}
+
+	// do not spend the hashing time on a caller that gave up
+	if err = ctx.Err(); err != nil {
+		event.Reason = "cancelled"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
 	}
 
 	// check password
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(content.Password))
+	err = w.compareHash([]byte(hashedPassword), []byte(content.Password))
 	if err != nil {
-		select {
-		case msg.ErrTo <- errors.New("username or password is wrong"):
-			return
-		default:
+		event.Reason = "invalid_credentials"
+		err = w.recordFailure(ctx, id)
+		if err != nil {
+			w.delivery.Fail(msg, entities.ToError(err))
 			return
 		}
+		w.delivery.Fail(msg, errWrongCredentials)
+		return
+	}
+	err = w.resetFailures(ctx, id)
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// refuse suspended and disabled accounts, only after the password proved the caller owns it
+	err = entities.StatusError(status, time.Unix(suspendedUntil, 0), w.now())
+	if err != nil {
+		event.Reason = status
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// recognize the device, a new one is notified or has to be confirmed
+	err = w.checkDevice(ctx, id, email, phone, device{ID: content.DeviceID, UserAgent: content.UserAgent, IP: content.IP}, content.StepUpChallenge, content.StepUpCode)
+	if _, ok := err.(*StepUpRequiredError); ok {
+		event.Reason = "step_up_required"
+	}
+	if err == ErrStepUpFailed {
+		event.Reason = "step_up_failed"
+	}
+	if err == ErrStepUpLocked {
+		event.Reason = "step_up_locked"
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// record the session the tokens are bound to, browser sessions only get their cookie token
+	createSession := datastores.CreateSession
+	if content.Cookie {
+		createSession = datastores.CreateCookieSession
+	}
+	session, sessionToken, err := createSession(ctx, w.db, int64(id), content.UserAgent, content.IP, w.now())
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	if content.Cookie {
+		w.replyTokens(msg, &event, versioned, Tokens{SessionToken: sessionToken, SessionID: session.ID})
+		return
 	}
 
-	// return jwt token
+	// return the access token
 	var roles []string
 	if rawRoles == "" {
 		roles = nil
 	} else {
 		err = json.Unmarshal([]byte(rawRoles), &roles)
 		if err != nil {
-			select {
-			case msg.ErrTo <- err:
-				return
-			default:
-				return
-			}
+			w.delivery.Fail(msg, entities.ToError(err))
+			return
 		}
 	}
-	token, err := w.createToken(id, roles)
+	token, err := IssueAccessToken(ctx, w.accessTokens, w.key, w.hours, id, roles, session.ID)
 	if err != nil {
-		select {
-		case msg.ErrTo <- err:
-			return
-		default:
-			return
-		}
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
 	}
 
-	select {
-	case msg.ResTo <- nanos.Message{Content: []byte(token)}:
-		return
-	default:
+	w.replyTokens(msg, &event, versioned, Tokens{AccessToken: token, RefreshToken: sessionToken, SessionID: session.ID})
+
+}
+
+// replyTokens sends tokens back and marks the attempt as successful.
+// Unversioned requests get the raw access token, or the session token of browser sessions,
+// the refresh token and session id are only in the versioned Response.
+func (w *signinUserWorker) replyTokens(msg nanos.Message, event *audit.Event, versioned bool, tokens Tokens) {
+	legacy := tokens.AccessToken
+	if tokens.SessionToken != "" {
+		legacy = tokens.SessionToken
+	}
+	rawTokens, err := messages.Reply(versioned, []byte(legacy), Response{Tokens: tokens})
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
 		return
 	}
 
+	event.Outcome = audit.OutcomeSuccess
+	event.Reason = ""
+	w.delivery.Reply(msg, rawTokens)
 }
 
-func (w *signinUserWorker) createToken(ID int, roles []string) (string, error) {
-	jwtKey := []byte(w.key)
-	exp := time.Now().Add(time.Duration(w.hours) * time.Hour)
+// prepareDummyHash hashes a random password with the cost used for stored passwords
+func (w *signinUserWorker) prepareDummyHash() {
+	password := make([]byte, 16)
+	_, err := rand.Read(password)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w.dummyHash, err = bcrypt.GenerateFromPassword(password, entities.PasswordHashCost)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewAccessToken returns the JWT signin issues, valid for hours and bound to the session
+func NewAccessToken(key string, hours int, ID int, roles []string, sessionID string) (string, error) {
+	jwtKey := []byte(key)
+	exp := time.Now().Add(time.Duration(hours) * time.Hour)
 
 	claims := claims{
-		ID:    ID,
-		Roles: roles,
+		ID:        ID,
+		Roles:     roles,
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: exp.Unix(),
 		},
@@ -190,8 +336,21 @@ func (w *signinUserWorker) createToken(ID int, roles []string) (string, error) {
 	return tokenString, nil
 }
 
+// errWrongCredentials does not tell whether the user exists or the password is wrong
+var errWrongCredentials = entities.NewError(entities.CodeInvalidCredentials, "username or password is wrong")
+
 type claims struct {
-	ID    int   `json:"id"`
-	Roles []string `json:"roles"`
+	ID        int      `json:"id"`
+	Roles     []string `json:"roles"`
+	SessionID string   `json:"sid,omitempty"`
 	jwt.StandardClaims
 }
+
+// Tokens is the versioned reply of a successful signin, browser sessions only get SessionToken and SessionID
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	SessionID    string `json:"session_id"`
+	// SessionToken is the cookie of a browser session, see Request.Cookie
+	SessionToken string `json:"session_token,omitempty"`
+}
@@ -1,14 +1,24 @@
 package signinUser
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/audit"
 	"github.com/bashar-saleh/auth-nanos/datastores"
 	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/paseto"
+	"github.com/bashar-saleh/auth-nanos/rateLimiter"
 	"github.com/bashar-saleh/gonanos/nanos"
 	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ed25519"
 	"log"
+	"os"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 )
@@ -16,30 +26,657 @@ import (
 var succeed = "\u2713"
 var failure = "\u2717"
 
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
 func TestSigninUser(t *testing.T) {
 	t.Run("testValidationRules", testValidationRules)
 	t.Run("Given username not exist in DB When we signin Then error is returned with msg //username or password is wrong//", signinNonExistUser)
 	t.Run("Given password is wrong When we signin Then error is returned with msg //username or password is wrong//", signinWrongPassword)
 	t.Run("Given username and password are correct When we signin Then jwt token is returned ", signinValidData)
+	t.Run("Given repeated wrong passwords When we signin Then the account is locked until the window passes", signinLockout)
+	t.Run("Given a source over its rate limit When we signin Then LimitedError is returned", signinRateLimited)
+	t.Run("Given existing and missing users When we signin with wrong passwords Then both compare a hash of the same cost", signinTimingSafe)
+	t.Run("Given suspended or disabled account When we signin Then a distinct error is returned", signinNonActiveUser)
+	t.Run("Given audit sink When we signin Then every attempt is recorded with its outcome", signinAudited)
+	t.Run("Given known devices When we signin from a new one Then the user is notified", signinNewDevice)
+	t.Run("Given step-up policy When we signin from a new device Then tokens are issued only with the sent code", signinStepUp)
+	t.Run("Given parallel wrong step-up codes When we signin Then every code takes an attempt", signinStepUpParallel)
+	t.Run("Given opaque tokens When we signin Then a random access token is returned and only its hash is stored", signinOpaqueToken)
+	t.Run("Given PASETO tokens When we signin Then a v4 access token carrying the claims is returned", signinPasetoToken)
+	t.Run("Given a versioned request When we signin Then a versioned response is returned", signinVersioned)
+	t.Run("Given a cancelled context When we signin Then the work is skipped", signinCancelled)
+}
+
+type fakeNotifier struct {
+	notices []entities.Notice
+}
+
+func (n *fakeNotifier) Notify(notice entities.Notice) error {
+	n.notices = append(n.notices, notice)
+	return nil
+}
+
+type deviceSignin struct {
+	FirstField      string
+	Password        string
+	UserAgent       string
+	IP              string
+	DeviceID        string
+	StepUpChallenge string
+	StepUpCode      string
+}
+
+func signinFromDevice(mailBox chan nanos.Message, content deviceSignin) ([]byte, error) {
+	var resTo = make(chan nanos.Message, 1)
+	var errTo = make(chan error, 1)
+	rawContent, _ := json.Marshal(content)
+	mailBox <- nanos.Message{Content: rawContent, ResTo: resTo, ErrTo: errTo}
+
+	select {
+	case res := <-resTo:
+		return res.Content, nil
+	case err := <-errTo:
+		return nil, err
+	case <-time.After(time.Second * 10):
+		return nil, errors.New("timeout")
+	}
+}
+
+func signinNewDevice(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+		Email:    "bashar@example.com",
+	})
+	notifier := &fakeNotifier{}
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{NewDevicePolicy: &NewDevicePolicy{Notifier: notifier}})
+
+	steps := []struct {
+		userAgent string
+		deviceID  string
+		notified  bool
+	}{
+		{userAgent: "Firefox", notified: false}, // the first device is trusted
+		{userAgent: "Firefox", notified: false},
+		{userAgent: "Safari", notified: true},
+		{userAgent: "Safari", notified: false},
+		{userAgent: "Firefox", deviceID: "other install", notified: true},
+	}
+
+	for i := range steps {
+		before := len(notifier.notices)
+		_, err := signinFromDevice(mailBox, deviceSignin{FirstField: "bashar_123", Password: "bb123123", UserAgent: steps[i].userAgent, IP: "10.0.0.1", DeviceID: steps[i].deviceID})
+		if err != nil {
+			t.Fatalf("\t%s\tsteps[%v] Nanos should not return any error -- %v", failure, i, err)
+		}
+		notified := len(notifier.notices) > before
+		if notified != steps[i].notified {
+			t.Fatalf("\t%s\tsteps[%v] notified should be %v", failure, i, steps[i].notified)
+		}
+		if notified {
+			notice := notifier.notices[before]
+			if notice.Kind != entities.NoticeNewDevice || notice.UserID != 1 || notice.Email != "bashar@example.com" || notice.Data["user_agent"] != steps[i].userAgent {
+				t.Fatalf("\t%s\tsteps[%v] the notice is not correct -- %v", failure, i, notice)
+			}
+		}
+	}
+
+	// a wrong password from a new device reveals nothing
+	_, err := signinFromDevice(mailBox, deviceSignin{FirstField: "bashar_123", Password: "wrong", UserAgent: "Chrome"})
+	if err == nil || len(notifier.notices) != 2 {
+		t.Fatalf("\t%s\twrong password should not notify -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func signinStepUp(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+		Email:    "bashar@example.com",
+	})
+	notifier := &fakeNotifier{}
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{NewDevicePolicy: &NewDevicePolicy{Notifier: notifier, RequireStepUp: true, MaxStepUpAttempts: 2}})
+
+	_, err := signinFromDevice(mailBox, deviceSignin{FirstField: "bashar_123", Password: "bb123123", UserAgent: "Firefox"})
+	if err != nil {
+		t.Fatalf("\t%s\tthe first device should be trusted -- %v", failure, err)
+	}
+
+	newDevice := deviceSignin{FirstField: "bashar_123", Password: "bb123123", UserAgent: "Safari"}
+	_, err = signinFromDevice(mailBox, newDevice)
+	stepUp, ok := entities.ToError(err).Err.(*StepUpRequiredError)
+	if !ok || stepUp.Challenge == "" || len(notifier.notices) != 1 || notifier.notices[0].Kind != entities.NoticeStepUpCode {
+		t.Fatalf("\t%s\ta new device should require step-up -- %v %v", failure, err, notifier.notices)
+	}
+	code := notifier.notices[0].Data["code"]
+
+	// the code is bound to the device it was sent for
+	other := deviceSignin{FirstField: "bashar_123", Password: "bb123123", UserAgent: "Chrome", StepUpChallenge: stepUp.Challenge, StepUpCode: code}
+	_, err = signinFromDevice(mailBox, other)
+	if err != ErrStepUpFailed {
+		t.Fatalf("\t%s\tthe code should not confirm another device -- %v", failure, err)
+	}
+
+	newDevice.StepUpChallenge = stepUp.Challenge
+	newDevice.StepUpCode = "wrong"
+	_, err = signinFromDevice(mailBox, newDevice)
+	if err != ErrStepUpFailed {
+		t.Fatalf("\t%s\ta wrong code should fail -- %v", failure, err)
+	}
+	newDevice.StepUpCode = code
+	raw, err := signinFromDevice(mailBox, newDevice)
+	if err != nil || len(raw) == 0 {
+		t.Fatalf("\t%s\tthe right code should issue tokens -- %v", failure, err)
+	}
+
+	// the challenge is single use and the device is known now
+	_, err = signinFromDevice(mailBox, newDevice)
+	if err != nil {
+		t.Fatalf("\t%s\ta confirmed device should sign in without step-up -- %v", failure, err)
+	}
+
+	// a new challenge replaces the previous one and keeps its spent attempts
+	chrome := deviceSignin{FirstField: "bashar_123", Password: "bb123123", UserAgent: "Chrome"}
+	_, err = signinFromDevice(mailBox, chrome)
+	first, _ := entities.ToError(err).Err.(*StepUpRequiredError)
+	chrome.StepUpChallenge = first.Challenge
+	chrome.StepUpCode = "wrong"
+	_, _ = signinFromDevice(mailBox, chrome)
+	chrome.StepUpChallenge = ""
+	chrome.StepUpCode = ""
+	_, err = signinFromDevice(mailBox, chrome)
+	stepUp, ok = entities.ToError(err).Err.(*StepUpRequiredError)
+	if !ok {
+		t.Fatalf("\t%s\ta device with attempts left should get a new challenge -- %v", failure, err)
+	}
+	chrome.StepUpChallenge = first.Challenge
+	chrome.StepUpCode = notifier.notices[len(notifier.notices)-2].Data["code"]
+	_, err = signinFromDevice(mailBox, chrome)
+	if err != ErrStepUpFailed {
+		t.Fatalf("\t%s\tthe replaced challenge should not be accepted -- %v", failure, err)
+	}
+	var attempts int
+	_ = db.QueryRow("select attempts from step_up_challenges where id = ?", stepUp.Challenge).Scan(&attempts)
+	if attempts != 1 {
+		t.Fatalf("\t%s\tthe new challenge should keep the spent attempts -- %v", failure, attempts)
+	}
+
+	// too many wrong codes spend the challenge, and no other one is made for the device
+	chrome.StepUpChallenge = stepUp.Challenge
+	chrome.StepUpCode = "wrong"
+	_, _ = signinFromDevice(mailBox, chrome)
+	chrome.StepUpCode = notifier.notices[len(notifier.notices)-1].Data["code"]
+	_, err = signinFromDevice(mailBox, chrome)
+	if err != ErrStepUpFailed {
+		t.Fatalf("\t%s\tthe challenge should be spent after too many wrong codes -- %v", failure, err)
+	}
+	notices := len(notifier.notices)
+	chrome.StepUpChallenge = ""
+	chrome.StepUpCode = ""
+	_, err = signinFromDevice(mailBox, chrome)
+	if err != ErrStepUpLocked || len(notifier.notices) != notices {
+		t.Fatalf("\t%s\ta device that spent its attempts should not get a new challenge -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func signinStepUpParallel(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+		Email:    "bashar@example.com",
+	})
+	notifier := &fakeNotifier{}
+	mailBox := NewSigninUserNanos(4, 10, db, "secretKey", 4, nil, nil, Options{NewDevicePolicy: &NewDevicePolicy{Notifier: notifier, RequireStepUp: true, MaxStepUpAttempts: 5}})
+
+	_, _ = signinFromDevice(mailBox, deviceSignin{FirstField: "bashar_123", Password: "bb123123", UserAgent: "Firefox"})
+	_, err := db.Exec("insert into step_up_challenges (id, user_id, fingerprint, code_hash, expires_at) values ('stale', 1, '', '', ?)", time.Now().Add(-time.Minute).UnixNano())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	safari := deviceSignin{FirstField: "bashar_123", Password: "bb123123", UserAgent: "Safari"}
+	_, err = signinFromDevice(mailBox, safari)
+	stepUp, ok := entities.ToError(err).Err.(*StepUpRequiredError)
+	if !ok {
+		t.Fatalf("\t%s\ta new device should require step-up -- %v", failure, err)
+	}
+	var stale int
+	_ = db.QueryRow("select count(*) from step_up_challenges where id = 'stale'").Scan(&stale)
+	if stale != 0 {
+		t.Fatalf("\t%s\texpired challenges should be purged when a new one is stored", failure)
+	}
+
+	safari.StepUpChallenge = stepUp.Challenge
+	safari.StepUpCode = "wrong"
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := signinFromDevice(mailBox, safari)
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != ErrStepUpFailed {
+			t.Fatalf("\t%s\ta wrong code should fail -- %v", failure, err)
+		}
+	}
+	var attempts int
+	_ = db.QueryRow("select attempts from step_up_challenges where id = ?", stepUp.Challenge).Scan(&attempts)
+	if attempts != cap(errs) {
+		t.Fatalf("\t%s\tevery parallel wrong code should take an attempt -- %v", failure, attempts)
+	}
+
+	// the last attempt is still the right code's
+	safari.StepUpCode = notifier.notices[len(notifier.notices)-1].Data["code"]
+	_, err = signinFromDevice(mailBox, safari)
+	if err != nil {
+		t.Fatalf("\t%s\tthe right code should issue tokens -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+type channelSink chan audit.Event
+
+func (s channelSink) Write(event audit.Event) error {
+	s <- event
+	return nil
+}
+
+func signinAudited(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+	})
+	sink := make(channelSink, 10)
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{AuditSink: sink})
+
+	data := []struct {
+		firstField string
+		password   string
+		subject    string
+		outcome    string
+		reason     string
+	}{
+		{firstField: "bashar_123", password: "bb123123", subject: "1", outcome: audit.OutcomeSuccess},
+		{firstField: "bashar_123", password: "wrong", subject: "1", outcome: audit.OutcomeFailure, reason: "invalid_credentials"},
+		{firstField: "nobody", password: "wrong", subject: "nobody", outcome: audit.OutcomeFailure, reason: "unknown_user"},
+	}
+
+	for i := range data {
+		_, _ = signin(mailBox, data[i].firstField, data[i].password)
+		select {
+		case event := <-sink:
+			if event.Action != audit.ActionSignin || event.Subject != data[i].subject || event.Outcome != data[i].outcome || event.Reason != data[i].reason || event.Time.IsZero() {
+				t.Fatalf("\t%s\tdata[%v] wrong event -- %+v", failure, i, event)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("\t%s\tdata[%v] no event recorded", failure, i)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func signinNonActiveUser(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+	})
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{})
+
+	data := []struct {
+		status         string
+		suspendedUntil time.Time
+		check          func(err error) bool
+	}{
+		{status: entities.StatusSuspended, suspendedUntil: time.Now().Add(time.Hour), check: func(err error) bool {
+			_, ok := entities.ToError(err).Err.(*entities.SuspendedError)
+			return ok && entities.ToError(err).Code == entities.CodeAccountSuspended
+		}},
+		{status: entities.StatusDisabled, check: func(err error) bool { return err == entities.ErrAccountDisabled }},
+		{status: entities.StatusSuspended, suspendedUntil: time.Now().Add(-time.Hour), check: func(err error) bool { return err == nil }},
+		{status: entities.StatusActive, check: func(err error) bool { return err == nil }},
+	}
+
+	for i := range data {
+		_, err := db.Exec("update users set status = ?, suspended_until = ? where username = 'bashar_123'", data[i].status, data[i].suspendedUntil.Unix())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = signin(mailBox, "bashar_123", "bb123123")
+		if !data[i].check(err) {
+			t.Fatalf("\t%s\tdata[%v] unexpected result -- %v", failure, i, err)
+		}
+	}
+
+	// deleted users are unknown
+	_, _ = db.Exec("update users set status = 'active', deleted_at = 1 where username = 'bashar_123'")
+	_, err := signin(mailBox, "bashar_123", "bb123123")
+	if err == nil || err.Error() != "username or password is wrong" {
+		t.Fatalf("\t%s\tdeleted user should not signin -- %v", failure, err)
+	}
+	_, _ = db.Exec("update users set deleted_at = 0 where username = 'bashar_123'")
+
+	// the status is not revealed to wrong passwords
+	_, _ = db.Exec("update users set status = 'disabled' where username = 'bashar_123'")
+	_, err = signin(mailBox, "bashar_123", "wrong")
+	if err == nil || err.Error() != "username or password is wrong" {
+		t.Fatalf("\t%s\twrong password should not reveal the status -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func signinOpaqueToken(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+		Roles:    []string{"admin"},
+	})
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{AccessTokens: NewOpaqueTokens(db)})
+
+	tokens, err := signinTokens(mailBox, "bashar_123", "bb123123")
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	if tokens.AccessToken == "" || strings.Contains(tokens.AccessToken, ".") || tokens.RefreshToken == "" {
+		t.Fatalf("\t%s\tan opaque access token should be returned with the refresh token -- %+v", failure, tokens)
+	}
+
+	var count int
+	_ = db.QueryRow("SELECT count(*) FROM access_tokens WHERE token_hash = ?", tokens.AccessToken).Scan(&count)
+	if count != 0 {
+		t.Fatalf("\t%s\tthe access token should not be stored in clear", failure)
+	}
+	record, err := datastores.AccessTokenByToken(context.Background(), db, tokens.AccessToken)
+	if err != nil || record.UserID != 1 || record.SessionID != tokens.SessionID || len(record.Roles) != 1 || record.Roles[0] != "admin" {
+		t.Fatalf("\t%s\tthe claims of the token should be stored -- %+v %v", failure, record, err)
+	}
+	if d := time.Until(record.ExpiresAt); d < 3*time.Hour || d > 4*time.Hour {
+		t.Fatalf("\t%s\tthe token should expire after the signin hours -- %v", failure, record.ExpiresAt)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func signinPasetoToken(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+		Roles:    []string{"admin"},
+	})
+	publicKey, secretKey, _ := ed25519.GenerateKey(nil)
+	localKey := make([]byte, paseto.KeySize)
+
+	data := []struct {
+		issuer AccessTokenIssuer
+		open   func(token string) ([]byte, []byte, error)
+	}{
+		{issuer: NewPasetoPublicTokens(secretKey), open: func(token string) ([]byte, []byte, error) { return paseto.Verify(publicKey, token, nil) }},
+		{issuer: NewPasetoLocalTokens(localKey), open: func(token string) ([]byte, []byte, error) { return paseto.Decrypt(localKey, token, nil) }},
+	}
+	for i := range data {
+		mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{AccessTokens: data[i].issuer})
+		tokens, err := signinTokens(mailBox, "bashar_123", "bb123123")
+		if err != nil {
+			t.Fatalf("\t%s\tdata[%v] Nanos should not return any error -- %v", failure, i, err)
+		}
+
+		message, _, err := data[i].open(tokens.AccessToken)
+		var claims paseto.Claims
+		if err == nil {
+			err = json.Unmarshal(message, &claims)
+		}
+		if err != nil || claims.ID != 1 || claims.SessionID != tokens.SessionID || len(claims.Roles) != 1 || claims.Roles[0] != "admin" {
+			t.Fatalf("\t%s\tdata[%v] the token should carry the claims -- %+v %v", failure, i, claims, err)
+		}
+		if d := claims.ExpiresAt.Sub(claims.IssuedAt); d < 4*time.Hour-time.Second || d > 4*time.Hour+time.Second {
+			t.Fatalf("\t%s\tdata[%v] the token should expire after the signin hours -- %v", failure, i, d)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func signinTimingSafe(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+	})
+
+	var compared [][]byte
+	worker := &signinUserWorker{
+		db:  db,
+		key: "secretKey",
+		now: time.Now,
+		compareHash: func(hash []byte, password []byte) error {
+			compared = append(compared, hash)
+			return bcrypt.CompareHashAndPassword(hash, password)
+		},
+	}
+	worker.prepareStore()
+	worker.prepareDummyHash()
+
+	work := func(firstField string) {
+		errTo := make(chan error, 1)
+		rawContent, _ := json.Marshal(Request{FirstField: firstField, Password: "wrong password"})
+		worker.Work(nanos.Message{Content: rawContent, ResTo: make(chan nanos.Message, 1), ErrTo: errTo})
+		err := <-errTo
+		if err == nil || err.Error() != "username or password is wrong" {
+			t.Fatalf("\t%s\tNanos should return //username or password is wrong// -- %v", failure, err)
+		}
+	}
+
+	// both paths hash the password once, the missing user against the dummy hash
+	work("bashar_123")
+	work("nobody_123")
+	if len(compared) != 2 {
+		t.Fatalf("\t%s\tevery signin should compare one hash -- %v", failure, len(compared))
+	}
+	if string(compared[1]) != string(worker.dummyHash) {
+		t.Fatalf("\t%s\tmissing user should be compared with the dummy hash", failure)
+	}
+
+	// the dummy hash costs as much as the stored ones
+	storedCost, err := bcrypt.Cost(compared[0])
+	if err != nil {
+		t.Fatalf("\t%s\tstored hash should be bcrypt -- %v", failure, err)
+	}
+	dummyCost, err := bcrypt.Cost(compared[1])
+	if err != nil || dummyCost != storedCost {
+		t.Fatalf("\t%s\tdummy hash should cost %v -- %v %v", failure, storedCost, dummyCost, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func signinRateLimited(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+	})
+	window, _ := rateLimiter.NewSlidingWindow(1, time.Minute)
+	limiter := rateLimiter.NewRateLimiterNanos(1, 10, window, rateLimiter.Options{})
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{RateLimiter: limiter})
+
+	send := func(source string) error {
+		errTo := make(chan error, 1)
+		resTo := make(chan nanos.Message, 1)
+		rawContent, _ := json.Marshal(map[string]string{"FirstField": "bashar_123", "Password": "bb123123", "Source": source})
+		mailBox <- nanos.Message{Content: rawContent, ResTo: resTo, ErrTo: errTo}
+		select {
+		case <-resTo:
+			return nil
+		case err := <-errTo:
+			return err
+		case <-time.After(time.Second * 10):
+			return errors.New("timeout")
+		}
+	}
+
+	if err := send("10.0.0.1"); err != nil {
+		t.Fatalf("\t%s\tfirst signin should pass -- %v", failure, err)
+	}
+	if _, ok := entities.ToError(send("10.0.0.1")).Err.(*rateLimiter.LimitedError); !ok {
+		t.Fatalf("\t%s\tsecond signin from the same source should be limited", failure)
+	}
+	if err := send("10.0.0.2"); err != nil {
+		t.Fatalf("\t%s\tsignin from another source should pass -- %v", failure, err)
+	}
+
+	// callers without a source do not share one bucket
+	for i := 0; i < 2; i++ {
+		if err := send(""); err != nil {
+			t.Fatalf("\t%s\tsignin without source should not be limited -- %v", failure, err)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func signinLockout(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+	})
+	policy := &LockoutPolicy{MaxAttempts: 2, BaseLockout: 300 * time.Millisecond, MaxLockout: time.Second}
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{LockoutPolicy: policy})
+
+	steps := []struct {
+		password string
+		wait     time.Duration
+		expected string
+	}{
+		{password: "wrong", expected: "username or password is wrong"},
+		{password: "wrong", expected: "username or password is wrong"},
+		{password: "bb123123", expected: "locked"},
+		{password: "bb123123", wait: 400 * time.Millisecond, expected: ""},
+		{password: "wrong", expected: "username or password is wrong"},
+		{password: "bb123123", expected: ""},
+	}
+
+	for i := range steps {
+		time.Sleep(steps[i].wait)
+		_, err := signin(mailBox, "bashar_123", steps[i].password)
+		if steps[i].expected == "" {
+			if err != nil {
+				t.Fatalf("\t%s\tstep[%v] Nanos should not return any error -- %v", failure, i, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("\t%s\tstep[%v] Nanos should return error with msg //%s//", failure, i, steps[i].expected)
+		}
+		matched, _ := regexp.MatchString(steps[i].expected, err.Error())
+		if !matched {
+			t.Fatalf("\t%s\tstep[%v] error message is not what supposed to be -- %s", failure, i, err.Error())
+		}
+		if steps[i].expected == "locked" {
+			_, ok := entities.ToError(err).Err.(*LockedError)
+			if !ok || entities.ToError(err).Code != entities.CodeLocked {
+				t.Fatalf("\t%s\tstep[%v] error should be *LockedError -- %T", failure, i, err)
+			}
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+
+	// the second lockout in a row doubles the window
+	for i := 0; i < 2; i++ {
+		_, _ = signin(mailBox, "bashar_123", "wrong")
+	}
+	time.Sleep(400 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		_, _ = signin(mailBox, "bashar_123", "wrong")
+	}
+	_, err := signin(mailBox, "bashar_123", "bb123123")
+	lockedErr, ok := entities.ToError(err).Err.(*LockedError)
+	if !ok {
+		t.Fatalf("\t%s\tNanos should return *LockedError -- %v", failure, err)
+	}
+	if time.Until(lockedErr.Until) <= 300*time.Millisecond {
+		t.Errorf("\t%s\tsecond lockout should last longer than the first -- %v", failure, time.Until(lockedErr.Until))
+	}
+}
+
+func signin(mailBox chan nanos.Message, firstField string, password string) ([]byte, error) {
+	// buffered so a fast reply is not dropped before we start waiting
+	var resTo = make(chan nanos.Message, 1)
+	var errTo = make(chan error, 1)
+	rawContent, _ := json.Marshal(struct {
+		FirstField string
+		Password   string
+	}{
+		FirstField: firstField,
+		Password:   password,
+	})
+	mailBox <- nanos.Message{
+		Content: rawContent,
+		ResTo:   resTo,
+		ErrTo:   errTo,
+	}
+
+	select {
+	case res := <-resTo:
+		return res.Content, nil
+	case err := <-errTo:
+		return nil, err
+	case <-time.After(time.Second * 10):
+		return nil, errors.New("timeout")
+	}
+}
+
+// signinTokens signs in with a versioned request, which replies with every token
+func signinTokens(mailBox chan nanos.Message, firstField string, password string) (Tokens, error) {
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	msg, err := NewMessage(Request{FirstField: firstField, Password: password}, resTo, errTo)
+	if err != nil {
+		return Tokens{}, err
+	}
+	mailBox <- msg
+
+	select {
+	case res := <-resTo:
+		response, err := DecodeResponse(res)
+		return response.Tokens, err
+	case err := <-errTo:
+		return Tokens{}, err
+	case <-time.After(time.Second * 10):
+		return Tokens{}, errors.New("timeout")
+	}
 }
 
 func signinValidData(t *testing.T) {
-	createUserInDB(entities.User{
+	db := createUserInDB(entities.User{
 		Name:     "Bashar",
 		Username: "bashar_123",
 		Password: "bb123123",
 		Roles:    []string{"admin", "user"},
 	})
-	mailBox := NewSigninUserNanos(1, 2, datastores.SqliteConnection("test.db"), "secretKey", 4, nil, nil)
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{})
 	var resTo = make(chan nanos.Message)
 	var errTo = make(chan error)
 
 	var content = struct {
 		FirstField string
 		Password   string
+		UserAgent  string
+		IP         string
 	}{
 		FirstField: "bashar_123",
 		Password:   "bb123123",
+		UserAgent:  "Mozilla/5.0",
+		IP:         "10.0.0.1",
 	}
 	rawContent, _ := json.Marshal(content)
 	mailBox <- nanos.Message{
@@ -51,6 +688,13 @@ func signinValidData(t *testing.T) {
 	select {
 	case res := <-resTo:
 		token := string(res.Content)
+
+		// the session is recorded with the device of the signin
+		sessions, err := datastores.ListSessions(db, 1)
+		if err != nil || len(sessions) != 1 || sessions[0].UserAgent != "Mozilla/5.0" || sessions[0].IP != "10.0.0.1" {
+			t.Fatalf("\t%s\tthe session is not recorded -- %v %v", failure, sessions, err)
+		}
+
 		claims := claims{}
 		tkn, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
 			return []byte("secretKey"), nil
@@ -62,7 +706,7 @@ func signinValidData(t *testing.T) {
 			t.Fatalf("\t%s\tToken is Invalid", failure)
 		}
 
-		if (claims.ID == 1) && (len(claims.Roles) == 2) {
+		if (claims.ID == 1) && (len(claims.Roles) == 2) && claims.SessionID == sessions[0].ID {
 			t.Logf("\t%s\t Pass", succeed)
 			return
 		}
@@ -78,12 +722,12 @@ func signinValidData(t *testing.T) {
 
 func signinWrongPassword(t *testing.T) {
 
-	createUserInDB(entities.User{
+	db := createUserInDB(entities.User{
 		Name:     "Bashar",
 		Username: "bashar_123",
 		Password: "!@#!!@#",
 	})
-	mailBox := NewSigninUserNanos(1, 2, datastores.SqliteConnection("test.db"), "secretKey", 4, nil, nil)
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{})
 	var resTo = make(chan nanos.Message)
 	var errTo = make(chan error)
 
@@ -105,6 +749,9 @@ func signinWrongPassword(t *testing.T) {
 	case _ = <-resTo:
 		t.Errorf("\t%s\tNanos shloud not return response", failure)
 	case err := <-errTo:
+		if entities.ToError(err).Code != entities.CodeInvalidCredentials {
+			t.Fatalf("\t%s\terror code should be invalid_credentials -- %#v", failure, err)
+		}
 		matched, _ := regexp.MatchString("username or password is wrong", err.Error())
 		if !matched {
 			t.Fatalf("\t%s\terror message is not what supposed to be --  %s", failure, err.Error())
@@ -118,12 +765,12 @@ func signinWrongPassword(t *testing.T) {
 }
 
 func signinNonExistUser(t *testing.T) {
-	createUserInDB(entities.User{
+	db := createUserInDB(entities.User{
 		Name:     "Bashar",
 		Username: "bashar_!@#",
 		Password: "123",
 	})
-	mailBox := NewSigninUserNanos(1, 2, datastores.SqliteConnection("test.db"), "secretKey", 4, nil, nil)
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{})
 
 	var resTo = make(chan nanos.Message)
 	var errTo = make(chan error)
@@ -158,7 +805,7 @@ func signinNonExistUser(t *testing.T) {
 
 }
 
-func createUserInDB(user entities.User) {
+func createUserInDB(user entities.User) *sql.DB {
 	db := datastores.SqliteConnection("test.db")
 
 	// check if table exists
@@ -210,6 +857,7 @@ func createUserInDB(user entities.User) {
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	return db
 }
 
 func testValidationRules(t *testing.T) {
@@ -272,16 +920,7 @@ func testValidationRules(t *testing.T) {
 		{
 			db := datastores.SqliteConnection("test.db")
 
-			mailBox := NewSigninUserNanos(
-				1,
-				1000,
-				db,
-				"secretKey",
-				5,
-				data[i].firstFieldValidationRules,
-				data[i].passwordValidationRules,
-
-			)
+			mailBox := NewSigninUserNanos(1, 1000, db, "secretKey", 5, data[i].firstFieldValidationRules, data[i].passwordValidationRules, Options{})
 
 			var resTo = make(chan nanos.Message)
 			var errTo = make(chan error)
@@ -312,3 +951,98 @@ func testValidationRules(t *testing.T) {
 		}
 	}
 }
+
+func signinVersioned(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+	})
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{})
+
+	data := []struct {
+		password string
+		expected string
+	}{
+		{password: "bb123123", expected: ""},
+		{password: "wrong", expected: "wrong"},
+	}
+
+	for i := range data {
+		resTo := make(chan nanos.Message, 1)
+		errTo := make(chan error, 1)
+		msg, err := NewMessage(Request{FirstField: "bashar_123", Password: data[i].password}, resTo, errTo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mailBox <- msg
+
+		select {
+		case res := <-resTo:
+			response, err := DecodeResponse(res)
+			if data[i].expected != "" || err != nil || response.AccessToken == "" || response.SessionID == "" {
+				t.Fatalf("\t%s\tdata[%v] the response is not correct -- %s %v", failure, i, res.Content, err)
+			}
+		case err := <-errTo:
+			matched, _ := regexp.MatchString(data[i].expected, err.Error())
+			if data[i].expected == "" || !matched {
+				t.Fatalf("\t%s\tdata[%v] error should contain //%s// -- %v", failure, i, data[i].expected, err)
+			}
+		case <-time.After(time.Second * 10):
+			t.Fatalf("\t%s\terror timeout", failure)
+		}
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func signinCancelled(t *testing.T) {
+	db := createUserInDB(entities.User{
+		Name:     "Bashar",
+		Username: "bashar_123",
+		Password: "bb123123",
+	})
+	sink := make(channelSink, 10)
+	mailBox := NewSigninUserNanos(1, 2, db, "secretKey", 4, nil, nil, Options{AuditSink: sink})
+
+	data := []struct {
+		ctx  func() (context.Context, context.CancelFunc)
+		code string
+	}{
+		{ctx: func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx, cancel
+		}, code: entities.CodeCancelled},
+		{ctx: func() (context.Context, context.CancelFunc) {
+			return context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		}, code: entities.CodeDeadlineExceeded},
+	}
+
+	for i := range data {
+		ctx, cancel := data[i].ctx()
+		resTo := make(chan nanos.Message, 1)
+		errTo := make(chan error, 1)
+		msg, _ := NewMessage(Request{FirstField: "bashar_123", Password: "bb123123"}, resTo, errTo)
+		mailBox <- messages.WithContext(ctx, msg)
+
+		select {
+		case <-resTo:
+			t.Fatalf("\t%s\tdata[%v] a cancelled signin should not issue tokens", failure, i)
+		case err := <-errTo:
+			if entities.ToError(err).Code != data[i].code {
+				t.Fatalf("\t%s\tdata[%v] error code should be %s -- %v", failure, i, data[i].code, err)
+			}
+		case <-time.After(time.Second * 10):
+			t.Fatalf("\t%s\terror timeout", failure)
+		}
+		cancel()
+		if event := <-sink; event.Reason != "cancelled" {
+			t.Fatalf("\t%s\tdata[%v] audit reason should be cancelled -- %v", failure, i, event)
+		}
+	}
+	sessions, _ := datastores.ListSessions(db, 1)
+	if len(sessions) != 0 {
+		t.Fatalf("\t%s\tno session should be recorded -- %v", failure, sessions)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,34 @@
+package updateUser
+
+import (
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the updateUser nanos.
+// ID comes from the validated token claims and the fields left nil are not changed.
+type Request struct {
+	ID       int64   `json:"id"`
+	Name     *string `json:"name"`
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+	Phone    *string `json:"phone"`
+}
+
+// Response is the versioned response of the updateUser nanos, it holds the updated user
+type Response struct {
+	entities.User
+}
+
+// NewMessage wraps req into a message for the updateUser nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
@@ -0,0 +1,184 @@
+package updateUser
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"strconv"
+)
+
+// Options are the optional policies of the updateUser nanos
+type Options struct {
+	// AuditSink records the audit events, nil records none
+	AuditSink audit.Sink
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+// NewUpdateUserNanos returns the nanos that applies partial profile updates to the signed in user.
+// The rules are the same ones given to NewRegisterUserNanos.
+func NewUpdateUserNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	db *sql.DB,
+	nameValidationRules []func(name string) (bool, string),
+	usernameValidationRules []func(username string) (bool, string),
+	emailValidationRules []func(email string) (bool, string),
+	phoneValidationRules []func(phone string) (bool, string),
+	options Options,
+) chan nanos.Message {
+
+	worker := &updateUserWorker{
+		db:                      db,
+		nameValidationRules:     nameValidationRules,
+		usernameValidationRules: usernameValidationRules,
+		emailValidationRules:    emailValidationRules,
+		phoneValidationRules:    phoneValidationRules,
+		auditSink:               options.AuditSink,
+		delivery:                options.Delivery,
+	}
+
+	worker.prepareStore()
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+type updateUserWorker struct {
+	db                      *sql.DB
+	nameValidationRules     []func(name string) (bool, string)
+	usernameValidationRules []func(username string) (bool, string)
+	emailValidationRules    []func(email string) (bool, string)
+	phoneValidationRules    []func(phone string) (bool, string)
+	auditSink               audit.Sink
+	delivery                *messages.Delivery
+}
+
+func (w *updateUserWorker) Work(msg nanos.Message) {
+
+	// audit the update whatever its outcome
+	event := audit.Event{Action: audit.ActionUpdate, Outcome: audit.OutcomeFailure, Reason: "internal"}
+	defer func() { audit.Record(w.auditSink, event) }()
+
+	// extract content from msg, ID comes from the validated token claims
+	// and the fields left null are not changed
+	var content Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &content)
+	}
+	if err == nil && content.ID == 0 {
+		err = errors.New("claims has no id")
+	}
+	if err != nil {
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	event.Subject = strconv.FormatInt(content.ID, 10)
+	event.Actor = event.Subject
+
+	user, err := datastores.FindUserByID(w.db, content.ID)
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// collect the changed fields
+	var changed entities.User
+	if content.Name != nil && *content.Name != user.Name {
+		changed.Name = *content.Name
+		user.Name = *content.Name
+	}
+	if content.Username != nil && *content.Username != user.Username {
+		changed.Username = *content.Username
+		user.Username = *content.Username
+	}
+	if content.Email != nil && *content.Email != user.Email {
+		changed.Email = *content.Email
+		user.Email = *content.Email
+		user.EmailVerified = false
+	}
+	if content.Phone != nil && *content.Phone != user.Phone {
+		changed.Phone = *content.Phone
+		user.Phone = *content.Phone
+		user.PhoneVerified = false
+	}
+
+	// validate changed fields
+	err = w.validate(content.Name, content.Username, content.Email, content.Phone)
+	if err != nil {
+		event.Reason = "validation_failed"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// check if the new username or email or phone are used by another user
+	err = datastores.UserConflicts(w.db, changed, user.ID)
+	if err != nil {
+		event.Reason = "already_exists"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// saving to db
+	_, err = w.db.Exec("update users set name = ?, username = ?, email = ?, phone = ?, email_verified = ?, phone_verified = ? where id = ?",
+		user.Name, user.Username, user.Email, user.Phone, user.EmailVerified, user.PhoneVerified, user.ID)
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// return the updated user
+	rawUser, err := user.ToByte()
+	if err == nil {
+		rawUser, err = messages.Reply(versioned, rawUser, Response{User: user})
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+	event.Outcome = audit.OutcomeSuccess
+	event.Reason = ""
+	w.delivery.Reply(msg, rawUser)
+
+}
+
+func (w *updateUserWorker) prepareStore() {
+	datastores.PrepareUsersTable(w.db)
+}
+
+// validate runs the rules of the submitted fields only
+func (w *updateUserWorker) validate(name, username, email, phone *string) error {
+	fields := []struct {
+		name  string
+		value *string
+		rules []func(value string) (bool, string)
+	}{
+		{name: "name", value: name, rules: w.nameValidationRules},
+		{name: "username", value: username, rules: w.usernameValidationRules},
+		{name: "email", value: email, rules: w.emailValidationRules},
+		{name: "phone", value: phone, rules: w.phoneValidationRules},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		err := entities.ValidateField(field.name, *field.value, field.rules)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package updateUser
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestUpdateUser(t *testing.T) {
+	t.Run("Given partial update When update user Then only the submitted fields change", testPartialUpdate)
+	t.Run("Given email or phone change When update user Then its verification flag is reset", testVerificationReset)
+	t.Run("Given invalid or used values When update user Then the register errors are returned", testRejectedUpdates)
+}
+
+func prepareDB() *sql.DB {
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareUsersTable(db)
+	_, err := db.Exec(`insert into users (name, username, password, email, phone, roles, email_verified, phone_verified) values
+			('Bashar', 'bashar_123', '', 'bashar@example.com', '+963', '', 1, 1),
+			('Roba', 'roba_123', '', 'roba@example.com', '+964', '', 1, 1)`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+func update(mailBox chan nanos.Message, content string) (entities.User, error) {
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	mailBox <- nanos.Message{Content: []byte(content), ResTo: resTo, ErrTo: errTo}
+
+	select {
+	case res := <-resTo:
+		return entities.UserFromBytes(res.Content)
+	case err := <-errTo:
+		return entities.User{}, err
+	case <-time.After(time.Second * 2):
+		return entities.User{}, errors.New("timeout")
+	}
+}
+
+func testPartialUpdate(t *testing.T) {
+	db := prepareDB()
+	mailBox := NewUpdateUserNanos(1, 10, db, nil, nil, nil, nil, Options{})
+
+	user, err := update(mailBox, `{"id":1,"name":"Bashar Saleh","username":"bashar_123"}`)
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	if user.Name != "Bashar Saleh" || user.Username != "bashar_123" || user.Email != "bashar@example.com" || !user.EmailVerified {
+		t.Fatalf("\t%s\tthe returned user is not correct -- %v", failure, user)
+	}
+	stored, _ := datastores.FindUserByID(db, 1)
+	if !reflect.DeepEqual(stored, user) {
+		t.Fatalf("\t%s\tthe stored user is not the returned one -- %v", failure, stored)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testVerificationReset(t *testing.T) {
+	db := prepareDB()
+	mailBox := NewUpdateUserNanos(1, 10, db, nil, nil, nil, nil, Options{})
+
+	user, err := update(mailBox, `{"id":1,"email":"new@example.com"}`)
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	if user.EmailVerified || !user.PhoneVerified {
+		t.Fatalf("\t%s\tonly email_verified should be reset -- %v", failure, user)
+	}
+
+	user, err = update(mailBox, `{"id":1,"phone":"+1"}`)
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	if user.PhoneVerified {
+		t.Fatalf("\t%s\tphone_verified should be reset -- %v", failure, user)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testRejectedUpdates(t *testing.T) {
+	db := prepareDB()
+	maxLength := func(value string) (bool, string) {
+		if len(value) > 10 {
+			return false, "length is more than 10"
+		}
+		return true, ""
+	}
+	mailBox := NewUpdateUserNanos(1, 10, db, nil, []func(string) (bool, string){maxLength}, nil, nil, Options{})
+
+	data := []struct {
+		content string
+		check   func(err error) bool
+	}{
+		{content: `{"id":1,"username":"bashar_123456789"}`, check: func(err error) bool { return err != nil && err.Error() == "length is more than 10" }},
+		{content: `{"id":1,"username":"roba_123","phone":"+964"}`, check: func(err error) bool {
+			conflict, ok := entities.ToError(err).Err.(*entities.ConflictError)
+			return ok && reflect.DeepEqual(conflict.Fields, []string{"username", "phone"})
+		}},
+		{content: `{"id":3,"name":"nobody"}`, check: func(err error) bool { return err == entities.ErrUserNotExist }},
+		{content: `{"name":"nobody"}`, check: func(err error) bool { return err != nil }},
+	}
+
+	for i := range data {
+		_, err := update(mailBox, data[i].content)
+		if !data[i].check(err) {
+			t.Fatalf("\t%s\tdata[%v] unexpected error -- %v", failure, i, err)
+		}
+	}
+
+	stored, _ := datastores.FindUserByID(db, 1)
+	if stored.Username != "bashar_123" || stored.Phone != "+963" {
+		t.Fatalf("\t%s\trejected updates should not be stored -- %v", failure, stored)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
@@ -0,0 +1,28 @@
+package validateJWT
+
+import (
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the validateJWT nanos, unversioned requests are the raw token
+type Request struct {
+	Token string `json:"token"`
+}
+
+// Response is the versioned response of the validateJWT nanos
+type Response struct {
+	Claims
+}
+
+// NewMessage wraps req into a message for the validateJWT nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
@@ -1,21 +1,71 @@
 package validateJWT
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/paseto"
 	"github.com/bashar-saleh/gonanos/nanos"
 	"github.com/dgrijalva/jwt-go"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// The token formats the validateJWT nanos can accept
+const (
+	// FormatJWT are the HS256 JWTs signed with key
+	FormatJWT = "jwt"
+	// FormatOpaque are the tokens of signinUser.OpaqueTokens, they need db
+	FormatOpaque = "opaque"
+	// FormatPasetoPublic and FormatPasetoLocal are the PASETO v4 tokens, they need the key of their purpose
+	FormatPasetoPublic = "v4.public"
+	FormatPasetoLocal  = "v4.local"
+)
+
+// Options are the optional stores and keys of the validateJWT nanos
+type Options struct {
+	// DB is optional, when set the token owner must still be an active user
+	DB *sql.DB
+	// PasetoKeys are optional, they verify the PASETO formats
+	PasetoKeys *paseto.Keys
+	// Formats are the accepted token formats, the tokens of any other format are refused.
+	// nil accepts FormatJWT only.
+	Formats []string
+	// AuditSink records the audit events, nil records none
+	AuditSink audit.Sink
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
 func NewValidateJWTNanos(
 	workersMaxCount int,
 	taskQueueCapacity int,
 	key string,
+	options Options,
 ) chan nanos.Message {
 
+	if options.Formats == nil {
+		options.Formats = []string{FormatJWT}
+	}
 	worker := validateJWTWorker{
-		key: key,
+		key:        key,
+		db:         options.DB,
+		pasetoKeys: options.PasetoKeys,
+		formats:    make(map[string]bool),
+		auditSink:  options.AuditSink,
+		now:        time.Now,
+		delivery:   options.Delivery,
 	}
+	for _, format := range options.Formats {
+		worker.formats[format] = true
+	}
+	worker.prepareStore()
 
 	myNanos := nanos.Nanos{
 		Worker:            &worker,
@@ -27,51 +77,110 @@ func NewValidateJWTNanos(
 }
 
 type validateJWTWorker struct {
-	key string
+	key        string
+	db         *sql.DB
+	pasetoKeys *paseto.Keys
+	formats    map[string]bool
+	auditSink  audit.Sink
+	now        func() time.Time
+	delivery   *messages.Delivery
 }
 
 func (w *validateJWTWorker) Work(msg nanos.Message) {
 
+	// audit the validation whatever its outcome
+	event := audit.Event{Action: audit.ActionValidate, Outcome: audit.OutcomeFailure, Reason: "internal"}
+	defer func() { audit.Record(w.auditSink, event) }()
+
+	// skip requests the caller already gave up on
+	ctx := messages.Context(msg)
+	if err := ctx.Err(); err != nil {
+		event.Reason = "cancelled"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
 	// extract token from msg
 	if msg.Content == nil {
-		select {
-		case msg.ErrTo <- errors.New("msg is null"):
-			return
-		default:
-			return
-		}
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.NewError(entities.CodeBadRequest, "msg is null"))
+		return
 	}
-	token := string(msg.Content)
 
-	// extract claims from token
+	// unversioned contents are the raw token
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	token := string(payload)
+	if err == nil && versioned {
+		var req Request
+		err = json.Unmarshal(payload, &req)
+		token = req.Token
+	}
+	if err != nil {
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	// extract claims from token, opaque tokens are looked up in db and PASETO ones told by their header
 	var claims Claims
-	err := w.claimsFromToken(token, &claims)
+	switch format := tokenFormat(token); {
+	case !w.formats[format]:
+		err = errInvalidToken
+	case format == FormatJWT:
+		err = w.claimsFromToken(token, &claims)
+	case format == FormatOpaque:
+		err = w.claimsFromStore(ctx, token, &claims)
+	default:
+		err = w.claimsFromPaseto(token, &claims)
+	}
+	if coded, ok := err.(*entities.Error); ok {
+		event.Reason = coded.Code
+		w.delivery.Fail(msg, coded)
+		return
+	}
 	if err != nil {
-		select {
-		case msg.ErrTo <- err:
-			return
-		default:
-			return
+		code := entities.CodeTokenInvalid
+		if validationErr, ok := err.(*jwt.ValidationError); ok && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			code = entities.CodeTokenExpired
 		}
+		event.Reason = code
+		w.delivery.Fail(msg, entities.WrapError(code, err))
+		return
 	}
-	rawClaims, err := json.Marshal(claims)
+
+	event.Subject = strconv.Itoa(claims.ID)
+	event.Actor = event.Subject
+
+	// check the token owner status
+	err = w.checkStatus(ctx, claims.ID)
 	if err != nil {
-		select {
-		case msg.ErrTo <- err:
-			return
-		default:
-			return
-		}
+		event.Reason = "inactive_user"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
 	}
 
-	// sending the response back
-	select {
-	case msg.ResTo <- nanos.Message{Content: rawClaims}:
+	// check the session the token is bound to is not revoked
+	err = w.checkSession(ctx, claims)
+	if err != nil {
+		event.Reason = "session_revoked"
+		w.delivery.Fail(msg, entities.ToError(err))
 		return
-	default:
+	}
+
+	rawClaims, err := json.Marshal(claims)
+	if err == nil {
+		rawClaims, err = messages.Reply(versioned, rawClaims, Response{Claims: claims})
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
 		return
 	}
 
+	// sending the response back
+	event.Outcome = audit.OutcomeSuccess
+	event.Reason = ""
+	w.delivery.Reply(msg, rawClaims)
+
 }
 
 func (w *validateJWTWorker) claimsFromToken(token string, claims *Claims) error {
@@ -88,8 +197,120 @@ func (w *validateJWTWorker) claimsFromToken(token string, claims *Claims) error
 	return nil
 }
 
+// claimsFromStore returns the claims of an opaque token as if it was a JWT, coded errors tell why it is refused
+func (w *validateJWTWorker) claimsFromStore(ctx context.Context, token string, claims *Claims) error {
+	if w.db == nil {
+		return errInvalidToken
+	}
+	record, err := datastores.AccessTokenByToken(ctx, w.db, token)
+	if err != nil {
+		return entities.ToError(err)
+	}
+	if !w.now().Before(record.ExpiresAt) {
+		return entities.NewError(entities.CodeTokenExpired, "token is expired")
+	}
+
+	claims.ID = int(record.UserID)
+	claims.Roles = record.Roles
+	claims.SessionID = record.SessionID
+	claims.IssuedAt = record.IssuedAt.Unix()
+	claims.ExpiresAt = record.ExpiresAt.Unix()
+	return nil
+}
+
+// claimsFromPaseto returns the claims of a v4.public or v4.local token, coded errors tell why it is refused
+func (w *validateJWTWorker) claimsFromPaseto(token string, claims *Claims) error {
+	if w.pasetoKeys == nil {
+		return errInvalidToken
+	}
+
+	var message []byte
+	var err error
+	switch {
+	case strings.HasPrefix(token, paseto.HeaderPublic) && w.pasetoKeys.PublicKey != nil:
+		message, _, err = paseto.Verify(w.pasetoKeys.PublicKey, token, nil)
+	case strings.HasPrefix(token, paseto.HeaderLocal) && w.pasetoKeys.LocalKey != nil:
+		message, _, err = paseto.Decrypt(w.pasetoKeys.LocalKey, token, nil)
+	default:
+		err = paseto.ErrInvalidToken
+	}
+	var pasetoClaims paseto.Claims
+	if err == nil {
+		err = json.Unmarshal(message, &pasetoClaims)
+	}
+	if err != nil {
+		return errInvalidToken
+	}
+	if !w.now().Before(pasetoClaims.ExpiresAt) {
+		return entities.NewError(entities.CodeTokenExpired, "token is expired")
+	}
+
+	claims.ID = pasetoClaims.ID
+	claims.Roles = pasetoClaims.Roles
+	claims.SessionID = pasetoClaims.SessionID
+	claims.IssuedAt = pasetoClaims.IssuedAt.Unix()
+	claims.ExpiresAt = pasetoClaims.ExpiresAt.Unix()
+	return nil
+}
+
+// tokenFormat tells the format of token from its shape, PASETO tokens start with their header and
+// the three parts of JWTs are joined by dots, unlike opaque tokens. Unknown PASETO versions or purposes
+// have no format.
+func tokenFormat(token string) string {
+	switch {
+	case strings.HasPrefix(token, paseto.HeaderPublic):
+		return FormatPasetoPublic
+	case strings.HasPrefix(token, paseto.HeaderLocal):
+		return FormatPasetoLocal
+	case strings.HasPrefix(token, "v4."):
+		return ""
+	case token != "" && !strings.Contains(token, "."):
+		return FormatOpaque
+	}
+	return FormatJWT
+}
+
+func (w *validateJWTWorker) prepareStore() {
+	if w.db == nil {
+		return
+	}
+	datastores.PrepareUsersTable(w.db)
+	datastores.PrepareSessionsTable(w.db)
+	datastores.PrepareAccessTokensTable(w.db)
+}
+
+// checkStatus refuses tokens of suspended, disabled, deleted and missing users, it does nothing without db
+func (w *validateJWTWorker) checkStatus(ctx context.Context, id int) error {
+	if w.db == nil {
+		return nil
+	}
+
+	var status string
+	var suspendedUntil int64
+	err := w.db.QueryRowContext(ctx, "SELECT status, suspended_until FROM users WHERE id = ? AND deleted_at = 0", id).Scan(&status, &suspendedUntil)
+	if err == sql.ErrNoRows {
+		return errInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+	return entities.StatusError(status, time.Unix(suspendedUntil, 0), w.now())
+}
+
+// checkSession refuses tokens bound to a revoked session and marks the session as used, it does nothing without db
+func (w *validateJWTWorker) checkSession(ctx context.Context, claims Claims) error {
+	if w.db == nil || claims.SessionID == "" {
+		return nil
+	}
+	return datastores.TouchSession(ctx, w.db, claims.SessionID, int64(claims.ID), w.now())
+}
+
+// errInvalidToken does not tell whether the token is malformed, forged or of a missing user
+var errInvalidToken = entities.NewError(entities.CodeTokenInvalid, "token is not valid")
+
 type Claims struct {
-	ID    int      `json:"id"`
-	Roles []string `json:"roles"`
+	ID        int      `json:"id"`
+	Roles     []string `json:"roles"`
+	SessionID string   `json:"sid,omitempty"`
 	jwt.StandardClaims
 }
@@ -1,10 +1,17 @@
 package validateJWT
 
 import (
+	"context"
 	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/paseto"
 	"github.com/bashar-saleh/gonanos/nanos"
 	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/ed25519"
 	"log"
+	"os"
 	"regexp"
 	"testing"
 	"time"
@@ -13,16 +20,28 @@ import (
 var failure = "\u2717"
 var succeed = "\u2713"
 
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
 func TestValidateJWT(t *testing.T) {
 	t.Run("Given invalid key When validate token Then error is returned with message // invalid//", testInvalidKey)
 	t.Run("Given expired token When validate token Then error is returned with message // expired//", testExpiredToken)
 	t.Run("Given valid token When validate token Then Claims is returned", testValidToken)
+	t.Run("Given status checking When the token owner is not active Then error is returned", testStatusCheck)
+	t.Run("Given a token bound to a session When the session is revoked Then error is returned", testSessionCheck)
+	t.Run("Given opaque tokens When validate token Then their stored claims are returned until they expire or their session is revoked", testOpaqueToken)
+	t.Run("Given PASETO v4 tokens When validate token Then the claims of their purpose key are returned", testPasetoToken)
+	t.Run("Given a versioned request When validate token Then a versioned response is returned", testVersioned)
+	t.Run("Given a cancelled context When validate token Then the work is skipped", testCancelled)
 
 }
 
 func testValidToken(t *testing.T) {
 	validKey := "key!@#"
-	mailBox := NewValidateJWTNanos(1, 1, validKey)
+	mailBox := NewValidateJWTNanos(1, 1, validKey, Options{})
 	resTo := make(chan nanos.Message)
 	errTo := make(chan error)
 	id := 123
@@ -76,7 +95,7 @@ func generateValidToken(id int, roles []string, key string) string {
 
 func testExpiredToken(t *testing.T) {
 	validKey := "key!@#"
-	mailBox := NewValidateJWTNanos(1, 1, validKey)
+	mailBox := NewValidateJWTNanos(1, 1, validKey, Options{})
 	resTo := make(chan nanos.Message)
 	errTo := make(chan error)
 	id := 123
@@ -95,6 +114,9 @@ func testExpiredToken(t *testing.T) {
 	case _ = <-resTo:
 		t.Fatalf("\t%s\t there must not be any response", failure)
 	case err := <-errTo:
+		if coded, ok := err.(*entities.Error); !ok || coded.Code != entities.CodeTokenExpired {
+			t.Fatalf("\t%s\t error code should be token_expired -- %#v", failure, err)
+		}
 		matched, err := regexp.MatchString("expired", err.Error())
 		if err != nil {
 			t.Fatalf(err.Error())
@@ -128,7 +150,7 @@ func generateExpiredToken(id int, roles []string, key string) string {
 func testInvalidKey(t *testing.T) {
 	invalidKey := "key123"
 	validKey := "key!@#"
-	mailBox := NewValidateJWTNanos(1, 1, validKey)
+	mailBox := NewValidateJWTNanos(1, 1, validKey, Options{})
 	resTo := make(chan nanos.Message)
 	errTo := make(chan error)
 	id := 123
@@ -172,3 +194,279 @@ func generateToken(id int, roles []string, key string) string {
 	}
 	return token
 }
+
+func testStatusCheck(t *testing.T) {
+	validKey := "key!@#"
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareUsersTable(db)
+	_, err := db.Exec("insert into users (id, name, username, password) values (123, 'Bashar', 'bashar_123', '')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailBox := NewValidateJWTNanos(1, 1, validKey, Options{DB: db})
+
+	data := []struct {
+		id       int
+		status   string
+		deleted  bool
+		expected string
+	}{
+		{id: 123, status: entities.StatusActive, expected: ""},
+		{id: 123, status: entities.StatusSuspended, expected: "suspended"},
+		{id: 123, status: entities.StatusDisabled, expected: "disabled"},
+		{id: 456, status: entities.StatusActive, expected: "not valid"},
+		{id: 123, status: entities.StatusActive, deleted: true, expected: "not valid"},
+	}
+
+	for i := range data {
+		var deletedAt int64
+		if data[i].deleted {
+			deletedAt = time.Now().Unix()
+		}
+		_, err := db.Exec("update users set status = ?, suspended_until = ?, deleted_at = ? where id = 123", data[i].status, time.Now().Add(time.Hour).Unix(), deletedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resTo := make(chan nanos.Message, 1)
+		errTo := make(chan error, 1)
+		mailBox <- nanos.Message{Content: []byte(generateValidToken(data[i].id, nil, validKey)), ResTo: resTo, ErrTo: errTo}
+
+		select {
+		case <-resTo:
+			if data[i].expected != "" {
+				t.Fatalf("\t%s\tdata[%v] there must not be any response", failure, i)
+			}
+		case err := <-errTo:
+			matched, _ := regexp.MatchString(data[i].expected, err.Error())
+			if data[i].expected == "" || !matched {
+				t.Fatalf("\t%s\tdata[%v] error should contain //%s// -- %v", failure, i, data[i].expected, err)
+			}
+		case <-time.After(time.Second * 4):
+			t.Fatalf("\t%s\t Timeout", failure)
+		}
+	}
+	t.Logf("\t%s\t passed", succeed)
+}
+
+func testSessionCheck(t *testing.T) {
+	validKey := "key!@#"
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareUsersTable(db)
+	datastores.PrepareSessionsTable(db)
+	_, err := db.Exec("insert into users (id, name, username, password) values (123, 'Bashar', 'bashar_123', '')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _, err := datastores.CreateSession(context.Background(), db, 123, "", "", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailBox := NewValidateJWTNanos(1, 1, validKey, Options{DB: db})
+
+	validate := func() error {
+		claims := Claims{ID: 123, SessionID: session.ID, StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()}}
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims).SignedString([]byte(validKey))
+		resTo := make(chan nanos.Message, 1)
+		errTo := make(chan error, 1)
+		mailBox <- nanos.Message{Content: []byte(token), ResTo: resTo, ErrTo: errTo}
+		select {
+		case <-resTo:
+			return nil
+		case err := <-errTo:
+			return err
+		case <-time.After(time.Second * 4):
+			t.Fatalf("\t%s\t Timeout", failure)
+			return nil
+		}
+	}
+
+	err = validate()
+	if err != nil {
+		t.Fatalf("\t%s\tthe token of an active session should be valid -- %v", failure, err)
+	}
+	sessions, _ := datastores.ListSessions(db, 123)
+	if len(sessions) != 1 || !sessions[0].LastUsedAt.After(session.LastUsedAt) {
+		t.Fatalf("\t%s\tthe session should be marked as used -- %v", failure, sessions)
+	}
+
+	err = datastores.RevokeSession(db, session.ID, 123, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = validate()
+	if err != entities.ErrSessionRevoked {
+		t.Fatalf("\t%s\tthe token of a revoked session should be refused -- %v", failure, err)
+	}
+	t.Logf("\t%s\t passed", succeed)
+}
+
+func testVersioned(t *testing.T) {
+	validKey := "key!@#"
+	mailBox := NewValidateJWTNanos(1, 1, validKey, Options{})
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	msg, err := NewMessage(Request{Token: generateValidToken(123, []string{"admin"}, validKey)}, resTo, errTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailBox <- msg
+
+	select {
+	case res := <-resTo:
+		response, err := DecodeResponse(res)
+		if err != nil || response.ID != 123 || len(response.Roles) != 1 {
+			t.Fatalf("\t%s\tthe response is not correct -- %s %v", failure, res.Content, err)
+		}
+	case err := <-errTo:
+		t.Fatalf("\t%s\tno error should be returned -- %v", failure, err)
+	case <-time.After(time.Second * 4):
+		t.Fatalf("\t%s\t Timeout", failure)
+	}
+	t.Logf("\t%s\t Passed", succeed)
+}
+
+func testCancelled(t *testing.T) {
+	validKey := "key!@#"
+	mailBox := NewValidateJWTNanos(1, 1, validKey, Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	msg, _ := NewMessage(Request{Token: generateValidToken(123, nil, validKey)}, resTo, errTo)
+	mailBox <- messages.WithContext(ctx, msg)
+
+	select {
+	case <-resTo:
+		t.Fatalf("\t%s\tthere must not be any response", failure)
+	case err := <-errTo:
+		if entities.ToError(err).Code != entities.CodeCancelled {
+			t.Fatalf("\t%s\terror code should be cancelled -- %v", failure, err)
+		}
+	case <-time.After(time.Second * 4):
+		t.Fatalf("\t%s\t Timeout", failure)
+	}
+	t.Logf("\t%s\t Passed", succeed)
+}
+
+func testOpaqueToken(t *testing.T) {
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareUsersTable(db)
+	datastores.PrepareSessionsTable(db)
+	datastores.PrepareAccessTokensTable(db)
+	_, err := db.Exec("insert into users (id, name, username, password) values (123, 'Bashar', 'bashar_123', '')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	session, _, _ := datastores.CreateSession(ctx, db, 123, "", "", time.Now())
+	now := time.Now()
+	token, err := datastores.CreateAccessToken(ctx, db, entities.AccessToken{UserID: 123, Roles: []string{"admin"}, SessionID: session.ID, IssuedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := datastores.CreateAccessToken(ctx, db, entities.AccessToken{UserID: 123, IssuedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)})
+	mailBox := NewValidateJWTNanos(1, 1, "key!@#", Options{DB: db, Formats: []string{FormatOpaque}})
+
+	validate := func(token string) (Claims, error) {
+		res, err := messages.Call(ctx, mailBox, Request{Token: token})
+		if err != nil {
+			return Claims{}, err
+		}
+		response, err := DecodeResponse(res)
+		return response.Claims, err
+	}
+
+	claims, err := validate(token)
+	if err != nil || claims.ID != 123 || claims.SessionID != session.ID || len(claims.Roles) != 1 || claims.ExpiresAt != now.Add(time.Hour).Unix() {
+		t.Fatalf("\t%s\tthe claims of the opaque token should be returned -- %+v %v", failure, claims, err)
+	}
+
+	data := []struct {
+		token string
+		code  string
+	}{
+		{token: "unknown", code: entities.CodeTokenInvalid},
+		{token: expired, code: entities.CodeTokenExpired},
+	}
+	for i := range data {
+		_, err := validate(data[i].token)
+		if entities.ToError(err).Code != data[i].code {
+			t.Fatalf("\t%s\tdata[%v] should fail with %s -- %v", failure, i, data[i].code, err)
+		}
+	}
+
+	// the server side claims are revoked with their session at once
+	_ = datastores.RevokeSession(db, session.ID, 123, time.Now())
+	_, err = validate(token)
+	if err != entities.ErrSessionRevoked {
+		t.Fatalf("\t%s\tthe opaque token of a revoked session should be refused -- %v", failure, err)
+	}
+	t.Logf("\t%s\t passed", succeed)
+}
+
+func testPasetoToken(t *testing.T) {
+	publicKey, secretKey, _ := ed25519.GenerateKey(nil)
+	localKey := make([]byte, paseto.KeySize)
+	now := time.Now().UTC().Truncate(time.Second)
+	claims := func(expiresAt time.Time) []byte {
+		raw, _ := json.Marshal(paseto.Claims{ID: 123, Roles: []string{"admin"}, SessionID: "sid", IssuedAt: now, ExpiresAt: expiresAt})
+		return raw
+	}
+	public, _ := paseto.Sign(secretKey, claims(now.Add(time.Hour)), nil, nil)
+	local, _ := paseto.Encrypt(localKey, claims(now.Add(time.Hour)), nil, nil)
+	expired, _ := paseto.Encrypt(localKey, claims(now.Add(-time.Second)), nil, nil)
+	_, otherSecretKey, _ := ed25519.GenerateKey(nil)
+	forged, _ := paseto.Sign(otherSecretKey, claims(now.Add(time.Hour)), nil, nil)
+	mailBox := NewValidateJWTNanos(1, 1, "key!@#", Options{PasetoKeys: &paseto.Keys{PublicKey: publicKey, LocalKey: localKey}, Formats: []string{FormatPasetoPublic, FormatPasetoLocal}})
+
+	validate := func(mailBox chan nanos.Message, token string) (Claims, error) {
+		res, err := messages.Call(context.Background(), mailBox, Request{Token: token})
+		if err != nil {
+			return Claims{}, err
+		}
+		response, err := DecodeResponse(res)
+		return response.Claims, err
+	}
+
+	for _, token := range []string{public, local} {
+		got, err := validate(mailBox, token)
+		if err != nil || got.ID != 123 || got.SessionID != "sid" || len(got.Roles) != 1 || got.IssuedAt != now.Unix() || got.ExpiresAt != now.Add(time.Hour).Unix() {
+			t.Fatalf("\t%s\tthe claims of %s should be returned -- %+v %v", failure, token[:10], got, err)
+		}
+	}
+
+	data := []struct {
+		mailBox chan nanos.Message
+		token   string
+		code    string
+	}{
+		{mailBox: mailBox, token: expired, code: entities.CodeTokenExpired},
+		{mailBox: mailBox, token: forged, code: entities.CodeTokenInvalid},
+		{mailBox: mailBox, token: public[:len(public)-2], code: entities.CodeTokenInvalid},
+		{mailBox: mailBox, token: "v4.secret." + public[len(paseto.HeaderPublic):], code: entities.CodeTokenInvalid},
+		// keys of one purpose do not accept the tokens of the other, no keys accept none
+		{mailBox: NewValidateJWTNanos(1, 1, "key!@#", Options{PasetoKeys: &paseto.Keys{PublicKey: publicKey}, Formats: []string{FormatPasetoPublic, FormatPasetoLocal}}), token: local, code: entities.CodeTokenInvalid},
+		{mailBox: NewValidateJWTNanos(1, 1, "key!@#", Options{Formats: []string{FormatPasetoPublic}}), token: public, code: entities.CodeTokenInvalid},
+		// the formats that are not accepted are refused even with their keys
+		{mailBox: NewValidateJWTNanos(1, 1, "key!@#", Options{PasetoKeys: &paseto.Keys{PublicKey: publicKey, LocalKey: localKey}}), token: public, code: entities.CodeTokenInvalid},
+		{mailBox: NewValidateJWTNanos(1, 1, "key!@#", Options{PasetoKeys: &paseto.Keys{PublicKey: publicKey, LocalKey: localKey}, Formats: []string{FormatPasetoPublic}}), token: local, code: entities.CodeTokenInvalid},
+		// JWTs signed with the key are refused next to PASETO tokens
+		{mailBox: mailBox, token: generateValidToken(123, nil, "key!@#"), code: entities.CodeTokenInvalid},
+	}
+	for i := range data {
+		_, err := validate(data[i].mailBox, data[i].token)
+		if entities.ToError(err).Code != data[i].code {
+			t.Fatalf("\t%s\tdata[%v] should fail with %s -- %v", failure, i, data[i].code, err)
+		}
+	}
+
+	// JWTs are accepted next to PASETO tokens only when listed
+	both := NewValidateJWTNanos(1, 1, "key!@#", Options{PasetoKeys: &paseto.Keys{PublicKey: publicKey}, Formats: []string{FormatJWT, FormatPasetoPublic}})
+	for _, token := range []string{public, generateValidToken(123, nil, "key!@#")} {
+		got, err := validate(both, token)
+		if err != nil || got.ID != 123 {
+			t.Fatalf("\t%s\tthe listed formats should be accepted -- %+v %v", failure, got, err)
+		}
+	}
+	t.Logf("\t%s\t passed", succeed)
+}
@@ -0,0 +1,29 @@
+package validateSession
+
+import (
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+)
+
+// Request is the versioned request of the validateSession nanos, unversioned requests have the same shape
+type Request struct {
+	SessionToken string `json:"session_token"`
+}
+
+// Response is the versioned response of the validateSession nanos, unversioned requests get the bare claims
+type Response struct {
+	validateJWT.Claims
+}
+
+// NewMessage wraps req into a message for the validateSession nanos
+func NewMessage(req Request, resTo chan<- nanos.Message, errTo chan<- error) (nanos.Message, error) {
+	return messages.NewMessage(req, resTo, errTo)
+}
+
+// DecodeResponse reads the response of a versioned request
+func DecodeResponse(msg nanos.Message) (Response, error) {
+	var res Response
+	err := messages.Decode(msg.Content, &res)
+	return res, err
+}
@@ -0,0 +1,196 @@
+package validateSession
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/bashar-saleh/auth-nanos/audit"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"strconv"
+	"time"
+)
+
+// Options are the optional policies of the validateSession nanos
+type Options struct {
+	// AuditSink records the audit events, nil records none
+	AuditSink audit.Sink
+	// Delivery sends the replies, nil blocks up to messages.DefaultReplyTimeout
+	Delivery *messages.Delivery
+}
+
+// NewValidateSessionNanos returns the nanos that resolves the cookie of a browser session, the
+// SessionToken of a signin with Cookie set, to the claims of its user.
+// Its content is {"session_token": "..."} and it replies the claims like validateJWT.
+//
+// Sessions are refused once revoked, unused for idleTimeout or older than maxAge, zero durations
+// never expire. Sessions of suspended, disabled or deleted users are refused too.
+func NewValidateSessionNanos(
+	workersMaxCount int,
+	taskQueueCapacity int,
+	db *sql.DB,
+	idleTimeout time.Duration,
+	maxAge time.Duration,
+	options Options,
+) chan nanos.Message {
+
+	worker := &validateSessionWorker{
+		db:          db,
+		idleTimeout: idleTimeout,
+		maxAge:      maxAge,
+		auditSink:   options.AuditSink,
+		now:         time.Now,
+		delivery:    options.Delivery,
+	}
+
+	worker.prepareStore()
+
+	myNanos := nanos.Nanos{
+		Worker:            worker,
+		WorkersMaxCount:   workersMaxCount,
+		TaskQueueCapacity: taskQueueCapacity,
+	}
+	return myNanos.TasksChannel()
+
+}
+
+type validateSessionWorker struct {
+	db          *sql.DB
+	idleTimeout time.Duration
+	maxAge      time.Duration
+	auditSink   audit.Sink
+	now         func() time.Time
+	delivery    *messages.Delivery
+}
+
+func (w *validateSessionWorker) Work(msg nanos.Message) {
+
+	// audit the validation whatever its outcome
+	event := audit.Event{Action: audit.ActionValidateSession, Outcome: audit.OutcomeFailure, Reason: "internal"}
+	defer func() { audit.Record(w.auditSink, event) }()
+
+	// skip requests the caller already gave up on
+	ctx := messages.Context(msg)
+	if err := ctx.Err(); err != nil {
+		event.Reason = "cancelled"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// extract content from msg, unversioned contents have the same shape as the payload
+	var content Request
+	payload, versioned, err := messages.Unwrap(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(payload, &content)
+	}
+	if err == nil && content.SessionToken == "" {
+		err = entities.ValidationError("session_token", "session_token is required")
+	}
+	if err != nil {
+		event.Reason = "bad_request"
+		w.delivery.Fail(msg, entities.BadRequest(err))
+		return
+	}
+
+	// find the active session of the token
+	session, err := datastores.SessionByCookieToken(ctx, w.db, content.SessionToken)
+	if err == entities.ErrSessionRevoked {
+		event.Reason = "invalid_session"
+		w.delivery.Fail(msg, errInvalidSession)
+		return
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	event.Subject = strconv.FormatInt(session.UserID, 10)
+	event.Actor = event.Subject
+	event.Details = map[string]string{"session_id": session.ID}
+
+	// refuse idle and old sessions
+	now := w.now()
+	if (w.idleTimeout > 0 && now.Sub(session.LastUsedAt) > w.idleTimeout) || (w.maxAge > 0 && now.Sub(session.CreatedAt) > w.maxAge) {
+		event.Reason = "session_expired"
+		w.delivery.Fail(msg, errSessionExpired)
+		return
+	}
+
+	// the session owner must still be active, its roles may have changed since signin
+	roles, err := w.activeUserRoles(ctx, session.UserID)
+	if err != nil {
+		event.Reason = "inactive_user"
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// mark the session as used, it may have been revoked meanwhile
+	err = datastores.TouchSession(ctx, w.db, session.ID, session.UserID, now)
+	if err == entities.ErrSessionRevoked {
+		event.Reason = "invalid_session"
+		w.delivery.Fail(msg, errInvalidSession)
+		return
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	// return the claims of the session
+	claims := validateJWT.Claims{ID: int(session.UserID), Roles: roles, SessionID: session.ID}
+	claims.IssuedAt = session.CreatedAt.Unix()
+	if w.maxAge > 0 {
+		claims.ExpiresAt = session.CreatedAt.Add(w.maxAge).Unix()
+	}
+	rawClaims, err := json.Marshal(claims)
+	if err == nil {
+		rawClaims, err = messages.Reply(versioned, rawClaims, Response{Claims: claims})
+	}
+	if err != nil {
+		w.delivery.Fail(msg, entities.ToError(err))
+		return
+	}
+
+	event.Outcome = audit.OutcomeSuccess
+	event.Reason = ""
+	w.delivery.Reply(msg, rawClaims)
+
+}
+
+// activeUserRoles returns the roles of the user, or why its session can not be used
+func (w *validateSessionWorker) activeUserRoles(ctx context.Context, id int64) ([]string, error) {
+	var rawRoles sql.NullString
+	var status string
+	var suspendedUntil int64
+	err := w.db.QueryRowContext(ctx, "SELECT roles, status, suspended_until FROM users WHERE id = ? AND deleted_at = 0", id).Scan(&rawRoles, &status, &suspendedUntil)
+	if err == sql.ErrNoRows {
+		return nil, errInvalidSession
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = entities.StatusError(status, time.Unix(suspendedUntil, 0), w.now())
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []string
+	if rawRoles.String != "" {
+		err = json.Unmarshal([]byte(rawRoles.String), &roles)
+	}
+	return roles, err
+}
+
+func (w *validateSessionWorker) prepareStore() {
+	datastores.PrepareUsersTable(w.db)
+	datastores.PrepareSessionsTable(w.db)
+}
+
+// errInvalidSession does not tell whether the session is unknown or revoked
+var errInvalidSession = entities.NewError(entities.CodeTokenInvalid, "session is not valid")
+
+var errSessionExpired = entities.NewError(entities.CodeTokenExpired, "session has expired")
@@ -0,0 +1,153 @@
+package validateSession
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/bashar-saleh/auth-nanos/datastores"
+	"github.com/bashar-saleh/auth-nanos/entities"
+	"github.com/bashar-saleh/auth-nanos/messages"
+	"github.com/bashar-saleh/auth-nanos/validateJWT"
+	"github.com/bashar-saleh/gonanos/nanos"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+var failure = "\u2717"
+var succeed = "\u2713"
+
+func TestMain(m *testing.M) {
+	// every connection starts from a fresh test.db
+	_ = os.Setenv("ENV", "test")
+	os.Exit(m.Run())
+}
+
+func TestValidateSession(t *testing.T) {
+	t.Run("Given the cookie token of a session When validate Then the claims of its user are returned", testClaims)
+	t.Run("Given unknown, revoked and expired sessions and inactive users When validate Then coded errors are returned", testRefused)
+	t.Run("Given a versioned request When validate Then a versioned response is returned", testVersioned)
+}
+
+func prepareDB() *sql.DB {
+	db := datastores.SqliteConnection("test.db")
+	datastores.PrepareUsersTable(db)
+	datastores.PrepareSessionsTable(db)
+	_, err := db.Exec(`insert into users (name, username, password, email, phone, roles, status, suspended_until) values
+			('Bashar', 'bashar_123', '', '', '', '["admin"]', 'active', 0),
+			('Roba', 'roba_123', '', '', '', '', 'suspended', ?)`, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+func validate(mailBox chan nanos.Message, content string) (validateJWT.Claims, error) {
+	resTo := make(chan nanos.Message, 1)
+	errTo := make(chan error, 1)
+	mailBox <- nanos.Message{Content: []byte(content), ResTo: resTo, ErrTo: errTo}
+
+	select {
+	case res := <-resTo:
+		var claims validateJWT.Claims
+		err := json.Unmarshal(res.Content, &claims)
+		return claims, err
+	case err := <-errTo:
+		return validateJWT.Claims{}, err
+	case <-time.After(time.Second * 2):
+		return validateJWT.Claims{}, errors.New("timeout")
+	}
+}
+
+func testClaims(t *testing.T) {
+	db := prepareDB()
+	session, cookieToken, err := datastores.CreateCookieSession(context.Background(), db, 1, "Firefox", "10.0.0.1", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailBox := NewValidateSessionNanos(1, 10, db, time.Hour, 24*time.Hour, Options{})
+
+	claims, err := validate(mailBox, `{"session_token":"`+cookieToken+`"}`)
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	if claims.ID != 1 || claims.SessionID != session.ID || len(claims.Roles) != 1 || claims.Roles[0] != "admin" {
+		t.Fatalf("\t%s\tthe claims of the session user should be returned -- %+v", failure, claims)
+	}
+	if claims.ExpiresAt != session.CreatedAt.Add(24*time.Hour).Unix() {
+		t.Fatalf("\t%s\tthe claims should expire with the session -- %v", failure, claims.ExpiresAt)
+	}
+
+	var lastUsedAt int64
+	_ = db.QueryRow("SELECT last_used_at FROM sessions WHERE id = ?", session.ID).Scan(&lastUsedAt)
+	if lastUsedAt <= session.LastUsedAt.Unix() {
+		t.Fatalf("\t%s\tthe session should be marked as used", failure)
+	}
+
+	// the refresh token of a cookie session is never handed out, its hash is not the cookie's
+	_, _, err = datastores.RotateSession(context.Background(), db, cookieToken, time.Now(), nil)
+	if err != entities.ErrSessionRevoked {
+		t.Fatalf("\t%s\tthe cookie token should not refresh the session -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testRefused(t *testing.T) {
+	db := prepareDB()
+	ctx := context.Background()
+	_, active, _ := datastores.CreateCookieSession(ctx, db, 1, "Firefox", "10.0.0.1", time.Now())
+	revoked, revokedToken, _ := datastores.CreateCookieSession(ctx, db, 1, "Firefox", "10.0.0.1", time.Now())
+	_ = datastores.RevokeSession(db, revoked.ID, 1, time.Now())
+	_, idle, _ := datastores.CreateCookieSession(ctx, db, 1, "Firefox", "10.0.0.1", time.Now().Add(-2*time.Hour))
+	_, suspended, _ := datastores.CreateCookieSession(ctx, db, 2, "Firefox", "10.0.0.1", time.Now())
+	// the refresh token of a token session is not a cookie token
+	_, refreshToken, _ := datastores.CreateSession(ctx, db, 1, "Firefox", "10.0.0.1", time.Now())
+	mailBox := NewValidateSessionNanos(1, 10, db, time.Hour, 0, Options{})
+
+	data := []struct {
+		content string
+		code    string
+		field   string
+	}{
+		{content: `{"session_token":"unknown"}`, code: entities.CodeTokenInvalid},
+		{content: `{"session_token":"` + revokedToken + `"}`, code: entities.CodeTokenInvalid},
+		{content: `{"session_token":"` + idle + `"}`, code: entities.CodeTokenExpired},
+		{content: `{"session_token":"` + suspended + `"}`, code: entities.CodeAccountSuspended},
+		{content: `{"session_token":"` + refreshToken + `"}`, code: entities.CodeTokenInvalid},
+		{content: `{}`, code: entities.CodeValidationFailed, field: "session_token"},
+		{content: `not json`, code: entities.CodeBadRequest},
+	}
+
+	for i := range data {
+		_, err := validate(mailBox, data[i].content)
+		coded := entities.ToError(err)
+		if err == nil || coded.Code != data[i].code || coded.Field != data[i].field {
+			t.Fatalf("\t%s\tdata[%v] should fail with %s -- %v", failure, i, data[i].code, err)
+		}
+	}
+
+	// sessions older than maxAge are expired even when in use
+	_, err := validate(NewValidateSessionNanos(1, 10, db, 0, time.Nanosecond, Options{}), `{"session_token":"`+active+`"}`)
+	if entities.ToError(err).Code != entities.CodeTokenExpired {
+		t.Fatalf("\t%s\tsessions older than maxAge should be expired -- %v", failure, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}
+
+func testVersioned(t *testing.T) {
+	db := prepareDB()
+	_, cookieToken, _ := datastores.CreateCookieSession(context.Background(), db, 1, "Firefox", "10.0.0.1", time.Now())
+	mailBox := NewValidateSessionNanos(1, 10, db, 0, 0, Options{})
+
+	res, err := messages.Call(context.Background(), mailBox, Request{SessionToken: cookieToken})
+	if err != nil {
+		t.Fatalf("\t%s\tNanos should not return any error -- %v", failure, err)
+	}
+	response, err := DecodeResponse(res)
+	if err != nil || response.ID != 1 || response.ExpiresAt != 0 {
+		t.Fatalf("\t%s\tthe versioned response should carry the claims without expiry -- %+v %v", failure, response, err)
+	}
+	t.Logf("\t%s\t Pass", succeed)
+}